@@ -0,0 +1,151 @@
+package analytics
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/CactusDev/Xerophi/rethink"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Bucket sizes usage is rolled up into
+const (
+	Hour = "hour"
+	Day  = "day"
+)
+
+var intervals = map[string]time.Duration{
+	Hour: time.Hour,
+	Day:  24 * time.Hour,
+}
+
+// Rollup aggregates the raw command events from the event log into hourly and
+// daily buckets so that stats queries don't have to scan the whole log
+type Rollup struct {
+	DB       rethink.Database // The storage backend
+	LogTable string           // The table the raw events are in
+	Table    string           // The table the buckets are stored in
+	Interval time.Duration    // How often to roll up new events
+	Since    time.Time        // Events before this have already been rolled up
+}
+
+// bucket is a single time period of usage for a single command
+type bucket struct {
+	Token    string
+	Command  string
+	Interval string
+	Start    int64
+	Count    int
+	Invokers map[string]struct{}
+}
+
+// toMillis converts a time into milliseconds since the epoch
+func toMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// fromMillis converts milliseconds since the epoch into a time
+func fromMillis(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond)).UTC()
+}
+
+// bucketStart returns the start of the bucket the time falls into
+func bucketStart(t time.Time, interval string) time.Time {
+	return t.UTC().Truncate(intervals[interval])
+}
+
+// bucketID generates the ID for a bucket, so re-running a rollup replaces the
+// old bucket rather than adding a duplicate
+func bucketID(token string, command string, interval string, start int64) string {
+	return fmt.Sprintf("%s:%s:%s:%d", token, command, interval, start)
+}
+
+// Run rolls up everything from the start of the day the last run happened in
+// up until now. Whole days are always recomputed so the daily buckets are
+// never left with only part of a day in them
+func (r *Rollup) Run() (int, error) {
+	now := time.Now().UTC()
+	start := bucketStart(r.Since, Day)
+
+	fromDB, err := r.DB.GetByQuery(r.LogTable, rethink.Query{
+		Filter: map[string]interface{}{"event": "command"},
+		Ranges: []rethink.Range{
+			{Field: "timestamp", Min: toMillis(start), Max: toMillis(now)},
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var buckets = make(map[string]*bucket)
+	for _, record := range fromDB {
+		entry, ok := record.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		token, _ := entry["token"].(string)
+		user, _ := entry["user"].(string)
+		timestamp, _ := entry["timestamp"].(float64)
+		data, _ := entry["data"].(map[string]interface{})
+		command, _ := data["command"].(string)
+		if token == "" || command == "" {
+			// Not enough to go on, can't tell what it's for
+			continue
+		}
+
+		for interval := range intervals {
+			bucketTime := toMillis(bucketStart(fromMillis(int64(timestamp)), interval))
+			id := bucketID(token, command, interval, bucketTime)
+			if _, ok := buckets[id]; !ok {
+				buckets[id] = &bucket{
+					Token: token, Command: command, Interval: interval,
+					Start: bucketTime, Invokers: make(map[string]struct{}),
+				}
+			}
+			buckets[id].Count++
+			if user != "" {
+				buckets[id].Invokers[user] = struct{}{}
+			}
+		}
+	}
+
+	for id, b := range buckets {
+		var invokers = make([]string, 0, len(b.Invokers))
+		for user := range b.Invokers {
+			invokers = append(invokers, user)
+		}
+		_, err := r.DB.Upsert(r.Table, map[string]interface{}{
+			"id":        id,
+			"token":     b.Token,
+			"command":   b.Command,
+			"interval":  b.Interval,
+			"start":     b.Start,
+			"count":     b.Count,
+			"invokers":  invokers,
+			"deletedAt": 0,
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	r.Since = now
+	return len(buckets), nil
+}
+
+// Start rolls up new events in the background every interval
+func (r *Rollup) Start() {
+	go func() {
+		for {
+			updated, err := r.Run()
+			if err != nil {
+				log.Error(err.Error())
+			} else {
+				log.Debugf("[%s] - Rolled up %d buckets", r.Table, updated)
+			}
+
+			time.Sleep(r.Interval)
+		}
+	}()
+}
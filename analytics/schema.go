@@ -0,0 +1,51 @@
+package analytics
+
+import (
+	"github.com/CactusDev/Xerophi/util"
+)
+
+// StatsResponseSchema is the schema for a single command's usage over time
+type StatsResponseSchema struct {
+	ID             string        `jsonapi:"primary,commandStats"`
+	Buckets        []BucketUsage `jsonapi:"attr,buckets"`
+	Command        string        `jsonapi:"attr,command"`
+	Count          int           `jsonapi:"attr,count"`
+	From           string        `jsonapi:"attr,from"`
+	Interval       string        `jsonapi:"attr,interval"`
+	To             string        `jsonapi:"attr,to"`
+	UniqueInvokers int           `jsonapi:"attr,uniqueInvokers"`
+	Token          string        `jsonapi:"meta,token"`
+}
+
+// TopResponseSchema is the schema for the most used commands in a channel
+type TopResponseSchema struct {
+	ID       string         `jsonapi:"primary,commandTop"`
+	Commands []CommandUsage `jsonapi:"attr,commands"`
+	From     string         `jsonapi:"attr,from"`
+	To       string         `jsonapi:"attr,to"`
+	Token    string         `jsonapi:"meta,token"`
+}
+
+// BucketUsage is how much a command was used within a single bucket
+type BucketUsage struct {
+	Start          string `json:"start"`
+	Count          int    `json:"count"`
+	UniqueInvokers int    `json:"uniqueInvokers"`
+}
+
+// CommandUsage is how much a command was used over the whole window
+type CommandUsage struct {
+	Command        string `json:"command"`
+	Count          int    `json:"count"`
+	UniqueInvokers int    `json:"uniqueInvokers"`
+}
+
+// GetAPITag allows each of these types to implement the JSONAPISchema interface
+func (sr StatsResponseSchema) GetAPITag(lookup string) string {
+	return util.FieldTag(sr, lookup, "jsonapi")
+}
+
+// GetAPITag allows each of these types to implement the JSONAPISchema interface
+func (tr TopResponseSchema) GetAPITag(lookup string) string {
+	return util.FieldTag(tr, lookup, "jsonapi")
+}
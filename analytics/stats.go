@@ -0,0 +1,228 @@
+package analytics
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CactusDev/Xerophi/rethink"
+	"github.com/CactusDev/Xerophi/types"
+	"github.com/CactusDev/Xerophi/util"
+
+	"github.com/gin-gonic/gin"
+
+	mapstruct "github.com/mitchellh/mapstructure"
+	log "github.com/sirupsen/logrus"
+)
+
+// Windows longer than this are answered from the daily buckets
+const hourlyLimit = 72 * time.Hour
+
+// Stats answers usage questions from the rolled up buckets
+type Stats struct {
+	DB    rethink.Database // The storage backend
+	Table string           // The table the buckets are stored in
+}
+
+// storedBucket is a bucket as it's stored by the rollup
+type storedBucket struct {
+	Command  string
+	Start    int64
+	Count    int
+	Invokers []string
+}
+
+// Routes returns the routing information for this endpoint
+func (s *Stats) Routes() []types.RouteDetails {
+	return []types.RouteDetails{
+		types.RouteDetails{
+			Enabled: true, Path: "/commands", Verb: "GET",
+			Handler: s.GetTop,
+		},
+	}
+}
+
+// parseWindow pulls the from and to times out of the request, defaulting to
+// the window given leading up to now
+func parseWindow(ctx *gin.Context, window time.Duration) (time.Time, time.Time, error) {
+	to := time.Now().UTC()
+	if raw := ctx.Query("to"); raw != "" {
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return to, to, util.InvalidParameter("to", "to must be an RFC3339 timestamp")
+		}
+		to = parsed.UTC()
+	}
+
+	from := to.Add(-window)
+	if raw := ctx.Query("from"); raw != "" {
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return from, to, util.InvalidParameter("from", "from must be an RFC3339 timestamp")
+		}
+		from = parsed.UTC()
+	}
+
+	if !from.Before(to) {
+		return from, to, util.InvalidParameter("from", "from must be before to")
+	}
+
+	return from, to, nil
+}
+
+// Buckets retrieves the buckets covering the window for a channel, oldest
+// first. An empty command returns the buckets for every command
+func (s *Stats) Buckets(token string, command string, interval string, from time.Time, to time.Time) ([]storedBucket, error) {
+	query := rethink.Query{
+		Filter: map[string]interface{}{"token": token, "interval": interval},
+		Ranges: []rethink.Range{{
+			Field: "start",
+			Min:   toMillis(bucketStart(from, interval)),
+			Max:   toMillis(to),
+		}},
+		Sort: []rethink.Sort{{Field: "start"}},
+	}
+	if command != "" {
+		query.Filter["command"] = command
+	}
+
+	fromDB, err := s.DB.GetByQuery(s.Table, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var buckets = make([]storedBucket, 0, len(fromDB))
+	for _, record := range fromDB {
+		var decoded storedBucket
+		// If there's an issue decoding it, just log it and move on to the next record
+		if err := mapstruct.Decode(record, &decoded); err != nil {
+			log.Error(err.Error())
+			continue
+		}
+		buckets = append(buckets, decoded)
+	}
+
+	return buckets, nil
+}
+
+// GetCommand returns the usage of a single command over time. Used by the
+// command resource for /command/:name/stats
+func (s *Stats) GetCommand(ctx *gin.Context) {
+	token := strings.ToLower(html.EscapeString(ctx.Param("token")))
+	name := html.EscapeString(ctx.Param("name"))
+
+	from, to, err := parseWindow(ctx, 7*24*time.Hour)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusBadRequest)
+		return
+	}
+	interval := ctx.DefaultQuery("interval", Day)
+	if _, ok := intervals[interval]; !ok {
+		util.NiceError(ctx, util.InvalidParameter("interval", "interval must be %s or %s", Hour, Day),
+			http.StatusBadRequest)
+		return
+	}
+
+	buckets, err := s.Buckets(token, name, interval, from, to)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+
+	response := StatsResponseSchema{
+		ID:       token + ":" + name,
+		Buckets:  make([]BucketUsage, 0, len(buckets)),
+		Command:  name,
+		From:     from.Format(time.RFC3339),
+		Interval: interval,
+		To:       to.Format(time.RFC3339),
+		Token:    token,
+	}
+	var invokers = make(map[string]struct{})
+	for _, b := range buckets {
+		response.Buckets = append(response.Buckets, BucketUsage{
+			Start:          fromMillis(b.Start).Format(time.RFC3339),
+			Count:          b.Count,
+			UniqueInvokers: len(b.Invokers),
+		})
+		response.Count += b.Count
+		for _, user := range b.Invokers {
+			invokers[user] = struct{}{}
+		}
+	}
+	response.UniqueInvokers = len(invokers)
+
+	ctx.Header("x-total-count", "1")
+	ctx.JSON(http.StatusOK, util.MarshalResponse(response))
+}
+
+// GetTop returns the most used commands in the channel over the window
+func (s *Stats) GetTop(ctx *gin.Context) {
+	token := strings.ToLower(html.EscapeString(ctx.Param("token")))
+
+	from, to, err := parseWindow(ctx, 24*time.Hour)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusBadRequest)
+		return
+	}
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "10"))
+	if err != nil || limit < 1 {
+		util.NiceError(ctx, util.InvalidParameter("limit", "limit must be a positive integer"),
+			http.StatusBadRequest)
+		return
+	}
+
+	// No need to pull hundreds of hourly buckets for a long window
+	interval := Hour
+	if to.Sub(from) > hourlyLimit {
+		interval = Day
+	}
+
+	buckets, err := s.Buckets(token, "", interval, from, to)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+
+	var counts = make(map[string]int)
+	var invokers = make(map[string]map[string]struct{})
+	for _, b := range buckets {
+		counts[b.Command] += b.Count
+		if _, ok := invokers[b.Command]; !ok {
+			invokers[b.Command] = make(map[string]struct{})
+		}
+		for _, user := range b.Invokers {
+			invokers[b.Command][user] = struct{}{}
+		}
+	}
+
+	var usage = make([]CommandUsage, 0, len(counts))
+	for command, count := range counts {
+		usage = append(usage, CommandUsage{
+			Command: command, Count: count,
+			UniqueInvokers: len(invokers[command]),
+		})
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Count == usage[j].Count {
+			return usage[i].Command < usage[j].Command
+		}
+		return usage[i].Count > usage[j].Count
+	})
+	if len(usage) > limit {
+		usage = usage[:limit]
+	}
+
+	ctx.Header("x-total-count", fmt.Sprint(len(usage)))
+	ctx.JSON(http.StatusOK, util.MarshalResponse(TopResponseSchema{
+		ID:       token,
+		Commands: usage,
+		From:     from.Format(time.RFC3339),
+		To:       to.Format(time.RFC3339),
+		Token:    token,
+	}))
+}
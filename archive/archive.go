@@ -0,0 +1,221 @@
+package archive
+
+import (
+	"fmt"
+	"html"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CactusDev/Xerophi/rethink"
+	"github.com/CactusDev/Xerophi/revision"
+	"github.com/CactusDev/Xerophi/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Version is the version of the archive format, bumped whenever it changes in
+// a way older versions of the API can't read
+const Version = 1
+
+// Modes an import can run in
+const (
+	Merge   = "merge"   // Records in the archive replace ones with the same key, the rest are left alone
+	Replace = "replace" // Everything the channel has of each resource in the archive is replaced
+)
+
+// Kind describes a resource that's part of a channel's archive
+type Kind struct {
+	Name   string      // What the records are listed under, e.g. "commands"
+	Table  string      // The table the records are kept in
+	Key    []string    // Fields that pick out a record in the channel, none if a channel only has one
+	Schema string      // The JSON schema the client fields are validated against
+	Client interface{} // The struct with the fields clients can set
+	// Parse converts key fields the way their routes do, e.g. escaping a name,
+	// so imported records can be found by them. Fields without one are kept
+	// as they are
+	Parse map[string]func(raw string) (interface{}, error)
+	// Fields the API normally fills in itself that are kept from the archive,
+	// e.g. a command's count
+	Keep []string
+	// Values used for any fields a new record in the archive doesn't have,
+	// merged records keep what they already had
+	Defaults map[string]interface{}
+	// A numeric key field that records can leave out, they're numbered
+	// after the highest one the channel already has
+	Sequence string
+	// AfterImport is run once a channel's records have been imported
+	AfterImport func(token string) error
+	// History is where changes to the records are kept, nil if they aren't.
+	// Every record an import changes gets an import revision there, under
+	// Resource and the value of its only key field
+	History  *revision.Store
+	Resource string // What the records are called in their history, e.g. "command"
+}
+
+// Archive is everything a channel has, keyed by the name of each resource
+type Archive struct {
+	Version    int                                 `json:"version"`
+	Token      string                              `json:"token"`
+	ExportedAt string                              `json:"exportedAt"`
+	Resources  map[string][]map[string]interface{} `json:"resources,omitempty"`
+}
+
+// Warning is something in another bot's export that couldn't be brought over
+// as it was
+type Warning struct {
+	Resource string `json:"resource"` // The resource it was going to be, e.g. "commands"
+	Record   string `json:"record"`   // What the record was called in the export
+	Detail   string `json:"detail"`
+}
+
+// Source converts an export from another bot into an archive that can be
+// imported like any other
+type Source interface {
+	Convert(body []byte) (Archive, []Warning, error)
+}
+
+// Line is a single record in an NDJSON archive, every line after the header
+type Line struct {
+	Resource string                 `json:"resource"`
+	Record   map[string]interface{} `json:"record"`
+}
+
+// internal are the fields that only mean anything to this database, so they
+// aren't exported
+var internal = []string{"id", "token", "deletedAt", "version"}
+
+// Archiver exports and imports everything a channel has
+type Archiver struct {
+	DB      rethink.Database  // The storage backend
+	Kinds   []Kind            // Everything that's part of an archive
+	Sources map[string]Source // Other bots' exports that can be imported, by source= name
+
+	mutex sync.Mutex // Imports are run one at a time
+}
+
+// Routes returns the routing information for this endpoint
+func (a *Archiver) Routes() []types.RouteDetails {
+	return []types.RouteDetails{
+		types.RouteDetails{
+			Enabled: true, Path: "/export", Verb: "GET",
+			Handler: a.Export,
+		},
+		types.RouteDetails{
+			Enabled: true, Path: "/import", Verb: "POST",
+			Handler: a.Import,
+		},
+	}
+}
+
+// kind looks up the resource by its name in the archive
+func (a *Archiver) kind(name string) (Kind, bool) {
+	for _, kind := range a.Kinds {
+		if kind.Name == name {
+			return kind, true
+		}
+	}
+	return Kind{}, false
+}
+
+// records retrieves all of the channel's records for the resource, without
+// the fields that only mean anything to this database
+func (a *Archiver) records(kind Kind, token string) ([]map[string]interface{}, error) {
+	fromDB, err := a.DB.GetByQuery(kind.Table, rethink.Query{
+		Filter: map[string]interface{}{"token": token},
+		Sort:   []rethink.Sort{{Field: "createdAt"}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var records = make([]map[string]interface{}, 0, len(fromDB))
+	for _, record := range fromDB {
+		mapped, ok := record.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, field := range internal {
+			delete(mapped, field)
+		}
+		records = append(records, mapped)
+	}
+	return records, nil
+}
+
+// jsonFields returns the names of the fields in the struct's JSON, including
+// the ones from any embedded structs
+func jsonFields(value interface{}) []string {
+	var fields []string
+	ift := reflect.TypeOf(value)
+	for i := 0; i < ift.NumField(); i++ {
+		field := ift.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			fields = append(fields, jsonFields(reflect.Zero(field.Type).Interface())...)
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, name)
+	}
+	return fields
+}
+
+// pick copies the fields given out of the record, skipping any it doesn't have
+func pick(record map[string]interface{}, fields []string) map[string]interface{} {
+	var picked = make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		if val, ok := record[field]; ok {
+			picked[field] = val
+		}
+	}
+	return picked
+}
+
+// parseKey converts a key field from the archive with its route's parser.
+// Routes get the key as a string, so a number is turned into one first
+func parseKey(parse func(raw string) (interface{}, error), field string,
+	value interface{}) (interface{}, error) {
+	var raw string
+	switch val := value.(type) {
+	case string:
+		raw = val
+	case float64:
+		raw = strconv.FormatFloat(val, 'f', -1, 64)
+	case int:
+		raw = strconv.Itoa(val)
+	default:
+		return nil, fmt.Errorf("%s must be a string or a number", field)
+	}
+	parsed, err := parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s %s", field, raw)
+	}
+	return parsed, nil
+}
+
+// keyOf returns the key of the record as a string, for matching records up
+func keyOf(record map[string]interface{}, fields []string) string {
+	var values = make([]string, len(fields))
+	for pos, field := range fields {
+		values[pos] = fmt.Sprint(record[field])
+	}
+	return strings.Join(values, ":")
+}
+
+// token returns the normalized token from the route
+func token(ctx *gin.Context) string {
+	return strings.ToLower(html.EscapeString(ctx.Param("token")))
+}
+
+// now is the current time formatted the way createdAt is stored
+func now() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,93 @@
+package archive
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/CactusDev/Xerophi/util"
+
+	"github.com/gin-gonic/gin"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// NDJSON is the content type of the streamed archive
+const NDJSON = "application/x-ndjson"
+
+// format works out which format the archive was asked for in, either with the
+// format parameter or the Accept header
+func format(ctx *gin.Context) (string, error) {
+	requested := ctx.Query("format")
+	if requested == "" && strings.Contains(ctx.GetHeader("Accept"), NDJSON) {
+		requested = "ndjson"
+	}
+	switch requested {
+	case "", "json":
+		return "json", nil
+	case "ndjson":
+		return "ndjson", nil
+	}
+	return "", util.InvalidParameter("format", "Can't export as %s", requested)
+}
+
+// Export returns everything the channel has, either as a single JSON document
+// or as NDJSON streamed one record per line after a header line
+func (a *Archiver) Export(ctx *gin.Context) {
+	channel := token(ctx)
+	as, err := format(ctx)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusBadRequest)
+		return
+	}
+
+	header := Archive{Version: Version, Token: channel, ExportedAt: now()}
+	ctx.Header("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="%s-export.%s"`, channel, as))
+
+	if as == "ndjson" {
+		a.stream(ctx, header)
+		return
+	}
+
+	header.Resources = make(map[string][]map[string]interface{}, len(a.Kinds))
+	for _, kind := range a.Kinds {
+		records, err := a.records(kind, channel)
+		if err != nil {
+			util.NiceError(ctx, err, http.StatusInternalServerError)
+			return
+		}
+		header.Resources[kind.Name] = records
+	}
+
+	ctx.JSON(http.StatusOK, header)
+}
+
+// stream writes the archive out as NDJSON a resource at a time, so the whole
+// thing never has to be held at once
+func (a *Archiver) stream(ctx *gin.Context, header Archive) {
+	ctx.Header("Content-Type", NDJSON)
+	ctx.Status(http.StatusOK)
+
+	encoder := json.NewEncoder(ctx.Writer)
+	if err := encoder.Encode(header); err != nil {
+		log.Error(err.Error())
+		return
+	}
+	for _, kind := range a.Kinds {
+		// The response has already started, all we can do is stop early
+		records, err := a.records(kind, header.Token)
+		if err != nil {
+			log.Errorf("[%s] - Export stopped early: %s", kind.Table, err)
+			return
+		}
+		for _, record := range records {
+			if err := encoder.Encode(Line{Resource: kind.Name, Record: record}); err != nil {
+				log.Error(err.Error())
+				return
+			}
+		}
+		ctx.Writer.Flush()
+	}
+}
@@ -0,0 +1,485 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/CactusDev/Xerophi/rethink"
+	"github.com/CactusDev/Xerophi/revision"
+	"github.com/CactusDev/Xerophi/util"
+
+	"github.com/gin-gonic/gin"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// invalidDocument is the error for an archive that can't be read at all
+func invalidDocument(format string, args ...interface{}) util.APIError {
+	return util.APIError{
+		Code: util.ErrInvalidDocument,
+		Data: map[string]interface{}{"": fmt.Sprintf(format, args...)},
+	}
+}
+
+// decode reads an archive, either a single JSON document or NDJSON with the
+// header on the first line
+func decode(body []byte, contentType string) (Archive, error) {
+	var archive Archive
+	if !strings.Contains(contentType, "ndjson") {
+		if err := json.Unmarshal(body, &archive); err != nil {
+			return archive, invalidDocument("Invalid archive: %s", err)
+		}
+		return archive, nil
+	}
+
+	var header bool
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), len(body)+1)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		if !header {
+			if err := json.Unmarshal(raw, &archive); err != nil {
+				return archive, invalidDocument("Invalid header on line %d: %s", lineNum, err)
+			}
+			archive.Resources = make(map[string][]map[string]interface{})
+			header = true
+			continue
+		}
+		var line Line
+		if err := json.Unmarshal(raw, &line); err != nil {
+			return archive, invalidDocument("Invalid record on line %d: %s", lineNum, err)
+		}
+		archive.Resources[line.Resource] = append(archive.Resources[line.Resource], line.Record)
+	}
+	if err := scanner.Err(); err != nil {
+		return archive, invalidDocument("Invalid archive: %s", err)
+	}
+
+	return archive, nil
+}
+
+// prepare validates every record in the archive against its resource's schema
+// and turns the valid ones into what gets stored. Every problem is returned
+// rather than just the first, each pointing at the record that caused it
+func (a *Archiver) prepare(archive Archive, channel string) (map[string][]map[string]interface{}, []util.ErrorObject) {
+	var rows = make(map[string][]map[string]interface{}, len(archive.Resources))
+	var errs []util.ErrorObject
+
+	for name, records := range archive.Resources {
+		kind, ok := a.kind(name)
+		if !ok {
+			obj := util.NewError(util.ErrValidation, "Unknown resource "+name)
+			obj.Source = &util.ErrorSource{Pointer: "/resources/" + name}
+			errs = append(errs, obj)
+			continue
+		}
+
+		clientFields := jsonFields(kind.Client)
+		seen := make(map[string]struct{}, len(records))
+		rows[name] = make([]map[string]interface{}, 0, len(records))
+
+		for pos, record := range records {
+			pointer := fmt.Sprintf("/resources/%s/%d", name, pos)
+			client := pick(record, clientFields)
+
+			body, err := json.Marshal(client)
+			if err == nil {
+				err = util.ValidateInput(body, kind.Schema)
+			}
+			if validateErr, ok := err.(util.APIError); ok {
+				validateErr.Prefix = pointer
+				errs = append(errs, validateErr.Objects()...)
+				continue
+			} else if err != nil {
+				obj := util.NewError(util.ErrValidation, err.Error())
+				obj.Source = &util.ErrorSource{Pointer: pointer}
+				errs = append(errs, obj)
+				continue
+			}
+
+			var missing bool
+			for _, field := range kind.Key {
+				if record[field] == nil && field != kind.Sequence {
+					obj := util.NewError(util.ErrValidation, field+" is required")
+					obj.Source = &util.ErrorSource{Pointer: pointer + "/" + field}
+					errs = append(errs, obj)
+					missing = true
+				}
+			}
+			if missing {
+				continue
+			}
+
+			keys := pick(record, kind.Key)
+			var badKey bool
+			for field, val := range keys {
+				parse, ok := kind.Parse[field]
+				if !ok || val == nil {
+					continue
+				}
+				parsed, err := parseKey(parse, field, val)
+				if err != nil {
+					obj := util.NewError(util.ErrValidation, err.Error())
+					obj.Source = &util.ErrorSource{Pointer: pointer + "/" + field}
+					errs = append(errs, obj)
+					badKey = true
+					continue
+				}
+				keys[field] = parsed
+			}
+			if badKey {
+				continue
+			}
+
+			// Every record has to have its own key, channels only have one of
+			// resources without a key
+			key := keyOf(keys, kind.Key)
+			if _, dupe := seen[key]; dupe && !unnumbered(record, kind) {
+				obj := util.NewError(util.ErrValidation, "Duplicate record in "+name)
+				obj.Source = &util.ErrorSource{Pointer: pointer}
+				errs = append(errs, obj)
+				continue
+			}
+			seen[key] = struct{}{}
+
+			// Only what's in the archive, defaults are filled in when it's
+			// written since merged records keep what they already have
+			row := make(map[string]interface{})
+			for field, val := range client {
+				row[field] = val
+			}
+			for field, val := range keys {
+				row[field] = val
+			}
+			for field, val := range pick(record, kind.Keep) {
+				row[field] = val
+			}
+			if createdAt, ok := record["createdAt"].(string); ok && createdAt != "" {
+				row["createdAt"] = createdAt
+			}
+			row["token"] = channel
+			row["deletedAt"] = 0
+			rows[name] = append(rows[name], row)
+		}
+	}
+
+	return rows, errs
+}
+
+// change is a record the import changed, kept so it can be added to the
+// record's history once the whole import has gone in
+type change struct {
+	kind   Kind
+	before map[string]interface{} // nil if the import created it
+	after  map[string]interface{} // nil if the import removed it
+}
+
+// write stores the records for a single resource, returning every record it
+// changed
+func (a *Archiver) write(kind Kind, channel string, mode string,
+	rows []map[string]interface{}, existing []interface{}) ([]change, error) {
+	everything := rethink.Query{
+		Filter:  map[string]interface{}{"token": channel},
+		Deleted: rethink.WithDeleted,
+	}
+
+	// Records that are already there, so merged ones replace them and
+	// replaced ones carry on from their version
+	var current = make(map[string]map[string]interface{}, len(existing))
+	for _, record := range existing {
+		if mapped, ok := record.(map[string]interface{}); ok {
+			current[keyOf(mapped, kind.Key)] = mapped
+		}
+	}
+	if mode == Replace {
+		if _, err := a.DB.DeleteByQuery(kind.Table, everything); err != nil {
+			return nil, err
+		}
+	}
+
+	// Anything without a number goes after everything that has one
+	if kind.Sequence != "" {
+		var next int
+		for _, record := range existing {
+			if mapped, ok := record.(map[string]interface{}); ok && mode != Replace {
+				next = highest(next, mapped[kind.Sequence])
+			}
+		}
+		for _, row := range rows {
+			next = highest(next, row[kind.Sequence])
+		}
+		for _, row := range rows {
+			if row[kind.Sequence] == nil {
+				next++
+				row[kind.Sequence] = next
+			}
+		}
+	}
+
+	var changes = make([]change, 0, len(rows))
+	var written = make(map[string]struct{}, len(rows))
+	for _, row := range rows {
+		key := keyOf(row, kind.Key)
+		match, found := current[key]
+		var stored = make(map[string]interface{})
+		if found && mode != Replace {
+			// Anything the archive leaves out is kept as it is
+			for field, val := range match {
+				stored[field] = val
+			}
+		} else {
+			for field, val := range kind.Defaults {
+				stored[field] = val
+			}
+			stored["createdAt"] = now()
+		}
+		version := 1
+		if found {
+			// It's still the same record, so it carries on from its version
+			// and anything cached from before doesn't match it
+			previous, _ := match["version"].(float64)
+			version = int(previous) + 1
+			stored["id"] = match["id"]
+		}
+		for field, val := range row {
+			stored[field] = val
+		}
+		stored["version"] = version
+		if _, err := a.DB.Upsert(kind.Table, stored); err != nil {
+			return nil, err
+		}
+		written[key] = struct{}{}
+		changes = append(changes, change{kind: kind, before: match, after: stored})
+	}
+
+	// Replacing removes everything the archive doesn't have
+	if mode == Replace {
+		for _, record := range existing {
+			mapped, ok := record.(map[string]interface{})
+			if _, kept := written[keyOf(mapped, kind.Key)]; ok && !kept {
+				changes = append(changes, change{kind: kind, before: mapped})
+			}
+		}
+	}
+
+	return changes, nil
+}
+
+// unnumbered returns if the record left out its sequence number
+func unnumbered(record map[string]interface{}, kind Kind) bool {
+	return kind.Sequence != "" && record[kind.Sequence] == nil
+}
+
+// highest returns whichever is bigger, the current number or the value if
+// it's a number
+func highest(current int, value interface{}) int {
+	var num int
+	switch val := value.(type) {
+	case float64:
+		num = int(val)
+	case int:
+		num = val
+	}
+	if num > current {
+		return num
+	}
+	return current
+}
+
+// restore puts the resources back how they were before the import. Records
+// the import wrote are put back as a version after the one it wrote, so
+// anything cached from the import doesn't match them
+func (a *Archiver) restore(channel string, backups map[string][]interface{}) {
+	for name, records := range backups {
+		kind, _ := a.kind(name)
+		everything := rethink.Query{
+			Filter:  map[string]interface{}{"token": channel},
+			Deleted: rethink.WithDeleted,
+		}
+
+		var versions = make(map[string]interface{})
+		written, err := a.DB.GetByQuery(kind.Table, everything)
+		for _, record := range written {
+			if mapped, ok := record.(map[string]interface{}); ok {
+				versions[keyOf(mapped, kind.Key)] = mapped["version"]
+			}
+		}
+		if err == nil {
+			_, err = a.DB.DeleteByQuery(kind.Table, everything)
+		}
+		for _, record := range records {
+			if err != nil {
+				break
+			}
+			mapped, ok := record.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if version, ok := versions[keyOf(mapped, kind.Key)].(float64); ok &&
+				version != mapped["version"] {
+				mapped["version"] = version + 1
+			}
+			_, err = a.DB.Upsert(kind.Table, mapped)
+		}
+		if err != nil {
+			log.Errorf("[%s] - Failed to undo import for %s: %s", kind.Table, channel, err)
+		}
+	}
+}
+
+// apply writes every resource in the import. If any of it fails everything
+// that was already written is put back, so the import either happens or it
+// doesn't. Once it's all in, every record it changed gets an import revision
+func (a *Archiver) apply(channel string, author string, mode string,
+	rows map[string][]map[string]interface{}) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	var backups = make(map[string][]interface{}, len(rows))
+	var changes []change
+	for _, kind := range a.Kinds {
+		incoming, ok := rows[kind.Name]
+		if !ok {
+			// Resources that aren't in the archive are left alone
+			continue
+		}
+
+		existing, err := a.DB.GetByQuery(kind.Table, rethink.Query{
+			Filter:  map[string]interface{}{"token": channel},
+			Deleted: rethink.WithDeleted,
+		})
+		if err != nil {
+			a.restore(channel, backups)
+			return err
+		}
+		backups[kind.Name] = existing
+
+		written, err := a.write(kind, channel, mode, incoming, existing)
+		if err != nil {
+			a.restore(channel, backups)
+			return err
+		}
+		changes = append(changes, written...)
+	}
+
+	for _, c := range changes {
+		if c.kind.History == nil {
+			continue
+		}
+		keyed := c.after
+		if keyed == nil {
+			keyed = c.before
+		}
+		// The records are already in, so this is only logged
+		err := c.kind.History.Record(revision.Entry{
+			Token:    channel,
+			Resource: c.kind.Resource,
+			Key:      keyOf(keyed, c.kind.Key),
+			Action:   revision.Import,
+			Author:   author,
+			Before:   c.before,
+			After:    c.after,
+		})
+		if err != nil {
+			log.Errorf("[%s] - Failed to record import revision for %s: %s",
+				c.kind.Table, channel, err)
+		}
+	}
+
+	return nil
+}
+
+// Import brings in an archive, in merge mode unless mode=replace is given.
+// Every record is validated before anything is written, and if any of them
+// fail none of the archive is imported
+func (a *Archiver) Import(ctx *gin.Context) {
+	channel := token(ctx)
+	mode := ctx.DefaultQuery("mode", Merge)
+	if mode != Merge && mode != Replace {
+		util.NiceError(ctx, util.InvalidParameter("mode", "Unknown mode %s", mode),
+			http.StatusBadRequest)
+		return
+	}
+
+	body, err := ioutil.ReadAll(ctx.Request.Body)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusBadRequest)
+		return
+	}
+
+	// Exports from other bots are converted first, then imported like ours
+	var archive Archive
+	var warnings []Warning
+	source := ctx.Query("source")
+	if source == "" {
+		archive, err = decode(body, ctx.ContentType())
+	} else if converter, ok := a.Sources[source]; ok {
+		archive, warnings, err = converter.Convert(body)
+		archive.Version = Version
+	} else {
+		err = util.InvalidParameter("source", "Unknown source %s", source)
+	}
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusBadRequest)
+		return
+	}
+	if archive.Version < 1 || archive.Version > Version {
+		util.NiceError(ctx, invalidDocument("Unsupported archive version %d", archive.Version),
+			http.StatusBadRequest)
+		return
+	}
+
+	rows, errs := a.prepare(archive, channel)
+	if len(errs) > 0 {
+		util.AbortWithErrors(ctx, errs...)
+		return
+	}
+
+	if err := a.apply(channel, util.Actor(ctx), mode, rows); err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+
+	var imported = make(map[string]int, len(rows))
+	var total int
+	for _, kind := range a.Kinds {
+		incoming, ok := rows[kind.Name]
+		if !ok {
+			continue
+		}
+		imported[kind.Name] = len(incoming)
+		total += len(incoming)
+		if kind.AfterImport == nil {
+			continue
+		}
+		// The records are already in, so this is only logged
+		if err := kind.AfterImport(channel); err != nil {
+			log.Errorf("[%s] - After import failed for %s: %s", kind.Table, channel, err)
+		}
+	}
+
+	meta := map[string]interface{}{
+		"mode":     mode,
+		"imported": imported,
+		"total":    total,
+	}
+	if source != "" {
+		meta["source"] = source
+		meta["warnings"] = warnings
+		if warnings == nil {
+			meta["warnings"] = []Warning{}
+		}
+	}
+	ctx.JSON(http.StatusOK, map[string]interface{}{
+		"jsonapi": map[string]interface{}{"version": util.JSONAPIVersion},
+		"meta":    meta,
+	})
+}
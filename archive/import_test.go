@@ -0,0 +1,155 @@
+package archive
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/CactusDev/Xerophi/rethink"
+	"github.com/CactusDev/Xerophi/rethink/rethinktest"
+	"github.com/CactusDev/Xerophi/revision"
+	"github.com/CactusDev/Xerophi/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// testCommand is the fields a client can set on a test command
+type testCommand struct {
+	Enabled  bool   `json:"enabled"`
+	Response string `json:"response"`
+}
+
+// setup routes imports of commands through a router backed by an in-memory
+// database, with the channel already having the commands named
+func setup(t *testing.T, names ...string) (http.Handler, *rethinktest.Memory) {
+	db := rethinktest.NewMemory()
+	for _, name := range names {
+		db.Create("commands", map[string]interface{}{
+			"id": name + "-id", "token": "channel", "name": name, "response": "old",
+			"enabled": true, "version": 4, "deletedAt": 0,
+		})
+	}
+
+	archiver := &Archiver{
+		DB: db,
+		Kinds: []Kind{{
+			Name:     "commands",
+			Table:    "commands",
+			Key:      []string{"name"},
+			Schema:   "/testdata/schema.json",
+			Client:   testCommand{},
+			Defaults: map[string]interface{}{"enabled": true},
+			History:  &revision.Store{DB: db, Table: "revisions"},
+			Resource: "command",
+		}},
+	}
+
+	router := gin.New()
+	group := router.Group(util.BasePath + "/user/:token")
+	for _, route := range archiver.Routes() {
+		group.Handle(route.Verb, route.Path, route.Handler)
+	}
+	return router, db
+}
+
+// send imports the archive and returns the status
+func send(router http.Handler, mode string, archive string) int {
+	req := httptest.NewRequest("POST", util.BasePath+"/user/channel/import?mode="+mode,
+		strings.NewReader(archive))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder.Code
+}
+
+// stored returns the command as it's stored, nil if there isn't one
+func stored(t *testing.T, db rethink.Database, name string) map[string]interface{} {
+	t.Helper()
+	found, err := db.GetSingle(map[string]interface{}{"token": "channel", "name": name}, "commands")
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, _ := found.(map[string]interface{})
+	return record
+}
+
+func TestImportCarriesVersions(t *testing.T) {
+	for _, mode := range []string{Merge, Replace} {
+		router, db := setup(t, "hello")
+		code := send(router, mode, `{"version": 1, "resources": {"commands": [
+			{"name": "hello", "response": "new"},
+			{"name": "bye", "response": "new"}
+		]}}`)
+		if code != http.StatusOK {
+			t.Fatalf("%s: expected the import to go in, got %d", mode, code)
+		}
+
+		hello := stored(t, db, "hello")
+		if hello["response"] != "new" || hello["version"] != 5.0 || hello["id"] != "hello-id" {
+			t.Errorf("%s: expected hello to be the next version of itself, got %v", mode, hello)
+		}
+		if bye := stored(t, db, "bye"); bye["version"] != 1.0 {
+			t.Errorf("%s: expected bye to be new, got %v", mode, bye)
+		}
+	}
+}
+
+func TestImportRecordsHistory(t *testing.T) {
+	router, db := setup(t, "hello", "gone")
+	code := send(router, Replace, `{"version": 1, "resources": {"commands": [
+		{"name": "hello", "response": "new"},
+		{"name": "bye", "response": "new"}
+	]}}`)
+	if code != http.StatusOK {
+		t.Fatalf("expected the import to go in, got %d", code)
+	}
+
+	for name, changed := range map[string]string{"hello": "response", "bye": "response", "gone": "name"} {
+		revisions, err := db.GetByFilter("revisions", revision.Filter("channel", "command", name), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(revisions) != 1 {
+			t.Fatalf("expected one revision of %s, got %v", name, revisions)
+		}
+		rev := revisions[0].(map[string]interface{})
+		changes, _ := rev["changes"].(map[string]interface{})
+		if rev["action"] != revision.Import || changes[changed] == nil {
+			t.Errorf("expected an import revision changing %s's %s, got %v", name, changed, rev)
+		}
+	}
+	if stored(t, db, "gone") != nil {
+		t.Error("expected gone to be replaced")
+	}
+}
+
+func TestRestoreCarriesVersions(t *testing.T) {
+	_, db := setup(t, "hello", "untouched")
+	archiver := &Archiver{DB: db, Kinds: []Kind{{Name: "commands", Table: "commands", Key: []string{"name"}}}}
+
+	backups := map[string][]interface{}{}
+	backups["commands"], _ = db.GetByQuery("commands", rethink.Query{
+		Filter: map[string]interface{}{"token": "channel"}, Deleted: rethink.WithDeleted})
+	// The import got as far as writing hello before failing
+	db.Update("commands", "hello-id", map[string]interface{}{"response": "new", "version": 5})
+	db.Create("commands", map[string]interface{}{"token": "channel", "name": "bye", "version": 1})
+
+	archiver.restore("channel", backups)
+
+	if hello := stored(t, db, "hello"); hello["response"] != "old" || hello["version"] != 6.0 {
+		t.Errorf("expected hello to be put back as a new version, got %v", hello)
+	}
+	if untouched := stored(t, db, "untouched"); untouched["version"] != 4.0 {
+		t.Errorf("expected untouched to keep its version, got %v", untouched)
+	}
+	if bye := stored(t, db, "bye"); bye != nil {
+		t.Errorf("expected bye to be removed, got %v", bye)
+	}
+}
@@ -0,0 +1,100 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CactusDev/Xerophi/rethink"
+	"github.com/CactusDev/Xerophi/util"
+
+	"github.com/gin-gonic/gin"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Trail records every call that changes something, so it can be worked out
+// later who did what
+type Trail struct {
+	DB    rethink.Database // The storage backend the trail is kept in
+	Table string           // The table the trail is kept in
+}
+
+// Mutating returns if requests with the verb change anything
+func Mutating(verb string) bool {
+	switch verb {
+	case "POST", "PATCH", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+// toMillis converts a time into milliseconds since the epoch, which is what
+// entries are ordered by
+func toMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// hashBody returns the SHA-256 of the body, or "" if there isn't one
+func hashBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// resourceID picks the ID of the resource the request was about out of the
+// route, which is the last parameter that isn't the token
+func resourceID(ctx *gin.Context) string {
+	for pos := len(ctx.Params) - 1; pos >= 0; pos-- {
+		if ctx.Params[pos].Key != "token" {
+			return ctx.Params[pos].Value
+		}
+	}
+	return ""
+}
+
+// Middleware records the request once the route's handler has finished with
+// it. The route is the path it was registered under, e.g.
+// /api/v2/user/:token/command/:name
+func (t *Trail) Middleware(route string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var body []byte
+		if ctx.Request.Body != nil {
+			var err error
+			if body, err = ioutil.ReadAll(ctx.Request.Body); err != nil {
+				util.NiceError(ctx, err, http.StatusBadRequest)
+				return
+			}
+			// Put it back for the handler
+			ctx.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+
+		ctx.Next()
+
+		now := time.Now().UTC()
+		entry := map[string]interface{}{
+			"actor":      util.Actor(ctx),
+			"channel":    strings.ToLower(ctx.Param("token")),
+			"route":      route,
+			"verb":       ctx.Request.Method,
+			"resourceId": resourceID(ctx),
+			"bodyHash":   hashBody(body),
+			"status":     ctx.Writer.Status(),
+			"timestamp":  toMillis(now),
+			"createdAt":  now.Format(time.RFC3339),
+		}
+		// The response has already been sent, don't hold up the handler
+		go func() {
+			if _, err := t.DB.Create(t.Table, entry); err != nil {
+				log.Errorf("[%s] - Failed to record %s %s: %s",
+					t.Table, entry["verb"], route, err)
+			}
+		}()
+	}
+}
@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/CactusDev/Xerophi/rethink"
+	"github.com/CactusDev/Xerophi/types"
+	"github.com/CactusDev/Xerophi/util"
+
+	"github.com/gin-gonic/gin"
+
+	mapstruct "github.com/mitchellh/mapstructure"
+	log "github.com/sirupsen/logrus"
+)
+
+// Routes returns the routing information for this endpoint
+func (t *Trail) Routes() []types.RouteDetails {
+	return []types.RouteDetails{
+		types.RouteDetails{
+			Enabled: true, Path: "", Verb: "GET",
+			Handler: t.GetAll,
+		},
+	}
+}
+
+// parseTime parses an RFC3339 query parameter, returning nil if it wasn't given
+func parseTime(ctx *gin.Context, param string) (interface{}, error) {
+	raw := ctx.Query(param)
+	if raw == "" {
+		return nil, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return nil, util.InvalidParameter(param, "%s must be an RFC3339 timestamp", param)
+	}
+	return toMillis(parsed), nil
+}
+
+// GetAll returns the entries in the trail, newest first unless another order
+// is asked for. They can be filtered with filter[channel] and filter[actor]
+// like any other collection, and limited to a time range with from and to
+func (t *Trail) GetAll(ctx *gin.Context) {
+	params, err := util.ParseCollectionParams(ctx, ResponseSchema{})
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusBadRequest)
+		return
+	}
+	if ctx.Query("sort") == "" {
+		params.Sort = []rethink.Sort{{Field: "timestamp", Descending: true}}
+	}
+
+	from, err := parseTime(ctx, "from")
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusBadRequest)
+		return
+	}
+	to, err := parseTime(ctx, "to")
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusBadRequest)
+		return
+	}
+
+	query := params.Query(nil)
+	if from != nil || to != nil {
+		query.Ranges = []rethink.Range{{Field: "timestamp", Min: from, Max: to}}
+	}
+
+	total, err := t.DB.CountByQuery(t.Table, query)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	fromDB, err := t.DB.GetByQuery(t.Table, query)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+
+	var entries = make([]util.JSONAPISchema, 0, len(fromDB))
+	for _, record := range fromDB {
+		var decoded ResponseSchema
+		// If there's an issue decoding it, just log it and move on to the next record
+		if err := mapstruct.Decode(record, &decoded); err != nil {
+			log.Error(err.Error())
+			continue
+		}
+		entries = append(entries, decoded)
+	}
+
+	ctx.Header("x-total-count", fmt.Sprint(total))
+	ctx.JSON(http.StatusOK, params.Document(ctx, entries, fromDB, total))
+}
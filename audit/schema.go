@@ -0,0 +1,32 @@
+package audit
+
+import (
+	"github.com/CactusDev/Xerophi/types"
+	"github.com/CactusDev/Xerophi/util"
+)
+
+// ResponseSchema is the schema for the data that will be sent out to the client
+type ResponseSchema struct {
+	ID         string `jsonapi:"primary,audit"`
+	Actor      string `jsonapi:"attr,actor" filter:"eq"` // As claimed by the client, unverified
+	Channel    string `jsonapi:"attr,channel" filter:"eq"`
+	Route      string `jsonapi:"attr,route" filter:"eq,prefix"`
+	Verb       string `jsonapi:"attr,verb" filter:"eq"`
+	ResourceID string `jsonapi:"attr,resourceId" filter:"eq"`
+	BodyHash   string `jsonapi:"attr,bodyHash"`
+	Status     int    `jsonapi:"attr,status" filter:"eq,gte,lt"`
+	Timestamp  int64  `jsonapi:"attr,timestamp"`
+	CreatedAt  string `jsonapi:"meta,createdAt,time"`
+}
+
+// JSONAPIMeta returns a meta object for the response
+func (rs ResponseSchema) JSONAPIMeta() *types.Meta {
+	return &types.Meta{
+		"createdAt": rs.CreatedAt,
+	}
+}
+
+// GetAPITag allows each of these types to implement the JSONAPISchema interface
+func (rs ResponseSchema) GetAPITag(lookup string) string {
+	return util.FieldTag(rs, lookup, "jsonapi")
+}
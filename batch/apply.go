@@ -0,0 +1,287 @@
+package batch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/CactusDev/Xerophi/resource"
+	"github.com/CactusDev/Xerophi/revision"
+	"github.com/CactusDev/Xerophi/util"
+
+	"github.com/gin-gonic/gin"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// How each operation in a batch turned out
+const (
+	Applied = "applied" // It was made and has stuck
+	Failed  = "failed"  // It was tried and didn't work
+	Undone  = "undone"  // It was made but undone because a later one failed
+	Skipped = "skipped" // It wasn't tried because an earlier one failed
+)
+
+// methods are the verbs each operation is sent as
+var methods = map[string]string{
+	Create: "POST",
+	Update: "PATCH",
+	Delete: "DELETE",
+}
+
+// Result is how a single operation turned out, along with the document the
+// resource's route responded with
+type Result struct {
+	Op       string        `json:"op"`
+	Resource string        `json:"resource"`
+	Key      interface{}   `json:"key,omitempty"`
+	Outcome  string        `json:"outcome"`
+	Status   int           `json:"status,omitempty"`
+	Data     interface{}   `json:"data,omitempty"`
+	Errors   []interface{} `json:"errors,omitempty"`
+}
+
+// change is a record the batch has touched, kept so it can be undone
+type change struct {
+	resource *resource.Resource
+	segment  string
+	id       string
+	before   map[string]interface{} // The record before the batch, nil if the batch created it
+}
+
+// journal keeps everything needed to undo the operations applied so far
+type journal struct {
+	changes []change
+	seen    map[string]struct{}
+}
+
+// keep backs up the record before it's first changed by the batch
+func (j *journal) keep(r *resource.Resource, segment string, filter map[string]interface{}) error {
+	fromDB, err := r.Conn.GetSingle(filter, r.Table)
+	if err != nil {
+		return err
+	}
+	record, ok := fromDB.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	id, _ := record["id"].(string)
+	if _, done := j.seen[segment+"/"+id]; done {
+		return nil
+	}
+	j.seen[segment+"/"+id] = struct{}{}
+	j.changes = append(j.changes, change{resource: r, segment: segment, id: id, before: record})
+	return nil
+}
+
+// created remembers a record the batch created, so it can be removed
+func (j *journal) created(r *resource.Resource, segment string, document map[string]interface{}) {
+	data, _ := document["data"].(map[string]interface{})
+	id, _ := data["id"].(string)
+	if id == "" {
+		return
+	}
+	j.seen[segment+"/"+id] = struct{}{}
+	j.changes = append(j.changes, change{resource: r, segment: segment, id: id})
+}
+
+// path is the route the operation is sent to
+func path(channel string, r *resource.Resource, op Operation) string {
+	base := fmt.Sprintf("%s/user/%s/%s", util.BasePath, url.PathEscape(channel), op.Resource)
+	key := url.PathEscape(routeKey(op.Key))
+	if op.Op == Create {
+		return base + strings.Replace(r.CreatePath, ":"+r.Key.Param, key, 1)
+	}
+	return base + "/" + key
+}
+
+// dispatch sends the operation through the API like it was its own request,
+// so it's handled exactly the same way. Returns the status and the document
+// that was sent back
+func (b *Batch) dispatch(ctx *gin.Context, channel string, r *resource.Resource,
+	op Operation) (int, map[string]interface{}, error) {
+	var body []byte
+	if op.Op != Delete {
+		body = op.Data
+	}
+	req, err := http.NewRequest(methods[op.Op], path(channel, r, op), bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	req = req.WithContext(ctx.Request.Context())
+	req.RemoteAddr = ctx.Request.RemoteAddr
+	req.Header.Set("Content-Type", "application/json")
+	if actor := util.Actor(ctx); actor != "" {
+		req.Header.Set(util.ActorHeader, actor)
+	}
+	if op.IfMatch != "" {
+		req.Header.Set("If-Match", op.IfMatch)
+	}
+
+	recorder := httptest.NewRecorder()
+	b.Handler.ServeHTTP(recorder, req)
+
+	var document map[string]interface{}
+	if recorder.Body.Len() > 0 {
+		if err := json.Unmarshal(recorder.Body.Bytes(), &document); err != nil {
+			return 0, nil, err
+		}
+	}
+	return recorder.Code, document, nil
+}
+
+// pointErrors makes the errors from an operation point into the batch
+// request rather than the operation's own body
+func pointErrors(pos int, document map[string]interface{}) []interface{} {
+	errs, _ := document["errors"].([]interface{})
+	for _, obj := range errs {
+		mapped, _ := obj.(map[string]interface{})
+		source, _ := mapped["source"].(map[string]interface{})
+		if pointer, ok := source["pointer"].(string); ok {
+			source["pointer"] = fmt.Sprintf("/operations/%d/data%s", pos, pointer)
+		}
+	}
+	return errs
+}
+
+// run applies the operations in order, stopping at the first one that fails
+// and undoing everything before it. Returns the results and the position of
+// the operation that failed, or -1 if they were all applied
+func (b *Batch) run(ctx *gin.Context, channel string, ops []Operation) ([]Result, int) {
+	var results = make([]Result, len(ops))
+	var changes = journal{seen: make(map[string]struct{})}
+	var failed = -1
+
+	for pos, op := range ops {
+		r := b.Resources[op.Resource]
+		results[pos] = Result{Op: op.Op, Resource: op.Resource, Key: op.Key, Outcome: Skipped}
+		if failed >= 0 {
+			continue
+		}
+
+		var err error
+		if raw := routeKey(op.Key); raw != "" {
+			key, _ := parseKey(r, raw)
+			err = changes.keep(r, op.Resource, map[string]interface{}{"token": channel, r.Key.Field: key})
+		}
+		var status int
+		var document map[string]interface{}
+		if err == nil {
+			status, document, err = b.dispatch(ctx, channel, r, op)
+		}
+		if err != nil {
+			log.Errorf("[batch] - Operation %d for %s failed: %s", pos, channel, err)
+			obj := util.NewError(util.ErrInternal, err.Error())
+			status, document = http.StatusInternalServerError,
+				map[string]interface{}{"errors": []interface{}{obj}}
+		}
+
+		results[pos].Status = status
+		if status < 200 || status >= 300 {
+			results[pos].Outcome = Failed
+			results[pos].Errors = pointErrors(pos, document)
+			failed = pos
+			continue
+		}
+		results[pos].Outcome = Applied
+		results[pos].Data = document["data"]
+		if op.Op == Create {
+			changes.created(r, op.Resource, document)
+		}
+	}
+
+	if failed >= 0 && b.undo(ctx, channel, changes) {
+		for pos := 0; pos < failed; pos++ {
+			results[pos].Outcome = Undone
+		}
+	}
+	return results, failed
+}
+
+// undo puts every record the batch touched back how it was, newest change
+// first. Returns if everything was put back
+func (b *Batch) undo(ctx *gin.Context, channel string, changes journal) bool {
+	var ok = true
+	for pos := len(changes.changes) - 1; pos >= 0; pos-- {
+		c := changes.changes[pos]
+		if err := b.revert(ctx, channel, c); err != nil {
+			log.Errorf("[%s] - Failed to undo batch change to %s for %s: %s",
+				c.resource.Table, c.id, channel, err)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// revert puts a single record back how it was before the batch, removing it
+// if the batch created it, and records that in its history
+func (b *Batch) revert(ctx *gin.Context, channel string, c change) error {
+	r := c.resource
+	// Read it as it's stored, it may have been soft-deleted or removed by the
+	// batch
+	current, err := r.Conn.GetSingle(map[string]interface{}{"id": c.id}, r.Table)
+	if err != nil {
+		return err
+	}
+	after, _ := current.(map[string]interface{})
+	// It's kept before the operation runs, so the one that failed may not
+	// have changed it
+	if c.before != nil && reflect.DeepEqual(after, c.before) {
+		return nil
+	}
+
+	var restored map[string]interface{}
+	if c.before == nil {
+		if _, err := r.Conn.Delete(r.Table, c.id); err != nil {
+			return err
+		}
+		if r.AfterDelete != nil {
+			r.AfterDelete(c.id)
+		}
+	} else {
+		// Putting it back is a change of its own, so it's a new version and
+		// anything cached from the batch doesn't match it
+		restored = make(map[string]interface{}, len(c.before))
+		for field, value := range c.before {
+			restored[field] = value
+		}
+		version, _ := c.before["version"].(float64)
+		if after != nil {
+			version, _ = after["version"].(float64)
+		}
+		restored["version"] = version + 1
+
+		if _, err := r.Conn.Upsert(r.Table, restored); err != nil {
+			return err
+		}
+		if deletedAt, _ := restored["deletedAt"].(float64); deletedAt != 0 {
+			if r.AfterDelete != nil {
+				r.AfterDelete(c.id)
+			}
+		} else if schema, err := r.Decode(restored); err == nil && r.AfterWrite != nil {
+			r.AfterWrite(schema)
+		}
+	}
+
+	if r.History == nil || after == nil {
+		return nil
+	}
+	keyed := c.before
+	if keyed == nil {
+		keyed = after
+	}
+	return r.History.Record(revision.Entry{
+		Token:    channel,
+		Resource: c.segment,
+		Key:      fmt.Sprint(keyed[r.Key.Field]),
+		Action:   revision.Rollback,
+		Author:   util.Actor(ctx),
+		Before:   after,
+		After:    restored,
+	})
+}
@@ -0,0 +1,247 @@
+package batch
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/CactusDev/Xerophi/resource"
+	"github.com/CactusDev/Xerophi/rethink"
+	"github.com/CactusDev/Xerophi/types"
+	"github.com/CactusDev/Xerophi/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MaxOperations is the most operations a single batch can have
+const MaxOperations = 100
+
+// The operations a batch can contain
+const (
+	Create = "create"
+	Update = "update"
+	Delete = "delete"
+)
+
+// Operation is a single change in a batch, the same as a request to the
+// resource's own route would make
+type Operation struct {
+	Op       string          `json:"op"`       // create, update or delete
+	Resource string          `json:"resource"` // The route segment, e.g. "command"
+	Key      interface{}     `json:"key"`      // What the record's route picks it out by
+	IfMatch  string          `json:"ifMatch"`  // Sent as the If-Match header
+	Data     json.RawMessage `json:"data"`     // The request body for creates and updates
+}
+
+// Request is the body of a batch request, its operations are applied in order
+type Request struct {
+	Operations []Operation `json:"operations"`
+}
+
+// Batch applies a list of changes to a channel's resources in one request.
+// Every operation is checked before any of them are applied, and if one of
+// them fails the ones before it are undone
+type Batch struct {
+	Handler   http.Handler                  // What operations are sent through, the API's router
+	Resources map[string]*resource.Resource // What a batch can change, by route segment
+
+	mutex sync.Mutex // Batches are applied one at a time
+}
+
+// Routes returns the routing information for this endpoint
+func (b *Batch) Routes() []types.RouteDetails {
+	return []types.RouteDetails{
+		types.RouteDetails{
+			Enabled: true, Path: "", Verb: "POST",
+			Handler: b.Apply,
+		},
+	}
+}
+
+// token returns the normalized token from the route
+func token(ctx *gin.Context) string {
+	return strings.ToLower(html.EscapeString(ctx.Param("token")))
+}
+
+// invalid creates the error for an operation, pointing at the part of it
+// that's wrong
+func invalid(pointer string, detail string) util.ErrorObject {
+	obj := util.NewError(util.ErrValidation, detail)
+	obj.Source = &util.ErrorSource{Pointer: pointer}
+	return obj
+}
+
+// routeKey is the key as it appears in the route
+func routeKey(key interface{}) string {
+	if key == nil {
+		return ""
+	}
+	return fmt.Sprint(key)
+}
+
+// parseKey converts the key the same way the resource's route does
+func parseKey(r *resource.Resource, raw string) (interface{}, error) {
+	if r.Key.Parse == nil {
+		return raw, nil
+	}
+	return r.Key.Parse(raw)
+}
+
+// check validates every operation before anything is applied. Whether a
+// record exists is followed through the batch, so deleting a command and
+// creating it again is fine. Every problem is returned rather than just the
+// first
+func (b *Batch) check(channel string, ops []Operation) []util.ErrorObject {
+	var errs []util.ErrorObject
+	var live = make(map[string]bool)
+
+	for pos, op := range ops {
+		pointer := fmt.Sprintf("/operations/%d", pos)
+		r, ok := b.Resources[op.Resource]
+		if !ok {
+			errs = append(errs, invalid(pointer+"/resource", "Unknown resource "+op.Resource))
+			continue
+		}
+
+		var schema string
+		switch op.Op {
+		case Create:
+			schema = r.CreateSchema
+		case Update:
+			schema = r.UpdateSchema
+		case Delete:
+		default:
+			errs = append(errs, invalid(pointer+"/op", "Unknown operation "+op.Op))
+			continue
+		}
+
+		// Creating a record that's keyed by the API, like quotes, doesn't need one
+		raw := routeKey(op.Key)
+		needsKey := op.Op != Create || r.CreatePath != ""
+		if needsKey && raw == "" {
+			errs = append(errs, invalid(pointer+"/key", "key is required"))
+			continue
+		}
+
+		if schema != "" {
+			body := []byte(op.Data)
+			if len(body) == 0 || string(body) == "null" {
+				body = []byte("{}")
+			}
+			attributes, isDocument, err := util.UnmarshalDocument(body)
+			if err == nil {
+				err = util.ValidateInput(attributes, schema)
+			}
+			if validateErr, ok := err.(util.APIError); ok {
+				validateErr.Prefix = pointer + "/data"
+				if isDocument && validateErr.Code != util.ErrInvalidDocument {
+					validateErr.Prefix += "/data/attributes"
+				}
+				errs = append(errs, validateErr.Objects()...)
+				continue
+			} else if err != nil {
+				errs = append(errs, invalid(pointer+"/data", err.Error()))
+				continue
+			}
+		}
+
+		if raw == "" {
+			continue
+		}
+		key, err := parseKey(r, raw)
+		if err != nil {
+			errs = append(errs, invalid(pointer+"/key", "Invalid key "+raw))
+			continue
+		}
+
+		// Work out if the record exists by this point in the batch
+		ref := op.Resource + "/" + fmt.Sprint(key)
+		exists, known := live[ref]
+		if !known {
+			_, _, err := r.ReturnOne(map[string]interface{}{"token": channel, r.Key.Field: key})
+			retRes, ok := err.(rethink.RetrievalResult)
+			if !ok && err != nil {
+				obj := util.NewError(util.ErrInternal, err.Error())
+				obj.Source = &util.ErrorSource{Pointer: pointer}
+				return append(errs, obj)
+			}
+			exists = retRes.Success && !retRes.SoftDeleted
+		}
+
+		switch {
+		case op.Op == Create && exists:
+			obj := util.NewError(util.ErrConflict, r.Name+" already exists")
+			obj.Source = &util.ErrorSource{Pointer: pointer + "/key"}
+			errs = append(errs, obj)
+		case op.Op != Create && !exists:
+			obj := util.NewError(util.ErrNotFound, r.Name+" not found")
+			obj.Source = &util.ErrorSource{Pointer: pointer + "/key"}
+			errs = append(errs, obj)
+		}
+		live[ref] = op.Op != Delete
+	}
+
+	return errs
+}
+
+// Apply checks and then applies every operation in the batch, in order. If
+// any of them fail everything that was already applied is put back and the
+// failing operation's errors are returned. RethinkDB doesn't have
+// transactions, so other requests can see the changes until they're undone
+func (b *Batch) Apply(ctx *gin.Context) {
+	body, err := ioutil.ReadAll(ctx.Request.Body)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusBadRequest)
+		return
+	}
+	var request Request
+	if err := json.Unmarshal(body, &request); err != nil {
+		util.NiceError(ctx, util.APIError{
+			Code: util.ErrInvalidDocument,
+			Data: map[string]interface{}{"": "Invalid batch: " + err.Error()},
+		}, http.StatusBadRequest)
+		return
+	}
+	if len(request.Operations) == 0 {
+		util.AbortWithErrors(ctx, invalid("/operations", "At least one operation is required"))
+		return
+	}
+	if len(request.Operations) > MaxOperations {
+		util.AbortWithErrors(ctx, invalid("/operations",
+			fmt.Sprintf("A batch can have at most %d operations", MaxOperations)))
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	channel := token(ctx)
+	if errs := b.check(channel, request.Operations); len(errs) > 0 {
+		util.AbortWithErrors(ctx, errs...)
+		return
+	}
+
+	results, failed := b.run(ctx, channel, request.Operations)
+	meta := map[string]interface{}{
+		"applied": failed < 0,
+		"total":   len(results),
+		"results": results,
+	}
+	if failed < 0 {
+		ctx.JSON(http.StatusOK, map[string]interface{}{
+			"jsonapi": map[string]interface{}{"version": util.JSONAPIVersion},
+			"meta":    meta,
+		})
+		return
+	}
+
+	ctx.AbortWithStatusJSON(results[failed].Status, map[string]interface{}{
+		"jsonapi": map[string]interface{}{"version": util.JSONAPIVersion},
+		"errors":  results[failed].Errors,
+		"meta":    meta,
+	})
+}
@@ -0,0 +1,183 @@
+package batch
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/CactusDev/Xerophi/command"
+	"github.com/CactusDev/Xerophi/resource"
+	"github.com/CactusDev/Xerophi/rethink/rethinktest"
+	"github.com/CactusDev/Xerophi/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// setup routes commands and batches through a router backed by an in-memory
+// database, with the commands given already stored
+func setup(t *testing.T, names ...string) (http.Handler, *rethinktest.Memory) {
+	db := rethinktest.NewMemory()
+	commands := (&command.Command{Table: "commands"}).Resource()
+	commands.Conn = db
+	// The real schemas reference each other by absolute path
+	commands.CreateSchema = "/testdata/createSchema.json"
+	commands.UpdateSchema = "/testdata/schema.json"
+
+	router := gin.New()
+	group := router.Group(util.BasePath + "/user/:token/command")
+	for _, route := range commands.Routes() {
+		group.Handle(route.Verb, route.Path, route.Handler)
+	}
+	batches := &Batch{Handler: router, Resources: map[string]*resource.Resource{"command": commands}}
+	router.POST(util.BasePath+"/user/:token/batch", batches.Apply)
+
+	for _, name := range names {
+		if _, err := db.Create("commands", map[string]interface{}{
+			"id":        name + "-id",
+			"token":     "channel",
+			"name":      name,
+			"enabled":   true,
+			"count":     0,
+			"arguments": []interface{}{},
+			"response":  map[string]interface{}{"action": false, "message": []interface{}{}},
+			"deletedAt": 0,
+			"version":   1,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return router, db
+}
+
+// apply sends the batch and returns the status and the outcome of each
+// operation
+func apply(t *testing.T, router http.Handler, body string) (int, []string) {
+	req := httptest.NewRequest("POST", util.BasePath+"/user/channel/batch", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	var document struct {
+		Meta struct {
+			Results []Result `json:"results"`
+		} `json:"meta"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &document); err != nil {
+		t.Fatalf("invalid response %s: %s", recorder.Body.String(), err)
+	}
+	var outcomes []string
+	for _, result := range document.Meta.Results {
+		outcomes = append(outcomes, result.Outcome)
+	}
+	return recorder.Code, outcomes
+}
+
+// stored returns the command as it's stored, nil if it doesn't exist
+func stored(t *testing.T, db *rethinktest.Memory, name string) map[string]interface{} {
+	fromDB, err := db.GetSingle(map[string]interface{}{"token": "channel", "name": name}, "commands")
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, _ := fromDB.(map[string]interface{})
+	return record
+}
+
+func TestApply(t *testing.T) {
+	router, db := setup(t, "hello", "bye")
+	status, outcomes := apply(t, router, `{"operations": [
+		{"op": "update", "resource": "command", "key": "hello", "data": {"enabled": false}},
+		{"op": "delete", "resource": "command", "key": "bye"}
+	]}`)
+
+	if status != http.StatusOK {
+		t.Fatalf("expected 200, got %d", status)
+	}
+	if strings.Join(outcomes, ",") != "applied,applied" {
+		t.Errorf("expected both applied, got %v", outcomes)
+	}
+	if enabled, _ := stored(t, db, "hello")["enabled"].(bool); enabled {
+		t.Error("hello wasn't disabled")
+	}
+	if deletedAt, _ := stored(t, db, "bye")["deletedAt"].(float64); deletedAt == 0 {
+		t.Error("bye wasn't deleted")
+	}
+}
+
+func TestApplyRestoresDeleted(t *testing.T) {
+	router, db := setup(t, "hello", "bye")
+	status, outcomes := apply(t, router, `{"operations": [
+		{"op": "delete", "resource": "command", "key": "hello"},
+		{"op": "delete", "resource": "command", "key": "bye", "ifMatch": "\"7\""}
+	]}`)
+
+	if status != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412, got %d", status)
+	}
+	if strings.Join(outcomes, ",") != "undone,failed" {
+		t.Errorf("expected the delete to be undone, got %v", outcomes)
+	}
+	for _, name := range []string{"hello", "bye"} {
+		record := stored(t, db, name)
+		if record == nil {
+			t.Fatalf("%s is gone", name)
+		}
+		if deletedAt, _ := record["deletedAt"].(float64); deletedAt != 0 {
+			t.Errorf("%s is still deleted", name)
+		}
+	}
+	// Deleting hello took it to version 2 and putting it back is another
+	// change, bye was never changed
+	for name, want := range map[string]float64{"hello": 3, "bye": 1} {
+		if version, _ := stored(t, db, name)["version"].(float64); version != want {
+			t.Errorf("%s is at version %v rather than %v", name, version, want)
+		}
+	}
+}
+
+func TestApplyRemovesCreated(t *testing.T) {
+	router, db := setup(t, "bye")
+	status, outcomes := apply(t, router, `{"operations": [
+		{"op": "create", "resource": "command", "key": "hello", "data": {
+			"arguments": [], "response": {"action": false, "message": [
+				{"type": "text", "data": "hi", "text": "hi"}
+			]}
+		}},
+		{"op": "update", "resource": "command", "key": "bye", "ifMatch": "\"7\"", "data": {}}
+	]}`)
+
+	if status != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412, got %d", status)
+	}
+	if strings.Join(outcomes, ",") != "undone,failed" {
+		t.Errorf("expected the create to be undone, got %v", outcomes)
+	}
+	if record := stored(t, db, "hello"); record != nil {
+		t.Errorf("hello wasn't removed: %v", record)
+	}
+}
+
+func TestApplyChecksFirst(t *testing.T) {
+	router, db := setup(t, "hello")
+	status, outcomes := apply(t, router, `{"operations": [
+		{"op": "delete", "resource": "command", "key": "hello"},
+		{"op": "update", "resource": "command", "key": "missing", "data": {}}
+	]}`)
+
+	if status != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", status)
+	}
+	if len(outcomes) != 0 {
+		t.Errorf("expected nothing to be tried, got %v", outcomes)
+	}
+	if deletedAt, _ := stored(t, db, "hello")["deletedAt"].(float64); deletedAt != 0 {
+		t.Error("hello was deleted")
+	}
+}
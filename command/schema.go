@@ -1,7 +1,6 @@
 package command
 
 import (
-	"encoding/json"
 	"time"
 
 	"github.com/CactusDev/Xerophi/schemas"
@@ -13,12 +12,13 @@ import (
 type ResponseSchema struct {
 	ID        string                  `jsonapi:"primary,command"`
 	Arguments []schemas.MessagePacket `jsonapi:"attr,arguments"`
-	Count     int                     `jsonapi:"attr,count"`
-	CreatedAt string                  `jsonapi:"meta,createdAt"`
-	Enabled   bool                    `jsonapi:"attr,enabled"`
-	Name      string                  `jsonapi:"attr,name"`
+	Count     int                     `jsonapi:"attr,count" filter:"eq,gt,gte,lt,lte"`
+	CreatedAt string                  `jsonapi:"meta,createdAt,time" filter:"gt,gte,lt,lte"`
+	Enabled   bool                    `jsonapi:"attr,enabled" filter:"eq"`
+	Name      string                  `jsonapi:"attr,name" filter:"eq,prefix,contains"`
 	Response  EmbeddedResponseSchema  `jsonapi:"attr,response"`
 	Token     string                  `jsonapi:"meta,token"`
+	Version   int                     `jsonapi:"meta,version"`
 }
 
 // ClientSchema is the schema the data from the client will be marshalled into
@@ -65,11 +65,17 @@ type UpdateEmbeddedResponseSchema struct {
 	User    *string                 `json:"user,omitempty" jsonapi:"attr,user"`
 }
 
+// SelfLink returns the URL the command can be retrieved from
+func (rs ResponseSchema) SelfLink() string {
+	return util.ResourceLink(rs.Token, "command", rs.Name)
+}
+
 // JSONAPIMeta returns a meta object for the response
 func (rs ResponseSchema) JSONAPIMeta() *types.Meta {
 	return &types.Meta{
 		"createdAt": rs.CreatedAt,
 		"token":     rs.Token,
+		"version":   rs.Version,
 	}
 }
 
@@ -87,71 +93,3 @@ func (r EmbeddedResponseSchema) GetAPITag(lookup string) string {
 func (r UpdateEmbeddedResponseSchema) GetAPITag(lookup string) string {
 	return util.FieldTag(r, lookup, "jsonapi")
 }
-
-// DumpBody dumps the body data bytes into this specific schema and returns
-// the bytes from this
-func (cs CreationSchema) DumpBody(data []byte) ([]byte, error) {
-	// Unmarshal the byte slice into the provided schema
-	if err := json.Unmarshal(data, &cs); err != nil {
-		return nil, err
-	}
-
-	// Marshal the unmarshalled byte slice back into a byte array
-	schemaBytes, err := json.Marshal(cs)
-	if err != nil {
-		return nil, err
-	}
-
-	return schemaBytes, nil
-}
-
-// DumpBody dumps the body data bytes into this specific schema and returns
-// the bytes from this
-func (rs ResponseSchema) DumpBody(data []byte) ([]byte, error) {
-	// Unmarshal the byte slice into the provided schema
-	if err := json.Unmarshal(data, &rs); err != nil {
-		return nil, err
-	}
-
-	// Marshal the unmarshalled byte slice back into a byte array
-	schemaBytes, err := json.Marshal(rs)
-	if err != nil {
-		return nil, err
-	}
-
-	return schemaBytes, nil
-}
-
-// DumpBody dumps the body data bytes into this specific schema and returns
-// the bytes from this
-func (cs ClientSchema) DumpBody(data []byte) ([]byte, error) {
-	// Unmarshal the byte slice into the provided schema
-	if err := json.Unmarshal(data, &cs); err != nil {
-		return nil, err
-	}
-
-	// Marshal the unmarshalled byte slice back into a byte array
-	schemaBytes, err := json.Marshal(cs)
-	if err != nil {
-		return nil, err
-	}
-
-	return schemaBytes, nil
-}
-
-// DumpBody dumps the body data bytes into this specific schema and returns
-// the bytes from this
-func (us UpdateSchema) DumpBody(data []byte) ([]byte, error) {
-	// Unmarshal the byte slice into the provided schema
-	if err := json.Unmarshal(data, &us); err != nil {
-		return nil, err
-	}
-
-	// Marshal the unmarshalled byte slice back into a byte array
-	schemaBytes, err := json.Marshal(us)
-	if err != nil {
-		return nil, err
-	}
-
-	return schemaBytes, nil
-}
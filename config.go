@@ -5,15 +5,22 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"time"
 
 	"github.com/CactusDev/Xerophi/rethink"
 )
 
 // Config keeps track of the config set in config.json
 type Config struct {
-	Rethink rethinkCfg `json:"rethink"`
-	Sentry  sentryCfg  `json:"sentry"`
-	Server  serverCfg  `json:"server"`
+	Rethink     rethinkCfg     `json:"rethink"`
+	Sentry      sentryCfg      `json:"sentry"`
+	Server      serverCfg      `json:"server"`
+	EventLog    eventLogCfg    `json:"eventlog"`
+	Analytics   analyticsCfg   `json:"analytics"`
+	Purge       purgeCfg       `json:"purge"`
+	Admin       adminCfg       `json:"admin"`
+	Idempotency idempotencyCfg `json:"idempotency"`
+	Stream      streamCfg      `json:"stream"`
 }
 
 type rethinkCfg struct {
@@ -30,6 +37,83 @@ type serverCfg struct {
 	Port int
 }
 
+type eventLogCfg struct {
+	Retention     string `json:"retention"`     // How long entries are kept, e.g. "2160h"
+	PruneInterval string `json:"pruneInterval"` // How often old entries are removed
+}
+
+type analyticsCfg struct {
+	RollupInterval string `json:"rollupInterval"` // How often command usage is rolled up
+	Backfill       string `json:"backfill"`       // How far back to roll up on startup
+}
+
+type adminCfg struct {
+	Key string `json:"key"` // Sent in the X-Admin-Key header, admin endpoints are off if it's empty
+}
+
+type purgeCfg struct {
+	Retention string `json:"retention"` // How long soft-deleted records are kept, e.g. "720h"
+	Interval  string `json:"interval"`  // How often they're purged
+}
+
+// durations parses a pair of durations from the config, falling back to the
+// default for either one that isn't set
+func durations(first string, firstDefault time.Duration,
+	second string, secondDefault time.Duration) (time.Duration, time.Duration, error) {
+	var parsed = []time.Duration{firstDefault, secondDefault}
+	for pos, raw := range []string{first, second} {
+		if raw == "" {
+			continue
+		}
+		var err error
+		if parsed[pos], err = time.ParseDuration(raw); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return parsed[0], parsed[1], nil
+}
+
+// Durations parses the retention and purge interval, falling back to keeping
+// soft-deleted records for 30 days and purging daily if they're not set
+func (p purgeCfg) Durations() (time.Duration, time.Duration, error) {
+	return durations(p.Retention, 30*24*time.Hour, p.Interval, 24*time.Hour)
+}
+
+type idempotencyCfg struct {
+	TTL           string `json:"ttl"`           // How long responses are kept for retries, e.g. "24h"
+	PruneInterval string `json:"pruneInterval"` // How often expired responses are removed
+}
+
+type streamCfg struct {
+	Retention     string `json:"retention"`     // How long events are kept for clients to catch up, e.g. "24h"
+	PruneInterval string `json:"pruneInterval"` // How often old events are removed
+}
+
+// Durations parses the retention and prune interval, falling back to keeping
+// events for a day and pruning hourly if they're not set
+func (s streamCfg) Durations() (time.Duration, time.Duration, error) {
+	return durations(s.Retention, 24*time.Hour, s.PruneInterval, time.Hour)
+}
+
+// Durations parses the TTL and prune interval, falling back to keeping
+// responses for a day and pruning hourly if they're not set
+func (i idempotencyCfg) Durations() (time.Duration, time.Duration, error) {
+	return durations(i.TTL, 24*time.Hour, i.PruneInterval, time.Hour)
+}
+
+// Durations parses the rollup interval and backfill, falling back to rolling
+// up every 5 minutes and backfilling a week if they're not set
+func (a analyticsCfg) Durations() (time.Duration, time.Duration, error) {
+	return durations(a.RollupInterval, 5*time.Minute, a.Backfill, 7*24*time.Hour)
+}
+
+// Durations parses the retention and prune interval, falling back to keeping
+// entries for 90 days and pruning hourly if they're not set
+func (e eventLogCfg) Durations() (time.Duration, time.Duration, error) {
+	return durations(e.Retention, 90*24*time.Hour, e.PruneInterval, time.Hour)
+}
+
 // LoadConfig tries to load the config from the default path "./config.json"
 // By default the config for Sepal will be in the same directory as
 // the executable
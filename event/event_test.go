@@ -0,0 +1,38 @@
+package event
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/CactusDev/Xerophi/rethink/rethinktest"
+	"github.com/CactusDev/Xerophi/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+func TestUnknownEvents(t *testing.T) {
+	events := &Event{Conn: rethinktest.NewMemory(), Table: "events"}
+
+	router := gin.New()
+	group := router.Group(util.BasePath + "/user/:token/event")
+	for _, route := range events.Routes() {
+		group.Handle(route.Verb, route.Path, route.Handler)
+	}
+
+	for _, verb := range []string{"GET", "POST", "PATCH", "DELETE"} {
+		req := httptest.NewRequest(verb, util.BasePath+"/user/channel/event/nope", strings.NewReader("{}"))
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		if recorder.Code != http.StatusNotFound {
+			t.Errorf("%s: expected an unknown event to be a 404, got %d", verb, recorder.Code)
+		}
+	}
+}
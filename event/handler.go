@@ -0,0 +1,177 @@
+package event
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CactusDev/Xerophi/archive"
+	"github.com/CactusDev/Xerophi/resource"
+	"github.com/CactusDev/Xerophi/rethink"
+	"github.com/CactusDev/Xerophi/schemas"
+	"github.com/CactusDev/Xerophi/types"
+	"github.com/CactusDev/Xerophi/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Events are all the stream events that can have a message, along with the
+// variables the bot has to provide when rendering them
+var Events = map[string][]string{
+	"follow":    {"user"},
+	"subscribe": {"user", "months"},
+	"host":      {"user", "viewers"},
+	"raid":      {"user", "viewers"},
+}
+
+// Event is the struct that implements the handler interface for the event resource
+type Event struct {
+	Conn  rethink.Database // The storage backend
+	Table string           // The database table we're using
+}
+
+// Resource returns the generic handler for event messages, which are keyed by
+// the event they're sent for
+func (e *Event) Resource() *resource.Resource {
+	return &resource.Resource{
+		Conn:   e.Conn,
+		Table:  e.Table,
+		Name:   "Event message",
+		Plural: "event messages",
+		Key: resource.Key{
+			Param: "event", Field: "event", Parse: parseEvent,
+		},
+		Schema:       ResponseSchema{},
+		CreateSchema: "/event/createSchema.json",
+		UpdateSchema: "/event/schema.json",
+		UpdateBody:   UpdateSchema{},
+		CreatePath:   "/:event",
+		Hooks: resource.Hooks{
+			Defaults: e.defaults,
+		},
+	}
+}
+
+// Routes returns the routing information for this endpoint
+func (e *Event) Routes() []types.RouteDetails {
+	return append(e.Resource().Routes(), types.RouteDetails{
+		Enabled: true, Path: "/:event/render", Verb: "POST", ReadOnly: true,
+		Handler: e.Render,
+	})
+}
+
+// Archive describes how event messages are exported and imported
+func (e *Event) Archive() archive.Kind {
+	return archive.Kind{
+		Name:     "events",
+		Table:    e.Table,
+		Key:      []string{"event"},
+		Parse:    map[string]func(string) (interface{}, error){"event": parseEvent},
+		Schema:   "/event/createSchema.json",
+		Client:   ClientSchema{},
+		Defaults: map[string]interface{}{"enabled": true},
+	}
+}
+
+// parseEvent normalizes an event's name, erroring if it isn't one we know
+// about
+func parseEvent(raw string) (interface{}, error) {
+	name := strings.ToLower(html.EscapeString(raw))
+	if _, ok := Events[name]; !ok {
+		return nil, resource.UnknownKey("Unknown event type " + raw)
+	}
+	return name, nil
+}
+
+// defaults are the values a new event message starts with, it's for the
+// event in the route
+func (e *Event) defaults(ctx *gin.Context, token string) (interface{}, interface{}, error) {
+	name, err := parseEvent(ctx.Param("event"))
+	if err != nil {
+		return nil, nil, err
+	}
+	createVals := CreationSchema{
+		CreatedAt: time.Now().UTC(),
+		DeletedAt: 0,
+		Token:     token,
+		Event:     name.(string),
+		Enabled:   true,
+	}
+	return createVals, createVals.Event, nil
+}
+
+// Render fills the event's message in with the variables given so the bot
+// can send it straight to chat
+func (e *Event) Render(ctx *gin.Context) {
+	token := strings.ToLower(html.EscapeString(ctx.Param("token")))
+	parsed, err := parseEvent(ctx.Param("event"))
+	if err != nil {
+		util.Abort(ctx, util.ErrNotFound, err.Error())
+		return
+	}
+	name := parsed.(string)
+
+	var renderVals RenderSchema
+	renderData, err := util.ValidateAndMap(
+		ctx.Request.Body, "/event/renderSchema.json", util.Body(renderVals))
+
+	if validateErr, ok := err.(util.APIError); !ok && err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	} else if ok {
+		// It's a validation error
+		util.NiceError(ctx, validateErr, http.StatusBadRequest)
+		return
+	}
+
+	// Everything gets rendered as a string, and numbers shouldn't end up in
+	// scientific notation
+	var vars = make(map[string]string)
+	for key, value := range renderData["variables"].(map[string]interface{}) {
+		switch val := value.(type) {
+		case float64:
+			vars[key] = strconv.FormatFloat(val, 'f', -1, 64)
+		default:
+			vars[key] = fmt.Sprint(val)
+		}
+	}
+
+	// Make sure everything this event needs was provided
+	var missing = util.APIError{Data: make(map[string]interface{})}
+	for _, required := range Events[name] {
+		if _, ok := vars[required]; !ok {
+			missing.Data["variables."+required] = fmt.Sprintf(
+				"%s is required for %s events", required, name)
+		}
+	}
+	if len(missing.Data) > 0 {
+		util.NiceError(ctx, missing, http.StatusBadRequest)
+		return
+	}
+
+	filter := map[string]interface{}{"token": token, "event": name}
+	found, _, err := e.Resource().ReturnOne(filter)
+	retRes, ok := err.(rethink.RetrievalResult)
+	if !ok && err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	res, isEvent := found.(ResponseSchema)
+	if !retRes.Success || retRes.SoftDeleted || !isEvent {
+		util.Abort(ctx, util.ErrNotFound, "Event message not found")
+		return
+	}
+
+	ctx.Header("x-total-count", "1")
+	ctx.JSON(http.StatusOK, util.MarshalResponse(RenderResponseSchema{
+		ID:      res.ID,
+		Enabled: res.Enabled,
+		Event:   name,
+		Message: schemas.RenderAll(res.Message, vars),
+		Source:  res,
+		Token:   token,
+	}))
+}
@@ -0,0 +1,83 @@
+package event
+
+import (
+	"time"
+
+	"github.com/CactusDev/Xerophi/schemas"
+	"github.com/CactusDev/Xerophi/types"
+	"github.com/CactusDev/Xerophi/util"
+)
+
+// ResponseSchema is the schema for the data that will be sent out to the client
+type ResponseSchema struct {
+	ID        string                  `jsonapi:"primary,event"`
+	CreatedAt string                  `jsonapi:"meta,createdAt,time"`
+	Enabled   bool                    `jsonapi:"attr,enabled" filter:"eq"`
+	Event     string                  `jsonapi:"attr,event" filter:"eq"`
+	Message   []schemas.MessagePacket `jsonapi:"attr,message"`
+	Token     string                  `jsonapi:"meta,token"`
+	Version   int                     `jsonapi:"meta,version"`
+}
+
+// RenderResponseSchema is the schema for an event's message with all the
+// variables filled in
+type RenderResponseSchema struct {
+	ID      string                  `jsonapi:"primary,eventRender"`
+	Enabled bool                    `jsonapi:"attr,enabled"`
+	Event   string                  `jsonapi:"attr,event"`
+	Message []schemas.MessagePacket `jsonapi:"attr,message"`
+	Source  ResponseSchema          `jsonapi:"relation,source"` // The message before it was rendered
+	Token   string                  `jsonapi:"meta,token"`
+}
+
+// ClientSchema is the schema the data from the client will be marshalled into
+type ClientSchema struct {
+	Enabled *bool                   `json:"enabled"`
+	Message []schemas.MessagePacket `json:"message"`
+}
+
+// CreationSchema is all the data required for a new event to be created
+type CreationSchema struct {
+	ClientSchema
+	// Ignore these fields in user input, they will be filled automatically by the API
+	CreatedAt time.Time `json:"createdAt"`
+	DeletedAt float64   `json:"deletedAt"`
+	Token     string    `json:"token"`
+	Event     string    `json:"event"`
+	Enabled   bool      `json:"enabled"`
+}
+
+// UpdateSchema is ClientSchema that is used when updating
+type UpdateSchema struct {
+	Enabled *bool                   `json:"enabled,omitempty"`
+	Message []schemas.MessagePacket `json:"message,omitempty"`
+}
+
+// RenderSchema is the event-specific variables to fill the message in with
+type RenderSchema struct {
+	Variables map[string]interface{} `json:"variables"`
+}
+
+// SelfLink returns the URL the event message can be retrieved from
+func (rs ResponseSchema) SelfLink() string {
+	return util.ResourceLink(rs.Token, "event", rs.Event)
+}
+
+// JSONAPIMeta returns a meta object for the response
+func (rs ResponseSchema) JSONAPIMeta() *types.Meta {
+	return &types.Meta{
+		"createdAt": rs.CreatedAt,
+		"token":     rs.Token,
+		"version":   rs.Version,
+	}
+}
+
+// GetAPITag allows each of these types to implement the JSONAPISchema interface
+func (rs ResponseSchema) GetAPITag(lookup string) string {
+	return util.FieldTag(rs, lookup, "jsonapi")
+}
+
+// GetAPITag allows each of these types to implement the JSONAPISchema interface
+func (rr RenderResponseSchema) GetAPITag(lookup string) string {
+	return util.FieldTag(rr, lookup, "jsonapi")
+}
@@ -0,0 +1,55 @@
+package eventlog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/CactusDev/Xerophi/rethink/rethinktest"
+	"github.com/CactusDev/Xerophi/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	// Schemas are found relative to the root of the repo
+	if err := os.Chdir(".."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func TestIngestKeepsOwnedFields(t *testing.T) {
+	db := rethinktest.NewMemory()
+	entries := &Log{DB: db, Table: "eventlog"}
+	router := gin.New()
+	router.POST(util.BasePath+"/user/:token/eventlog", entries.Ingest)
+
+	if _, err := db.Create("eventlog", map[string]interface{}{
+		"id": "taken", "token": "other", "event": "follow", "deletedAt": 0}); err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"event": "follow", "user": "viewer", "id": "taken", "token": "other", "deletedAt": 5}`
+	req := httptest.NewRequest("POST", util.BasePath+"/user/channel/eventlog", strings.NewReader(body))
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("expected the entry to be logged, got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	logged, err := db.GetByFilter("eventlog", map[string]interface{}{"token": "channel"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logged) != 1 {
+		t.Fatalf("expected the entry to be logged to the channel, got %v", logged)
+	}
+	entry := logged[0].(map[string]interface{})
+	if entry["id"] == "taken" || entry["deletedAt"] != float64(0) {
+		t.Errorf("expected the body not to set the ID or hide the entry, got %v", entry)
+	}
+}
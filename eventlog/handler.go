@@ -0,0 +1,238 @@
+package eventlog
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CactusDev/Xerophi/rethink"
+	"github.com/CactusDev/Xerophi/types"
+	"github.com/CactusDev/Xerophi/util"
+
+	"github.com/Google/uuid"
+	"github.com/gin-gonic/gin"
+
+	mapstruct "github.com/mitchellh/mapstructure"
+	log "github.com/sirupsen/logrus"
+)
+
+// Default and maximum number of entries returned in a single page
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+// Log is an append-only log of stream events and chat activity
+type Log struct {
+	DB    rethink.Database // The storage backend the log is kept in
+	Table string           // The table the log is kept in
+}
+
+// Routes returns the routing information for this endpoint
+func (l *Log) Routes() []types.RouteDetails {
+	return []types.RouteDetails{
+		types.RouteDetails{
+			Enabled: true, Path: "", Verb: "GET",
+			Handler: l.GetRange,
+		},
+		types.RouteDetails{
+			Enabled: true, Path: "", Verb: "POST",
+			Handler: l.Ingest,
+		},
+	}
+}
+
+// toMillis converts a time into milliseconds since the epoch, which is what
+// entries are ordered by
+func toMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// encodeCursor turns the position of the last entry on a page into an opaque
+// cursor the client can hand back to get the next page
+func encodeCursor(pos rethink.Position) string {
+	raw := fmt.Sprintf("%v:%s", pos.Values[0], pos.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor turns a cursor from the client back into a position
+func decodeCursor(cursor string) (*rethink.Position, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, util.InvalidParameter("cursor", "Invalid cursor")
+	}
+	split := strings.SplitN(string(raw), ":", 2)
+	if len(split) != 2 {
+		return nil, util.InvalidParameter("cursor", "Invalid cursor")
+	}
+	timestamp, err := strconv.ParseInt(split[0], 10, 64)
+	if err != nil {
+		return nil, util.InvalidParameter("cursor", "Invalid cursor")
+	}
+
+	return &rethink.Position{Values: []interface{}{timestamp}, ID: split[1]}, nil
+}
+
+// parseTime parses an RFC3339 query parameter, returning nil if it wasn't given
+func parseTime(ctx *gin.Context, param string) (interface{}, error) {
+	raw := ctx.Query(param)
+	if raw == "" {
+		return nil, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return nil, util.InvalidParameter(param, "%s must be an RFC3339 timestamp", param)
+	}
+	return toMillis(parsed), nil
+}
+
+// buildQuery turns the request's query parameters into a storage query
+func buildQuery(ctx *gin.Context, token string) (rethink.Query, error) {
+	query := rethink.Query{
+		Filter: map[string]interface{}{"token": token},
+		Sort: []rethink.Sort{{
+			Field:      "timestamp",
+			Descending: ctx.DefaultQuery("order", "desc") != "asc",
+		}},
+		Limit: defaultLimit,
+	}
+
+	from, err := parseTime(ctx, "from")
+	if err != nil {
+		return query, err
+	}
+	to, err := parseTime(ctx, "to")
+	if err != nil {
+		return query, err
+	}
+	if from != nil || to != nil {
+		query.Ranges = []rethink.Range{{Field: "timestamp", Min: from, Max: to}}
+	}
+
+	if events := ctx.Query("event"); events != "" {
+		var values []interface{}
+		for _, event := range strings.Split(events, ",") {
+			values = append(values, strings.TrimSpace(event))
+		}
+		query.In = map[string][]interface{}{"event": values}
+	}
+
+	if raw := ctx.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxLimit {
+			return query, util.InvalidParameter("limit", "limit must be between 1 and %d", maxLimit)
+		}
+		query.Limit = limit
+	}
+
+	if cursor := ctx.Query("cursor"); cursor != "" {
+		query.After, err = decodeCursor(cursor)
+		if err != nil {
+			return query, err
+		}
+	}
+
+	return query, nil
+}
+
+// GetRange returns a page of entries within the time range requested, newest
+// first unless order=asc is given. If there might be more entries the response
+// will have a next link with the cursor for the next page
+func (l *Log) GetRange(ctx *gin.Context) {
+	token := strings.ToLower(html.EscapeString(ctx.Param("token")))
+
+	query, err := buildQuery(ctx, token)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusBadRequest)
+		return
+	}
+
+	fromDB, err := l.DB.GetByQuery(l.Table, query)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+
+	var records = make([]util.JSONAPISchema, 0, len(fromDB))
+	for _, record := range fromDB {
+		var respDecode ResponseSchema
+		// If there's an issue decoding it, just log it and move on to the next record
+		if err := mapstruct.Decode(record, &respDecode); err != nil {
+			log.Error(err.Error())
+			continue
+		}
+		records = append(records, respDecode)
+	}
+	response := util.MarshalCollection(records)
+	links := map[string]string{"self": ctx.Request.URL.RequestURI()}
+	response["links"] = links
+
+	// A full page means there could be more, point them at the next one
+	if len(fromDB) == query.Limit {
+		last := fromDB[len(fromDB)-1].(map[string]interface{})
+		next := *ctx.Request.URL
+		params := next.Query()
+		params.Set("cursor", encodeCursor(rethink.Position{
+			Values: []interface{}{int64(last["timestamp"].(float64))},
+			ID:     last["id"].(string),
+		}))
+		next.RawQuery = params.Encode()
+		links["next"] = next.RequestURI()
+	}
+
+	ctx.Header("x-total-count", fmt.Sprint(len(records)))
+	ctx.JSON(http.StatusOK, response)
+}
+
+// Ingest appends a new entry to the log
+func (l *Log) Ingest(ctx *gin.Context) {
+	now := time.Now().UTC()
+	createVals := CreationSchema{
+		ClientSchema: ClientSchema{
+			Data:      make(map[string]interface{}),
+			Timestamp: toMillis(now),
+		},
+		// Generate the ID here so we don't have to look the entry up again
+		ID:        uuid.New().String(),
+		CreatedAt: now,
+		DeletedAt: 0,
+		Token:     strings.ToLower(html.EscapeString(ctx.Param("token"))),
+	}
+
+	createData, err := util.ValidateAndMap(
+		ctx.Request.Body, "/eventlog/createSchema.json", util.Body(createVals))
+
+	if validateErr, ok := err.(util.APIError); !ok && err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	} else if ok {
+		// It's a validation error
+		util.NiceError(ctx, validateErr, http.StatusBadRequest)
+		return
+	}
+	// Entries can't be logged to another channel, collide with another entry
+	// or be hidden
+	err = util.KeepDefaults(createData, createVals, "id", "token", "createdAt", "deletedAt")
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := l.DB.Create(l.Table, createData); err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+
+	var response ResponseSchema
+	if err = mapstruct.Decode(createData, &response); err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Header("x-total-count", "1")
+	ctx.JSON(http.StatusCreated, util.MarshalResponse(response))
+}
@@ -0,0 +1,45 @@
+package eventlog
+
+import (
+	"time"
+
+	"github.com/CactusDev/Xerophi/rethink"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Pruner periodically removes entries that are older than the retention period
+type Pruner struct {
+	DB        rethink.Database // The storage backend the log is kept in
+	Table     string           // The table the log is kept in
+	Retention time.Duration    // How long entries are kept for
+	Interval  time.Duration    // How often old entries are removed
+}
+
+// Prune removes every entry older than the retention period and returns how
+// many were removed
+func (p *Pruner) Prune() (int, error) {
+	cutoff := time.Now().UTC().Add(-p.Retention)
+	return p.DB.DeleteByQuery(p.Table, rethink.Query{
+		Ranges: []rethink.Range{
+			{Field: "timestamp", Max: toMillis(cutoff)},
+		},
+	})
+}
+
+// Start prunes the log in the background every interval
+func (p *Pruner) Start() {
+	go func() {
+		for {
+			removed, err := p.Prune()
+			if err != nil {
+				log.Error(err.Error())
+			} else if removed > 0 {
+				log.Infof("[%s] - Pruned %d entries older than %s",
+					p.Table, removed, p.Retention)
+			}
+
+			time.Sleep(p.Interval)
+		}
+	}()
+}
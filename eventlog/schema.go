@@ -0,0 +1,50 @@
+package eventlog
+
+import (
+	"time"
+
+	"github.com/CactusDev/Xerophi/types"
+	"github.com/CactusDev/Xerophi/util"
+)
+
+// ResponseSchema is the schema for the data that will be sent out to the client
+type ResponseSchema struct {
+	ID        string                 `jsonapi:"primary,eventlog"`
+	CreatedAt string                 `jsonapi:"meta,createdAt,time"`
+	Data      map[string]interface{} `jsonapi:"attr,data"`
+	Event     string                 `jsonapi:"attr,event"`
+	Timestamp int64                  `jsonapi:"attr,timestamp"`
+	User      string                 `jsonapi:"attr,user"`
+	Token     string                 `jsonapi:"meta,token"`
+}
+
+// ClientSchema is the schema the data from the client will be marshalled into
+type ClientSchema struct {
+	Data      map[string]interface{} `json:"data"`
+	Event     string                 `json:"event"`
+	Timestamp int64                  `json:"timestamp"`
+	User      string                 `json:"user"`
+}
+
+// CreationSchema is all the data required for a new entry to be logged
+type CreationSchema struct {
+	ClientSchema
+	// Ignore these fields in user input, they will be filled automatically by the API
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	DeletedAt float64   `json:"deletedAt"`
+	Token     string    `json:"token"`
+}
+
+// JSONAPIMeta returns a meta object for the response
+func (rs ResponseSchema) JSONAPIMeta() *types.Meta {
+	return &types.Meta{
+		"createdAt": rs.CreatedAt,
+		"token":     rs.Token,
+	}
+}
+
+// GetAPITag allows each of these types to implement the JSONAPISchema interface
+func (rs ResponseSchema) GetAPITag(lookup string) string {
+	return util.FieldTag(rs, lookup, "jsonapi")
+}
@@ -0,0 +1,267 @@
+package filter
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CactusDev/Xerophi/archive"
+	"github.com/CactusDev/Xerophi/rethink"
+	"github.com/CactusDev/Xerophi/stream"
+	"github.com/CactusDev/Xerophi/trust"
+	"github.com/CactusDev/Xerophi/types"
+	"github.com/CactusDev/Xerophi/util"
+
+	"github.com/gin-gonic/gin"
+
+	mapstruct "github.com/mitchellh/mapstructure"
+)
+
+// Filter handles a channel's chat filters and checking messages against them
+type Filter struct {
+	Conn  *rethink.Connection // The RethinkDB connection
+	Table string              // The database table we're using
+	Trust *trust.Trust        // Used to look up if a viewer is exempt
+}
+
+// Routes returns the routing information for this endpoint
+func (f *Filter) Routes() []types.RouteDetails {
+	return []types.RouteDetails{
+		types.RouteDetails{
+			Enabled: true, Path: "", Verb: "GET",
+			Handler: f.GetConfig,
+		},
+		types.RouteDetails{
+			Enabled: true, Path: "", Verb: "PATCH",
+			Handler: f.UpdateConfig,
+		},
+		types.RouteDetails{
+			Enabled: true, Path: "/check", Verb: "POST", ReadOnly: true,
+			Handler: f.Check,
+		},
+	}
+}
+
+// Archive describes how the filter config is exported and imported, a
+// channel only has the one
+func (f *Filter) Archive() archive.Kind {
+	return archive.Kind{
+		Name:   "filters",
+		Table:  f.Table,
+		Schema: "/filter/schema.json",
+		Client: Config{},
+	}
+}
+
+// Topic describes how changes to the filters are sent down the change stream
+func (f *Filter) Topic() stream.Topic {
+	return stream.Topic{
+		Name:  "filter",
+		Table: f.Table,
+		Render: func(record map[string]interface{}) (interface{}, error) {
+			var config Config
+			if err := mapstruct.Decode(record, &config); err != nil {
+				return nil, err
+			}
+			id, _ := record["id"].(string)
+			token, _ := record["token"].(string)
+			resource, _ := util.MarshalResource(configResponse(config, id, token))
+			return resource, nil
+		},
+	}
+}
+
+// configResponse is the filters as they're sent out
+func configResponse(config Config, id string, token string) ResponseSchema {
+	return ResponseSchema{
+		ID:      id,
+		Caps:    config.Caps,
+		Emotes:  config.Emotes,
+		Exempt:  config.Exempt,
+		Links:   config.Links,
+		Phrases: config.Phrases,
+		Token:   token,
+	}
+}
+
+// ReturnConfig retrieves the filters for the channel given, along with the ID
+// of the stored record. Channels without any get the default filters and an
+// empty ID
+func (f *Filter) ReturnConfig(token string) (Config, string, error) {
+	filter := map[string]interface{}{"token": token}
+	fromDB, err := f.Conn.GetByFilter(f.Table, filter, 1)
+	if err != nil {
+		return DefaultConfig, "", err
+	}
+	if len(fromDB) == 0 {
+		return DefaultConfig, "", nil
+	}
+
+	var config Config
+	if err = mapstruct.Decode(fromDB[0], &config); err != nil {
+		return DefaultConfig, "", err
+	}
+
+	id, _ := fromDB[0].(map[string]interface{})["id"].(string)
+	return config, id, nil
+}
+
+// validatePhrases makes sure all the regex phrases will actually compile
+func validatePhrases(raw interface{}) error {
+	var phrases []Phrase
+	if err := mapstruct.Decode(raw, &phrases); err != nil {
+		return err
+	}
+
+	var errors = util.APIError{Data: make(map[string]interface{})}
+	for pos, phrase := range phrases {
+		if _, err := compilePhrase(phrase); err != nil {
+			errors.Data[fmt.Sprintf("phrases.%d.phrase", pos)] = err.Error()
+		}
+	}
+	if len(errors.Data) > 0 {
+		return errors
+	}
+
+	return nil
+}
+
+// GetConfig returns all of the channel's filters
+func (f *Filter) GetConfig(ctx *gin.Context) {
+	token := strings.ToLower(html.EscapeString(ctx.Param("token")))
+
+	config, id, err := f.ReturnConfig(token)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	if id == "" {
+		// Default filters aren't stored anywhere, just use the token
+		id = token
+	}
+
+	ctx.Header("x-total-count", "1")
+	ctx.JSON(http.StatusOK, util.MarshalResponse(configResponse(config, id, token)))
+}
+
+// UpdateConfig updates the channel's filters, creating them from the defaults
+// if the channel doesn't have any yet
+func (f *Filter) UpdateConfig(ctx *gin.Context) {
+	token := strings.ToLower(html.EscapeString(ctx.Param("token")))
+
+	_, id, err := f.ReturnConfig(token)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+
+	var configData map[string]interface{}
+	if id == "" {
+		createVals := CreationSchema{
+			Config:    DefaultConfig,
+			CreatedAt: time.Now().UTC(),
+			DeletedAt: 0,
+			Token:     token,
+		}
+		configData, err = util.ValidateAndMap(
+			ctx.Request.Body, "/filter/schema.json", util.Body(createVals))
+	} else {
+		var updateVals UpdateSchema
+		configData, err = util.ValidateAndMap(
+			ctx.Request.Body, "/filter/schema.json", util.Body(updateVals))
+	}
+
+	if validateErr, ok := err.(util.APIError); !ok && err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	} else if ok {
+		// It's a validation error
+		util.NiceError(ctx, validateErr, http.StatusBadRequest)
+		return
+	}
+
+	// The JSON schema can't tell if a regex is valid, so check that here
+	if phrases, ok := configData["phrases"]; ok {
+		err = validatePhrases(phrases)
+		if validateErr, ok := err.(util.APIError); !ok && err != nil {
+			util.NiceError(ctx, err, http.StatusInternalServerError)
+			return
+		} else if ok {
+			util.NiceError(ctx, validateErr, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if id == "" {
+		_, err = f.Conn.Create(f.Table, configData)
+	} else {
+		_, err = f.Conn.Update(f.Table, id, configData)
+	}
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+
+	f.GetConfig(ctx)
+}
+
+// Check runs a chat message through the channel's filters and returns every
+// rule it broke, so that every bot instance agrees on what gets filtered
+func (f *Filter) Check(ctx *gin.Context) {
+	token := strings.ToLower(html.EscapeString(ctx.Param("token")))
+
+	var checkVals CheckSchema
+	checkData, err := util.ValidateAndMap(
+		ctx.Request.Body, "/filter/checkSchema.json", util.Body(checkVals))
+
+	if validateErr, ok := err.(util.APIError); !ok && err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	} else if ok {
+		// It's a validation error
+		util.NiceError(ctx, validateErr, http.StatusBadRequest)
+		return
+	}
+
+	if err = mapstruct.Decode(checkData, &checkVals); err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+
+	config, _, err := f.ReturnConfig(token)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+
+	response := CheckResponseSchema{
+		ID:         token,
+		Exempt:     false,
+		Violations: make([]Violation, 0),
+		Token:      token,
+	}
+
+	// Check the cheap exemption first so we don't hit the DB if we don't need to
+	if config.Exempt.Role > 0 && checkVals.Role >= config.Exempt.Role {
+		response.Exempt = true
+	} else if config.Exempt.Trusted && checkVals.Viewer != "" && f.Trust != nil {
+		states, err := f.Trust.Lookup(token, []string{checkVals.Viewer})
+		if err != nil {
+			util.NiceError(ctx, err, http.StatusInternalServerError)
+			return
+		}
+		response.Exempt = states[strings.ToLower(checkVals.Viewer)]
+	}
+
+	if !response.Exempt {
+		response.Violations, err = config.Check(checkVals.Message)
+		if err != nil {
+			util.NiceError(ctx, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	ctx.JSON(http.StatusOK, util.MarshalResponse(response))
+}
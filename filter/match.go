@@ -0,0 +1,232 @@
+package filter
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/CactusDev/Xerophi/offence"
+	"github.com/CactusDev/Xerophi/schemas"
+)
+
+// Something that looks like a link, with or without the scheme
+var linkPattern = regexp.MustCompile(
+	`(?i)\b(?:https?://)?(?:[a-z0-9-]+\.)+[a-z]{2,}(?::\d+)?(?:/\S*)?`)
+
+// Characters that count as part of a word when matching whole phrases
+const wordChars = `\p{L}\p{N}_`
+
+// Span is the location of a match in the message, in characters
+type Span struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Violation is a single rule that a message broke
+type Violation struct {
+	Rule    string `json:"rule"`    // The filter that caught the message
+	Offence string `json:"offence"` // The offence type to record for it
+	Detail  string `json:"detail"`  // What specifically was matched
+	Spans   []Span `json:"spans"`
+}
+
+// maxCompiled is how many compiled phrases are cached, it's cleared once full
+const maxCompiled = 4096
+
+// compiled caches every phrase that's been compiled. The config is retrieved
+// for every message that's checked, so this saves compiling the same phrases
+// over and over
+var compiled = struct {
+	sync.Mutex
+	matchers map[Phrase]matcher
+}{matchers: make(map[Phrase]matcher)}
+
+// matcher finds a single banned phrase in a message
+type matcher struct {
+	pattern *regexp.Regexp
+	whole   bool // Only whole words match, and the phrase is the first group
+}
+
+// compilePhrase turns a banned phrase into the matcher used to find it. Exact
+// and wildcard phrases only match whole words, regex phrases are used as is
+func compilePhrase(phrase Phrase) (matcher, error) {
+	var pattern string
+	switch phrase.Mode {
+	case Regex:
+		pattern = phrase.Phrase
+	case Wildcard:
+		var quoted []string
+		for _, part := range strings.Split(phrase.Phrase, "*") {
+			quoted = append(quoted, strings.Replace(
+				regexp.QuoteMeta(part), `\?`, `.`, -1))
+		}
+		pattern = wholeWord(strings.Join(quoted, `\S*`))
+	case Exact:
+		pattern = wholeWord(regexp.QuoteMeta(phrase.Phrase))
+	default:
+		return matcher{}, fmt.Errorf("Unknown phrase mode %s", phrase.Mode)
+	}
+
+	compiledPattern, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		return matcher{}, err
+	}
+	return matcher{pattern: compiledPattern, whole: phrase.Mode != Regex}, nil
+}
+
+// lookupPhrase returns the phrase's matcher, compiling it if it hasn't been
+// already
+func lookupPhrase(phrase Phrase) (matcher, error) {
+	compiled.Lock()
+	defer compiled.Unlock()
+	if found, ok := compiled.matchers[phrase]; ok {
+		return found, nil
+	}
+	found, err := compilePhrase(phrase)
+	if err != nil {
+		return matcher{}, err
+	}
+	if len(compiled.matchers) >= maxCompiled {
+		compiled.matchers = make(map[Phrase]matcher)
+	}
+	compiled.matchers[phrase] = found
+	return found, nil
+}
+
+// wholeWord makes the pattern only match at the start of a word, with the
+// phrase itself as the first group. Go's regexes can't look ahead, so the end
+// of the word is checked separately rather than matched, which would stop a
+// repeat straight after it from being found
+func wholeWord(pattern string) string {
+	return fmt.Sprintf(`(?:^|[^%[1]s])(%[2]s)`, wordChars, pattern)
+}
+
+// isWordChar returns if the character is one of wordChars
+func isWordChar(char rune) bool {
+	return unicode.IsLetter(char) || unicode.IsNumber(char) || char == '_'
+}
+
+// find returns the byte range of everywhere the phrase is in the text
+func (m matcher) find(text string) [][2]int {
+	var found [][2]int
+	for _, loc := range m.pattern.FindAllStringSubmatchIndex(text, -1) {
+		if !m.whole {
+			found = append(found, [2]int{loc[0], loc[1]})
+			continue
+		}
+		// It's the start of a longer word
+		if next, _ := utf8.DecodeRuneInString(text[loc[3]:]); loc[3] < len(text) && isWordChar(next) {
+			continue
+		}
+		found = append(found, [2]int{loc[2], loc[3]})
+	}
+	return found
+}
+
+// toSpan converts a byte range of the text into a character range
+func toSpan(text string, start int, end int) Span {
+	runeStart := utf8.RuneCountInString(text[:start])
+	return Span{
+		Start: runeStart,
+		End:   runeStart + utf8.RuneCountInString(text[start:end]),
+	}
+}
+
+// matchDomain checks if the host is the domain or one of its subdomains
+func matchDomain(host string, domains []string) bool {
+	for _, domain := range domains {
+		domain = strings.ToLower(domain)
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check runs the message against all of the channel's rules and returns
+// every rule it broke
+func (c Config) Check(message []schemas.MessagePacket) ([]Violation, error) {
+	var violations = make([]Violation, 0)
+	var text string
+	var emotes []Span
+
+	// Piece the message back together, keeping track of where the emotes are
+	for _, packet := range message {
+		if packet.Type == "emoji" {
+			start := utf8.RuneCountInString(text)
+			emotes = append(emotes, Span{
+				Start: start, End: start + utf8.RuneCountInString(packet.Text)})
+		}
+		text += packet.Text
+	}
+
+	for _, phrase := range c.Phrases {
+		found, err := lookupPhrase(phrase)
+		if err != nil {
+			return nil, err
+		}
+		var spans []Span
+		for _, loc := range found.find(text) {
+			spans = append(spans, toSpan(text, loc[0], loc[1]))
+		}
+		if len(spans) > 0 {
+			violations = append(violations, Violation{
+				Rule: "phrase", Offence: offence.BannedWord,
+				Detail: phrase.Phrase, Spans: spans,
+			})
+		}
+	}
+
+	for _, loc := range linkPattern.FindAllStringIndex(text, -1) {
+		link := text[loc[0]:loc[1]]
+		if !strings.Contains(link, "://") {
+			link = "http://" + link
+		}
+		parsed, err := url.Parse(link)
+		if err != nil {
+			continue
+		}
+		host := strings.ToLower(parsed.Hostname())
+
+		if matchDomain(host, c.Links.Deny) ||
+			(c.Links.Enabled && !matchDomain(host, c.Links.Allow)) {
+			violations = append(violations, Violation{
+				Rule: "link", Offence: offence.Link,
+				Detail: host, Spans: []Span{toSpan(text, loc[0], loc[1])},
+			})
+		}
+	}
+
+	if c.Caps.Enabled {
+		var letters, upper int
+		for _, char := range text {
+			if unicode.IsLetter(char) {
+				letters++
+				if unicode.IsUpper(char) {
+					upper++
+				}
+			}
+		}
+		if letters >= c.Caps.MinLength && letters > 0 &&
+			upper*100 > c.Caps.Percentage*letters {
+			violations = append(violations, Violation{
+				Rule: "caps", Offence: offence.Caps,
+				Detail: fmt.Sprintf("%d%% capitals", upper*100/letters),
+				Spans:  []Span{{Start: 0, End: utf8.RuneCountInString(text)}},
+			})
+		}
+	}
+
+	if c.Emotes.Enabled && len(emotes) > c.Emotes.Max {
+		violations = append(violations, Violation{
+			Rule: "emotes", Offence: offence.Emote,
+			Detail: fmt.Sprintf("%d emotes", len(emotes)), Spans: emotes,
+		})
+	}
+
+	return violations, nil
+}
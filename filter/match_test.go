@@ -0,0 +1,71 @@
+package filter
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/CactusDev/Xerophi/schemas"
+)
+
+func TestCheckPhrases(t *testing.T) {
+	tests := []struct {
+		name   string
+		phrase Phrase
+		text   string
+		spans  []Span
+	}{
+		{"exact", Phrase{"bad", Exact}, "that's bad", []Span{{7, 10}}},
+		{"exact ignores case", Phrase{"bad", Exact}, "BaD", []Span{{0, 3}}},
+		{"exact inside a word", Phrase{"bad", Exact}, "badge abad", nil},
+		{"exact adjacent repeats", Phrase{"bad", Exact}, "bad bad bad", []Span{{0, 3}, {4, 7}, {8, 11}}},
+		{"exact around punctuation", Phrase{"bad", Exact}, "(bad),bad!", []Span{{1, 4}, {6, 9}}},
+		{"exact after a rejected match", Phrase{"bad", Exact}, "badx bad", []Span{{5, 8}}},
+		{"exact with spaces", Phrase{"very bad", Exact}, "very bad very bad", []Span{{0, 8}, {9, 17}}},
+		{"exact in characters", Phrase{"bad", Exact}, "ñó bad", []Span{{3, 6}}},
+		{"exact meta characters", Phrase{"b.d", Exact}, "bad b.d", []Span{{4, 7}}},
+		{"wildcard star", Phrase{"b*d", Wildcard}, "bad bored bd", []Span{{0, 3}, {4, 9}, {10, 12}}},
+		{"wildcard question", Phrase{"b?d", Wildcard}, "bad bd bird", []Span{{0, 3}}},
+		{"wildcard adjacent repeats", Phrase{"b?d", Wildcard}, "bad bid", []Span{{0, 3}, {4, 7}}},
+		{"regex anywhere", Phrase{"bad", Regex}, "badge", []Span{{0, 3}}},
+		{"regex with groups", Phrase{"(b)(a)d", Regex}, "a bad", []Span{{2, 5}}},
+		{"regex optional group", Phrase{"x(y)?z", Regex}, "xz xyz", []Span{{0, 2}, {3, 6}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := Config{Phrases: []Phrase{test.phrase}}
+			violations, err := config.Check([]schemas.MessagePacket{
+				{Type: "text", Text: test.text, Data: test.text},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var spans []Span
+			for _, violation := range violations {
+				spans = append(spans, violation.Spans...)
+			}
+			if !reflect.DeepEqual(spans, test.spans) {
+				t.Errorf("expected %v, got %v", test.spans, spans)
+			}
+		})
+	}
+}
+
+func TestLookupPhraseCaches(t *testing.T) {
+	phrase := Phrase{"cached", Exact}
+	first, err := lookupPhrase(phrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := lookupPhrase(phrase)
+	if first.pattern != second.pattern {
+		t.Error("expected the phrase to only be compiled once")
+	}
+
+	if _, err := lookupPhrase(Phrase{"(", Regex}); err == nil {
+		t.Error("expected an invalid regex to fail")
+	}
+	if _, err := lookupPhrase(Phrase{"bad", "fuzzy"}); err == nil {
+		t.Error("expected an unknown mode to fail")
+	}
+}
@@ -0,0 +1,60 @@
+package filter
+
+// Modes a banned phrase can be matched with
+const (
+	Exact    = "exact"
+	Wildcard = "wildcard"
+	Regex    = "regex"
+)
+
+// DefaultConfig is used for any channel that hasn't configured their filters,
+// which is to say nothing gets filtered
+var DefaultConfig = Config{
+	Phrases: []Phrase{},
+	Links:   LinkRules{Enabled: false, Allow: []string{}, Deny: []string{}},
+	Caps:    CapsRules{Enabled: false, Percentage: 70, MinLength: 10},
+	Emotes:  EmoteRules{Enabled: false, Max: 10},
+	Exempt:  ExemptRules{Trusted: true, Role: 0},
+}
+
+// Config is all of a channel's filter rules
+type Config struct {
+	Phrases []Phrase    `json:"phrases"`
+	Links   LinkRules   `json:"links"`
+	Caps    CapsRules   `json:"caps"`
+	Emotes  EmoteRules  `json:"emotes"`
+	Exempt  ExemptRules `json:"exempt"`
+}
+
+// Phrase is a single banned phrase
+type Phrase struct {
+	Phrase string `json:"phrase"`
+	Mode   string `json:"mode"`
+}
+
+// LinkRules controls which links are allowed in chat. Denied domains are
+// always filtered, and when enabled every domain that isn't allowed is too
+type LinkRules struct {
+	Enabled bool     `json:"enabled"`
+	Allow   []string `json:"allow"`
+	Deny    []string `json:"deny"`
+}
+
+// CapsRules controls how shouty messages can be
+type CapsRules struct {
+	Enabled    bool `json:"enabled"`
+	Percentage int  `json:"percentage"` // Highest percentage of letters that can be capitals
+	MinLength  int  `json:"minLength"`  // Messages with fewer letters than this aren't checked
+}
+
+// EmoteRules controls how many emotes can be in a message
+type EmoteRules struct {
+	Enabled bool `json:"enabled"`
+	Max     int  `json:"max"`
+}
+
+// ExemptRules controls who the filters don't apply to
+type ExemptRules struct {
+	Trusted bool `json:"trusted"` // Viewers on the channel's trusted list
+	Role    int  `json:"role"`    // Viewers with at least this role, 0 to disable
+}
@@ -0,0 +1,88 @@
+package filter
+
+import (
+	"time"
+
+	"github.com/CactusDev/Xerophi/schemas"
+	"github.com/CactusDev/Xerophi/util"
+)
+
+// ResponseSchema is the schema for the data that will be sent out to the client
+type ResponseSchema struct {
+	ID      string      `jsonapi:"primary,filter"`
+	Caps    CapsRules   `jsonapi:"attr,caps"`
+	Emotes  EmoteRules  `jsonapi:"attr,emotes"`
+	Exempt  ExemptRules `jsonapi:"attr,exempt"`
+	Links   LinkRules   `jsonapi:"attr,links"`
+	Phrases []Phrase    `jsonapi:"attr,phrases"`
+	Token   string      `jsonapi:"meta,token"`
+}
+
+// CheckResponseSchema is the schema for the result of checking a message
+type CheckResponseSchema struct {
+	ID         string      `jsonapi:"primary,filterCheck"`
+	Exempt     bool        `jsonapi:"attr,exempt"`
+	Violations []Violation `jsonapi:"attr,violations"`
+	Token      string      `jsonapi:"meta,token"`
+}
+
+// CreationSchema is all the data required for a channel's filters to be stored
+type CreationSchema struct {
+	Config
+	// Ignore these fields in user input, they will be filled automatically by the API
+	CreatedAt time.Time `json:"createdAt"`
+	DeletedAt float64   `json:"deletedAt"`
+	Token     string    `json:"token"`
+}
+
+// UpdateSchema is the schema used when updating existing filters
+type UpdateSchema struct {
+	Caps    *UpdateCapsRules   `json:"caps,omitempty"`
+	Emotes  *UpdateEmoteRules  `json:"emotes,omitempty"`
+	Exempt  *UpdateExemptRules `json:"exempt,omitempty"`
+	Links   *UpdateLinkRules   `json:"links,omitempty"`
+	Phrases *[]Phrase          `json:"phrases,omitempty"`
+}
+
+// UpdateCapsRules is the schema stored under the caps key in UpdateSchema
+type UpdateCapsRules struct {
+	Enabled    *bool `json:"enabled,omitempty"`
+	Percentage *int  `json:"percentage,omitempty"`
+	MinLength  *int  `json:"minLength,omitempty"`
+}
+
+// UpdateEmoteRules is the schema stored under the emotes key in UpdateSchema
+type UpdateEmoteRules struct {
+	Enabled *bool `json:"enabled,omitempty"`
+	Max     *int  `json:"max,omitempty"`
+}
+
+// UpdateExemptRules is the schema stored under the exempt key in UpdateSchema
+type UpdateExemptRules struct {
+	Trusted *bool `json:"trusted,omitempty"`
+	Role    *int  `json:"role,omitempty"`
+}
+
+// UpdateLinkRules is the schema stored under the links key in UpdateSchema
+type UpdateLinkRules struct {
+	Enabled *bool     `json:"enabled,omitempty"`
+	Allow   *[]string `json:"allow,omitempty"`
+	Deny    *[]string `json:"deny,omitempty"`
+}
+
+// CheckSchema is the message the client wants checked and who sent it
+type CheckSchema struct {
+	Message []schemas.MessagePacket `json:"message"`
+	Role    int                     `json:"role"`
+	Viewer  string                  `json:"viewer"`
+}
+
+// GetAPITag allows each of these types to implement the JSONAPISchema interface
+func (rs ResponseSchema) GetAPITag(lookup string) string {
+	return util.FieldTag(rs, lookup, "jsonapi")
+}
+
+// GetAPITag allows each of these types to implement the JSONAPISchema interface
+func (cr CheckResponseSchema) GetAPITag(lookup string) string {
+	return util.FieldTag(cr, lookup, "jsonapi")
+}
@@ -0,0 +1,244 @@
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CactusDev/Xerophi/rethink"
+	"github.com/CactusDev/Xerophi/util"
+
+	"github.com/gin-gonic/gin"
+
+	mapstruct "github.com/mitchellh/mapstructure"
+	log "github.com/sirupsen/logrus"
+)
+
+// Header is where clients send the key that makes a request safe to retry
+const Header = "Idempotency-Key"
+
+// ReplayedHeader is set on responses that are a replay of the original
+const ReplayedHeader = "Idempotent-Replayed"
+
+// MaxKeyLength is the longest key that's accepted
+const MaxKeyLength = 255
+
+// Store keeps the response to each request that was sent with a key, so a
+// retry gets the same response rather than doing it all again
+type Store struct {
+	DB       rethink.Database // The storage backend responses are kept in
+	Table    string           // The table responses are kept in
+	TTL      time.Duration    // How long a response is kept for
+	Interval time.Duration    // How often expired responses are removed
+
+	mutex   sync.Mutex
+	pending map[string]struct{} // Keys with a request that's still being handled
+}
+
+// saved is a response as it's stored
+type saved struct {
+	Fingerprint string              `mapstructure:"fingerprint"`
+	Status      int                 `mapstructure:"status"`
+	Headers     map[string][]string `mapstructure:"headers"`
+	Body        string              `mapstructure:"body"`
+	ExpiresAt   int64               `mapstructure:"expiresAt"`
+}
+
+// recorder keeps a copy of the response as it's written
+type recorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recorder) WriteString(data string) (int, error) {
+	w.body.WriteString(data)
+	return w.ResponseWriter.WriteString(data)
+}
+
+// hash returns the hex SHA-256 of the parts given
+func hash(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// claim marks the key as having a request in progress, returning false if
+// another request already has it. This only covers this instance of the API,
+// the stored response covers the rest
+func (s *Store) claim(id string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.pending == nil {
+		s.pending = make(map[string]struct{})
+	}
+	if _, busy := s.pending[id]; busy {
+		return false
+	}
+	s.pending[id] = struct{}{}
+	return true
+}
+
+// release lets the key be used again once its request is done
+func (s *Store) release(id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.pending, id)
+}
+
+// lookup retrieves the stored response, or nil if there isn't one or it's
+// expired
+func (s *Store) lookup(id string) (*saved, error) {
+	// Stored responses don't have a deletedAt, so they're looked up by filter
+	// rather than GetByUUID
+	fromDB, err := s.DB.GetSingle(map[string]interface{}{"id": id}, s.Table)
+	if err != nil || fromDB == nil {
+		return nil, err
+	}
+	var response saved
+	if err := mapstruct.Decode(fromDB, &response); err != nil {
+		return nil, err
+	}
+	if response.ExpiresAt <= time.Now().UTC().Unix() {
+		return nil, nil
+	}
+	return &response, nil
+}
+
+// save stores the response so it can be replayed
+func (s *Store) save(id string, channel string, key string, fingerprint string,
+	ctx *gin.Context, body []byte) error {
+	var headers = make(map[string][]string, len(ctx.Writer.Header()))
+	for name, values := range ctx.Writer.Header() {
+		headers[name] = append([]string(nil), values...)
+	}
+
+	now := time.Now().UTC()
+	_, err := s.DB.Upsert(s.Table, map[string]interface{}{
+		"id":          id,
+		"channel":     channel,
+		"key":         key,
+		"fingerprint": fingerprint,
+		"status":      ctx.Writer.Status(),
+		"headers":     headers,
+		"body":        string(body),
+		"createdAt":   now.Format(time.RFC3339),
+		"expiresAt":   now.Add(s.TTL).Unix(),
+	})
+	return err
+}
+
+// replay sends the stored response again
+func replay(ctx *gin.Context, response *saved) {
+	for name, values := range response.Headers {
+		ctx.Writer.Header()[name] = values
+	}
+	ctx.Header(ReplayedHeader, "true")
+	ctx.Writer.WriteHeader(response.Status)
+	ctx.Writer.WriteString(response.Body)
+	ctx.Abort()
+}
+
+// Middleware makes the route safe to retry for requests sent with a key. The
+// first response for a key is stored and sent again for any retries, as long
+// as they're the same request. Server errors aren't kept so they can be
+// retried for real
+func (s *Store) Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		key := ctx.GetHeader(Header)
+		if key == "" {
+			ctx.Next()
+			return
+		}
+		if len(key) > MaxKeyLength {
+			util.Abort(ctx, util.ErrBadRequest,
+				fmt.Sprintf("%s can't be longer than %d characters", Header, MaxKeyLength))
+			return
+		}
+
+		var body []byte
+		if ctx.Request.Body != nil {
+			var err error
+			if body, err = ioutil.ReadAll(ctx.Request.Body); err != nil {
+				util.NiceError(ctx, err, http.StatusBadRequest)
+				return
+			}
+			// Put it back for the handler
+			ctx.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+
+		// Keys are only unique to a channel
+		channel := strings.ToLower(ctx.Param("token"))
+		id := hash(channel, key)
+		// The query string is part of the request, e.g. an import's mode
+		fingerprint := hash(ctx.Request.Method, ctx.Request.URL.RequestURI(), string(body))
+
+		if !s.claim(id) {
+			util.Abort(ctx, util.ErrInProgress,
+				"A request with this "+Header+" is still being handled")
+			return
+		}
+		defer s.release(id)
+
+		stored, err := s.lookup(id)
+		if err != nil {
+			util.NiceError(ctx, err, http.StatusInternalServerError)
+			return
+		}
+		if stored != nil {
+			if stored.Fingerprint != fingerprint {
+				util.Abort(ctx, util.ErrKeyReused,
+					"This "+Header+" was already used for a different request")
+				return
+			}
+			replay(ctx, stored)
+			return
+		}
+
+		writer := &recorder{ResponseWriter: ctx.Writer}
+		ctx.Writer = writer
+		ctx.Next()
+
+		if ctx.Writer.Status() >= 500 {
+			return
+		}
+		if err := s.save(id, channel, key, fingerprint, ctx, writer.body.Bytes()); err != nil {
+			log.Errorf("[%s] - Failed to save the response for %s: %s", s.Table, key, err)
+		}
+	}
+}
+
+// Prune removes every response that's expired and returns how many were
+// removed
+func (s *Store) Prune() (int, error) {
+	return s.DB.DeleteByQuery(s.Table, rethink.Query{
+		Ranges: []rethink.Range{
+			{Field: "expiresAt", Max: time.Now().UTC().Unix()},
+		},
+	})
+}
+
+// Start prunes expired responses in the background every interval
+func (s *Store) Start() {
+	go func() {
+		for {
+			removed, err := s.Prune()
+			if err != nil {
+				log.Error(err.Error())
+			} else if removed > 0 {
+				log.Infof("[%s] - Pruned %d expired responses", s.Table, removed)
+			}
+
+			time.Sleep(s.Interval)
+		}
+	}()
+}
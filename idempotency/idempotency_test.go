@@ -0,0 +1,73 @@
+package idempotency
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CactusDev/Xerophi/rethink/rethinktest"
+	"github.com/CactusDev/Xerophi/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// setup returns a router with a single keyed route, and how many times its
+// handler has actually run
+func setup(t *testing.T) (http.Handler, *int) {
+	store := &Store{DB: rethinktest.NewMemory(), Table: "idempotency", TTL: time.Hour}
+	var handled int
+	router := gin.New()
+	router.POST(util.BasePath+"/user/:token/import", store.Middleware(), func(ctx *gin.Context) {
+		handled++
+		ctx.JSON(http.StatusOK, map[string]interface{}{"mode": ctx.Query("mode")})
+	})
+	return router, &handled
+}
+
+// send makes a keyed request and returns the response
+func send(router http.Handler, query string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", util.BasePath+"/user/channel/import"+query, strings.NewReader(body))
+	req.Header.Set(Header, "key")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestReplay(t *testing.T) {
+	router, handled := setup(t)
+
+	first := send(router, "?mode=merge", "{}")
+	again := send(router, "?mode=merge", "{}")
+	if *handled != 1 || again.Header().Get(ReplayedHeader) != "true" ||
+		again.Body.String() != first.Body.String() {
+		t.Errorf("expected the retry to be replayed, handled %d times and got %s",
+			*handled, again.Body.String())
+	}
+}
+
+func TestKeyReused(t *testing.T) {
+	for _, test := range []struct{ query, body string }{
+		{"?mode=replace", "{}"},
+		{"", "{}"},
+		{"?mode=merge", "[]"},
+	} {
+		router, handled := setup(t)
+		send(router, "?mode=merge", "{}")
+
+		if code := send(router, test.query, test.body).Code; code != http.StatusUnprocessableEntity {
+			t.Errorf("%q %s: expected the key to be turned away, got %d", test.query, test.body, code)
+		}
+		if *handled != 1 {
+			t.Errorf("%q %s: expected it not to be handled again, handled %d times",
+				test.query, test.body, *handled)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strconv"
+	"strings"
+
+	"github.com/CactusDev/Xerophi/archive"
+)
+
+// CSV imports a spreadsheet of commands, with name and response columns, or
+// of quotes, with a quote column. Responses can use either Nightbot's or
+// StreamElements' variables since that's where most spreadsheets come from
+type CSV struct{}
+
+// Other names columns go by, all matched ignoring case
+var csvColumns = map[string][]string{
+	"name":     {"name", "command"},
+	"response": {"response", "message", "reply"},
+	"enabled":  {"enabled"},
+	"count":    {"count", "uses"},
+	"quote":    {"quote", "text"},
+	"quoteId":  {"quoteid", "id", "number"},
+	"speaker":  {"speaker", "author", "user"},
+	"game":     {"game", "category"},
+	"date":     {"date"},
+}
+
+// columns works out which column each field is in from the header row
+func columns(header []string) map[string]int {
+	var found = make(map[string]int)
+	for pos, title := range header {
+		title = strings.ToLower(strings.TrimSpace(title))
+		for field, names := range csvColumns {
+			if _, done := found[field]; done {
+				continue
+			}
+			for _, name := range names {
+				if title == name {
+					found[field] = pos
+				}
+			}
+		}
+	}
+	return found
+}
+
+// Convert reads the spreadsheet, the first row has to be the column names
+func (CSV) Convert(body []byte) (archive.Archive, []archive.Warning, error) {
+	reader := csv.NewReader(bytes.NewReader(body))
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return archive.Archive{}, nil, invalidExport("Invalid CSV: %s", err)
+	}
+	if len(rows) == 0 {
+		return archive.Archive{}, nil, invalidExport("The CSV is empty")
+	}
+
+	cols := columns(rows[0])
+	cell := func(row []string, field string) string {
+		pos, ok := cols[field]
+		if !ok || pos >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[pos])
+	}
+
+	result := newConverted()
+	_, hasQuotes := cols["quote"]
+	_, hasName := cols["name"]
+	_, hasResponse := cols["response"]
+	switch {
+	case hasQuotes:
+		for _, row := range rows[1:] {
+			if cell(row, "quote") == "" {
+				continue
+			}
+			number, _ := strconv.Atoi(cell(row, "quoteId"))
+			result.addQuote(number, cell(row, "quote"), cell(row, "speaker"),
+				cell(row, "game"), cell(row, "date"))
+		}
+	case hasName && hasResponse:
+		for _, row := range rows[1:] {
+			enabled := true
+			if raw := cell(row, "enabled"); raw != "" {
+				if parsed, err := strconv.ParseBool(raw); err == nil {
+					enabled = parsed
+				}
+			}
+			count, _ := strconv.Atoi(cell(row, "count"))
+			result.addCommand(cell(row, "name"), cell(row, "response"), count, enabled, "",
+				nightbotVars, streamElementsVars)
+		}
+	default:
+		return archive.Archive{}, nil, invalidExport(
+			"The CSV needs name and response columns for commands, or a quote column for quotes")
+	}
+
+	return result.archive()
+}
@@ -0,0 +1,76 @@
+package importer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCSVColumns(t *testing.T) {
+	tests := []struct {
+		name     string
+		csv      string
+		resource string
+		record   map[string]interface{} // Fields the first record has to have
+	}{
+		{"command names", "name,response\n!hi,hello\n", "commands",
+			map[string]interface{}{"name": "hi", "count": 0.0, "enabled": true}},
+		{"command aliases", "Command,Message,Uses,Enabled\nhi,hello,3,false\n", "commands",
+			map[string]interface{}{"name": "hi", "count": 3.0, "enabled": false}},
+		{"reply", " COMMAND , Reply \nhi,hello\n", "commands",
+			map[string]interface{}{"name": "hi"}},
+		{"unreadable enabled", "name,response,enabled\nhi,hello,sometimes\n", "commands",
+			map[string]interface{}{"enabled": true}},
+		{"quote names", "quoteId,quote,speaker,game,date\n3,hi,Cat,Chatting,2020-01-02\n", "quotes",
+			map[string]interface{}{"quoteId": 3.0, "quote": "hi", "speaker": "Cat", "game": "Chatting", "date": "2020-01-02"}},
+		{"quote aliases", "Number,Text,Author,Category,Date\n3,hi,Cat,Chatting,1/2/2020\n", "quotes",
+			map[string]interface{}{"quoteId": 3.0, "quote": "hi", "speaker": "Cat", "game": "Chatting", "date": "2020-01-02"}},
+		{"id", "id,quote,user\n4,hi,Cat\n", "quotes",
+			map[string]interface{}{"quoteId": 4.0, "speaker": "Cat"}},
+		{"first column wins", "text,quote\nfirst,second\n", "quotes",
+			map[string]interface{}{"quote": "first"}},
+		// A quote column makes it quotes, even if there's a name too
+		{"quotes over commands", "name,response,quote\nhi,hello,a quote\n", "quotes",
+			map[string]interface{}{"quote": "a quote"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			converted, _, err := CSV{}.Convert([]byte(test.csv))
+			if err != nil {
+				t.Fatal(err)
+			}
+			records := converted.Resources[test.resource]
+			if len(records) != 1 {
+				t.Fatalf("expected a single record in %s, got %v", test.resource, converted.Resources)
+			}
+			for field, want := range test.record {
+				if got := records[0][field]; !reflect.DeepEqual(got, want) {
+					t.Errorf("expected %s to be %v, got %v", field, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestCSVTranslates(t *testing.T) {
+	converted, warnings, err := CSV{}.Convert([]byte("name,response\nhi,$(user) ${1} $(weather)\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := converted.Resources["commands"][0]["response"].(map[string]interface{})
+	packet := response["message"].([]interface{})[0].(map[string]interface{})
+	if packet["text"] != "%USER% %ARG1% $(weather)" {
+		t.Errorf("expected both dialects to be translated, got %v", packet["text"])
+	}
+	if len(warnings) != 1 || warnings[0].Record != "hi" {
+		t.Errorf("expected a warning about $(weather), got %v", warnings)
+	}
+}
+
+func TestCSVRejects(t *testing.T) {
+	for _, body := range []string{"", "title,body\na,b\n", "name\nhi\n", "name,response\n\"hi,hello\n"} {
+		if _, _, err := (CSV{}).Convert([]byte(body)); err == nil {
+			t.Errorf("expected %q to be rejected", body)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/CactusDev/Xerophi/archive"
+	"github.com/CactusDev/Xerophi/schemas"
+	"github.com/CactusDev/Xerophi/util"
+)
+
+// Sources are the other bots' exports that can be imported, by the name used
+// in the import endpoint's source parameter
+var Sources = map[string]archive.Source{
+	"csv":            CSV{},
+	"nightbot":       Nightbot{},
+	"streamelements": StreamElements{},
+}
+
+// urlPattern finds links in a message so they can be sent as url packets
+var urlPattern = regexp.MustCompile(`https?://\S+`)
+
+// dateLayouts are the ways other bots write dates, tried in order
+var dateLayouts = []string{
+	"2006-01-02",
+	time.RFC3339,
+	"01/02/2006",
+	"1/2/2006",
+	"2 Jan 2006",
+	"January 2, 2006",
+	"Jan 2, 2006",
+}
+
+// converted collects the records and warnings as an export is converted
+type converted struct {
+	resources map[string][]map[string]interface{}
+	warnings  []archive.Warning
+}
+
+func newConverted() *converted {
+	return &converted{resources: make(map[string][]map[string]interface{})}
+}
+
+// warn records something that couldn't be brought over as it was
+func (c *converted) warn(resource string, record string, format string, args ...interface{}) {
+	c.warnings = append(c.warnings, archive.Warning{
+		Resource: resource,
+		Record:   record,
+		Detail:   fmt.Sprintf(format, args...),
+	})
+}
+
+// archive returns everything that was converted. It's put through JSON so
+// the records look exactly like they would coming from one of our archives
+func (c *converted) archive() (archive.Archive, []archive.Warning, error) {
+	var result archive.Archive
+	encoded, err := json.Marshal(c.resources)
+	if err == nil {
+		err = json.Unmarshal(encoded, &result.Resources)
+	}
+	return result, c.warnings, err
+}
+
+// invalidExport is the error for an export that can't be read at all
+func invalidExport(format string, args ...interface{}) util.APIError {
+	return util.APIError{
+		Code: util.ErrInvalidDocument,
+		Data: map[string]interface{}{"": fmt.Sprintf(format, args...)},
+	}
+}
+
+// commandName normalizes a command's name the same way the command routes do,
+// without any prefix the other bot used
+func commandName(name string) string {
+	return html.EscapeString(strings.TrimLeft(strings.TrimSpace(name), "!"))
+}
+
+// message turns a response into message packets, with links in their own
+// packets so they're sent as links
+func message(text string) []schemas.MessagePacket {
+	var packets []schemas.MessagePacket
+	var last int
+	for _, loc := range urlPattern.FindAllStringIndex(text, -1) {
+		if loc[0] > last {
+			packets = append(packets, schemas.MessagePacket{
+				Data: text[last:loc[0]], Text: text[last:loc[0]], Type: "text"})
+		}
+		link := text[loc[0]:loc[1]]
+		packets = append(packets, schemas.MessagePacket{Data: link, Text: link, Type: "url"})
+		last = loc[1]
+	}
+	if last < len(text) {
+		packets = append(packets, schemas.MessagePacket{
+			Data: text[last:], Text: text[last:], Type: "text"})
+	}
+	return packets
+}
+
+// addCommand converts a command's response from another bot's syntax and
+// adds it. Commands that had restrictions we can't carry over are added
+// disabled so they don't end up open to everyone
+func (c *converted) addCommand(name string, response string, count int,
+	enabled bool, restricted string, dialects ...dialect) {
+	raw, name := name, commandName(name)
+	if name == "" {
+		c.warn("commands", raw, "Skipped a command without a name")
+		return
+	}
+
+	translated, unsupported := translate(response, dialects...)
+	for _, variable := range unsupported {
+		c.warn("commands", name, "%s isn't supported, it's been left as text", variable)
+	}
+	if restricted != "" {
+		c.warn("commands", name,
+			"Was restricted to %s, which can't be carried over. It's been disabled", restricted)
+		enabled = false
+	}
+
+	c.resources["commands"] = append(c.resources["commands"], map[string]interface{}{
+		"name":      name,
+		"arguments": []schemas.MessagePacket{},
+		"enabled":   enabled,
+		"count":     count,
+		"response": map[string]interface{}{
+			"action":  false,
+			"message": message(translated),
+			"role":    0,
+			"target":  "",
+			"user":    "",
+		},
+	})
+}
+
+// addQuote adds a quote. Without a number it's numbered after the channel's
+// existing quotes
+func (c *converted) addQuote(number int, quote string, speaker string, game string, date string) {
+	record := map[string]interface{}{"quote": strings.TrimSpace(quote)}
+	name := fmt.Sprintf("quote %d", len(c.resources["quotes"])+1)
+	if number > 0 {
+		record["quoteId"] = number
+		name = fmt.Sprintf("quote %d", number)
+	}
+	if speaker = strings.TrimSpace(speaker); speaker != "" {
+		record["speaker"] = speaker
+	}
+	if game = strings.TrimSpace(game); game != "" {
+		record["game"] = game
+	}
+	if date = strings.TrimSpace(date); date != "" {
+		if parsed, ok := parseDate(date); ok {
+			record["date"] = parsed
+		} else {
+			c.warn("quotes", name, "Couldn't read the date %s, it's been left out", date)
+		}
+	}
+
+	c.resources["quotes"] = append(c.resources["quotes"], record)
+}
+
+// parseDate reads a date in any of the layouts other bots use, returning it
+// as YYYY-MM-DD
+func parseDate(raw string) (string, bool) {
+	for _, layout := range dateLayouts {
+		if parsed, err := time.Parse(layout, raw); err == nil {
+			return parsed.Format("2006-01-02"), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,31 @@
+package importer
+
+import "testing"
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		raw  string
+		date string // "" if it can't be read
+	}{
+		{"2020-01-02", "2020-01-02"},
+		{"2020-01-02T23:30:00Z", "2020-01-02"},
+		{"2020-01-02T23:30:00-05:00", "2020-01-02"},
+		{"01/02/2020", "2020-01-02"},
+		{"1/2/2020", "2020-01-02"},
+		{"12/31/2020", "2020-12-31"},
+		{"2 Jan 2020", "2020-01-02"},
+		{"January 2, 2020", "2020-01-02"},
+		{"Jan 2, 2020", "2020-01-02"},
+		{"31/12/2020", ""},
+		{"2020-13-01", ""},
+		{"yesterday", ""},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		date, ok := parseDate(test.raw)
+		if ok != (test.date != "") || date != test.date {
+			t.Errorf("%q: expected %q, got %q %t", test.raw, test.date, date, ok)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package importer
+
+import (
+	"encoding/json"
+
+	"github.com/CactusDev/Xerophi/archive"
+)
+
+// Nightbot imports Nightbot's custom commands, either the list on its own or
+// wrapped in an object under commands like its API returns them
+type Nightbot struct{}
+
+// nightbotCommand is a single command in Nightbot's export
+type nightbotCommand struct {
+	Name      string `json:"name"`
+	Message   string `json:"message"`
+	Count     int    `json:"count"`
+	UserLevel string `json:"userLevel"`
+}
+
+// Convert reads the commands out of the export
+func (Nightbot) Convert(body []byte) (archive.Archive, []archive.Warning, error) {
+	var commands []nightbotCommand
+	if err := json.Unmarshal(body, &commands); err != nil {
+		var wrapped struct {
+			Commands []nightbotCommand `json:"commands"`
+		}
+		if err := json.Unmarshal(body, &wrapped); err != nil {
+			return archive.Archive{}, nil, invalidExport("Invalid Nightbot export: %s", err)
+		}
+		commands = wrapped.Commands
+	}
+
+	result := newConverted()
+	for _, command := range commands {
+		var restricted string
+		if command.UserLevel != "" && command.UserLevel != "everyone" {
+			restricted = command.UserLevel
+		}
+		result.addCommand(command.Name, command.Message, command.Count, true, restricted,
+			nightbotVars)
+	}
+
+	return result.archive()
+}
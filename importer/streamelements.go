@@ -0,0 +1,58 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/CactusDev/Xerophi/archive"
+)
+
+// StreamElements imports StreamElements' custom commands, either the list on
+// its own or wrapped in an object under commands
+type StreamElements struct{}
+
+// everyone is StreamElements' access level for commands anyone can use
+const everyone = 100
+
+// streamElementsCommand is a single command in StreamElements' export
+type streamElementsCommand struct {
+	Command     string   `json:"command"`
+	Reply       string   `json:"reply"`
+	Enabled     *bool    `json:"enabled"`
+	AccessLevel int      `json:"accessLevel"`
+	Aliases     []string `json:"aliases"`
+}
+
+// Convert reads the commands out of the export. We don't have aliases so
+// each one becomes a copy of the command
+func (StreamElements) Convert(body []byte) (archive.Archive, []archive.Warning, error) {
+	var commands []streamElementsCommand
+	if err := json.Unmarshal(body, &commands); err != nil {
+		var wrapped struct {
+			Commands []streamElementsCommand `json:"commands"`
+		}
+		if err := json.Unmarshal(body, &wrapped); err != nil {
+			return archive.Archive{}, nil, invalidExport("Invalid StreamElements export: %s", err)
+		}
+		commands = wrapped.Commands
+	}
+
+	result := newConverted()
+	for _, command := range commands {
+		enabled := command.Enabled == nil || *command.Enabled
+		var restricted string
+		if command.AccessLevel > everyone {
+			restricted = fmt.Sprintf("access level %d", command.AccessLevel)
+		}
+
+		for _, name := range append([]string{command.Command}, command.Aliases...) {
+			result.addCommand(name, command.Reply, 0, enabled, restricted, streamElementsVars)
+		}
+		if len(command.Aliases) > 0 {
+			result.warn("commands", commandName(command.Command),
+				"Aliases aren't supported, each one has been added as its own command")
+		}
+	}
+
+	return result.archive()
+}
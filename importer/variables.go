@@ -0,0 +1,83 @@
+package importer
+
+import (
+	"regexp"
+	"strings"
+)
+
+// dialect is how another bot writes variables in its responses
+type dialect struct {
+	pattern *regexp.Regexp    // Matches a variable, the first group being what's inside it
+	vars    map[string]string // Their variable names mapped onto ours
+	rest    string            // What they call "every argument from the first on", if anything
+}
+
+// Variables other bots write the same way, and the numbered arguments, are
+// handled for every dialect
+var common = map[string]string{
+	"user":    "%USER%",
+	"sender":  "%USER%",
+	"touser":  "%ARG1%",
+	"count":   "%COUNT%",
+	"channel": "%CHANNEL%",
+}
+
+// The dialects adapters can translate from
+var (
+	nightbotVars = dialect{
+		pattern: regexp.MustCompile(`\$\(([^()]*)\)`),
+		vars:    map[string]string{"query": "%ARGS%"},
+	}
+	streamElementsVars = dialect{
+		pattern: regexp.MustCompile(`\$\{([^{}]*)\}`),
+		vars:    map[string]string{"args": "%ARGS%"},
+		rest:    "1:",
+	}
+)
+
+// lookup finds our version of the variable, or "" if we don't have one
+func (d dialect) lookup(inside string) string {
+	name := strings.ToLower(strings.TrimSpace(inside))
+	if ours, ok := d.vars[name]; ok {
+		return ours
+	}
+	if ours, ok := common[name]; ok {
+		return ours
+	}
+	if d.rest != "" && name == d.rest {
+		return "%ARGS%"
+	}
+	// Numbered arguments, $(1) or ${1}
+	if len(name) == 1 && name[0] >= '1' && name[0] <= '9' {
+		return "%ARG" + name + "%"
+	}
+	return ""
+}
+
+// translate rewrites every variable from the dialects given into ours.
+// Anything we don't have an equivalent for is left as it was and returned so
+// it can be reported. Variables can be nested, so it keeps going until
+// there's nothing left it can translate
+func translate(text string, dialects ...dialect) (string, []string) {
+	var unsupported []string
+	var seen = make(map[string]struct{})
+	for {
+		before := text
+		for _, d := range dialects {
+			text = d.pattern.ReplaceAllStringFunc(text, func(variable string) string {
+				inside := d.pattern.FindStringSubmatch(variable)[1]
+				if ours := d.lookup(inside); ours != "" {
+					return ours
+				}
+				if _, done := seen[variable]; !done {
+					seen[variable] = struct{}{}
+					unsupported = append(unsupported, variable)
+				}
+				return variable
+			})
+		}
+		if text == before {
+			return text, unsupported
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package importer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		name        string
+		text        string
+		dialects    []dialect
+		translated  string
+		unsupported []string
+	}{
+		{"plain text", "hello there", []dialect{nightbotVars}, "hello there", nil},
+		{"common", "hi $(user), welcome to $(channel)", []dialect{nightbotVars}, "hi %USER%, welcome to %CHANNEL%", nil},
+		{"dialect's own", "you said $(query)", []dialect{nightbotVars}, "you said %ARGS%", nil},
+		{"ignores case and spaces", "$( USER )", []dialect{nightbotVars}, "%USER%", nil},
+		{"numbered", "${1} and ${9}", []dialect{streamElementsVars}, "%ARG1% and %ARG9%", nil},
+		{"rest", "${1:}", []dialect{streamElementsVars}, "%ARGS%", nil},
+		{"rest is per dialect", "$(1:)", []dialect{nightbotVars}, "$(1:)", []string{"$(1:)"}},
+		{"out of range", "${0} ${10}", []dialect{streamElementsVars}, "${0} ${10}", []string{"${0}", "${10}"}},
+		{"other dialect left alone", "${user}", []dialect{nightbotVars}, "${user}", nil},
+		{"both dialects", "$(user) ${args}", []dialect{nightbotVars, streamElementsVars}, "%USER% %ARGS%", nil},
+		{"unsupported once", "$(weather) $(weather)", []dialect{nightbotVars}, "$(weather) $(weather)", []string{"$(weather)"}},
+		// The outer variable only matches once the inner one's translated, so
+		// it's only found on the second pass
+		{"nested", "$(urlfetch https://example.com/$(query))", []dialect{nightbotVars},
+			"$(urlfetch https://example.com/%ARGS%)", []string{"$(urlfetch https://example.com/%ARGS%)"}},
+		{"nested unsupported", "$(urlfetch $(weather))", []dialect{nightbotVars},
+			"$(urlfetch $(weather))", []string{"$(weather)"}},
+		{"nested across dialects", "${random.pick $(touser)}", []dialect{nightbotVars, streamElementsVars},
+			"${random.pick %ARG1%}", []string{"${random.pick %ARG1%}"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			translated, unsupported := translate(test.text, test.dialects...)
+			if translated != test.translated {
+				t.Errorf("expected %q, got %q", test.translated, translated)
+			}
+			if !reflect.DeepEqual(unsupported, test.unsupported) {
+				t.Errorf("expected %v to be unsupported, got %v", test.unsupported, unsupported)
+			}
+		})
+	}
+}
@@ -6,10 +6,27 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/CactusDev/Xerophi/analytics"
+	"github.com/CactusDev/Xerophi/archive"
+	"github.com/CactusDev/Xerophi/audit"
+	"github.com/CactusDev/Xerophi/batch"
 	"github.com/CactusDev/Xerophi/command"
+	"github.com/CactusDev/Xerophi/event"
+	"github.com/CactusDev/Xerophi/eventlog"
+	"github.com/CactusDev/Xerophi/filter"
+	"github.com/CactusDev/Xerophi/idempotency"
+	"github.com/CactusDev/Xerophi/importer"
+	"github.com/CactusDev/Xerophi/offence"
+	"github.com/CactusDev/Xerophi/purge"
 	"github.com/CactusDev/Xerophi/quote"
+	"github.com/CactusDev/Xerophi/resource"
 	"github.com/CactusDev/Xerophi/rethink"
+	"github.com/CactusDev/Xerophi/revision"
+	"github.com/CactusDev/Xerophi/social"
+	"github.com/CactusDev/Xerophi/stream"
+	"github.com/CactusDev/Xerophi/trust"
 	"github.com/CactusDev/Xerophi/types"
+	"github.com/CactusDev/Xerophi/util"
 
 	"github.com/gin-gonic/gin"
 
@@ -19,6 +36,8 @@ import (
 
 var port int
 var config Config
+var reindexQuotes bool
+var purgeDeleted bool
 
 func init() {
 	var debug, verbose bool
@@ -27,6 +46,8 @@ func init() {
 	flag.BoolVar(&verbose, "verbose", false, "Run the API in verbose mode")
 	flag.BoolVar(&verbose, "v", false, "Run the API in verbose mode")
 	flag.IntVar(&port, "port", 8000, "Specify which port the API will run on")
+	flag.BoolVar(&reindexQuotes, "reindex-quotes", false, "Rebuild the quote search index and exit")
+	flag.BoolVar(&purgeDeleted, "purge-deleted", false, "Remove soft-deleted records past their retention and exit")
 	flag.Parse()
 
 	if debug {
@@ -47,21 +68,33 @@ func init() {
 	config = LoadConfig()
 }
 
-func generateRoutes(h types.Handler, g *gin.RouterGroup) {
+func generateRoutes(h types.Router, g *gin.RouterGroup, trail *audit.Trail,
+	keys *idempotency.Store) {
 	for _, r := range h.Routes() {
 		if !r.Enabled {
 			// Route currently disabled
 			continue
 		}
+		handlers := []gin.HandlerFunc{r.Handler}
+		// Anything that changes something goes in the audit trail
+		if trail != nil && audit.Mutating(r.Verb) && !r.ReadOnly {
+			handlers = append([]gin.HandlerFunc{
+				trail.Middleware(g.BasePath() + r.Path),
+			}, handlers...)
+		}
+		// Creating things is made safe to retry with an Idempotency-Key
+		if keys != nil && r.Verb == "POST" {
+			handlers = append([]gin.HandlerFunc{keys.Middleware()}, handlers...)
+		}
 		switch r.Verb {
 		case "GET":
-			g.GET(r.Path, r.Handler)
+			g.GET(r.Path, handlers...)
 		case "PATCH":
-			g.PATCH(r.Path, r.Handler)
+			g.PATCH(r.Path, handlers...)
 		case "POST":
-			g.POST(r.Path, r.Handler)
+			g.POST(r.Path, handlers...)
 		case "DELETE":
-			g.DELETE(r.Path, r.Handler)
+			g.DELETE(r.Path, handlers...)
 		}
 	}
 }
@@ -95,19 +128,165 @@ func main() {
 		log.Fatal("RethinkDB Connection Failed! - ", err)
 	}
 
-	handlers := map[string]types.Handler{
-		"/user/:token/command": &command.Command{
-			Conn:  &rdbConn,
-			Table: "commands",
+	// Shared with the filters so they can exempt trusted viewers
+	trusted := &trust.Trust{
+		Conn:  &rdbConn,
+		Table: "trusted",
+	}
+
+	// Every change to a command or quote is kept so it can be rolled back
+	history := &revision.Store{
+		DB:    &rdbConn,
+		Table: "revisions",
+	}
+
+	quotes := &quote.Quote{
+		Conn:       &rdbConn,
+		Table:      "quotes",
+		IndexTable: "quoteIndex",
+		History:    history,
+	}
+
+	if reindexQuotes {
+		log.Warn("Rebuilding the quote search index")
+		indexed, err := quotes.Reindex()
+		if err != nil {
+			log.Fatal("Quote reindex failed! - ", err)
+		}
+		log.Infof("Indexed %d quotes", indexed)
+		return
+	}
+
+	// Command usage is rolled up out of the event log
+	stats := &analytics.Stats{
+		DB:    &rdbConn,
+		Table: "commandStats",
+	}
+
+	commands := &command.Command{
+		Conn:    &rdbConn,
+		Table:   "commands",
+		Stats:   stats,
+		History: history,
+	}
+	socials := &social.Social{
+		Conn:  &rdbConn,
+		Table: "socials",
+	}
+	offences := &offence.Offence{
+		Conn:        &rdbConn,
+		Table:       "offences",
+		PolicyTable: "offencePolicies",
+	}
+	filters := &filter.Filter{
+		Conn:  &rdbConn,
+		Table: "filters",
+		Trust: trusted,
+	}
+	events := &event.Event{
+		Conn:  &rdbConn,
+		Table: "events",
+	}
+
+	// Soft-deleted records are kept around for a while so they can be
+	// restored, which goes for everything on the generic resource handler
+	purgeRetention, purgeInterval, err := config.Purge.Durations()
+	if err != nil {
+		log.Fatal("Invalid purge config - ", err)
+	}
+	var purged []string
+	for _, r := range []*resource.Resource{
+		commands.Resource(), quotes.Resource(), socials.Resource(),
+		trusted.Resource(), events.Resource(),
+	} {
+		purged = append(purged, r.Table)
+	}
+	purger := &purge.Purger{
+		DB:        &rdbConn,
+		Tables:    purged,
+		Retention: purgeRetention,
+		Interval:  purgeInterval,
+	}
+
+	if purgeDeleted {
+		log.Warnf("Purging records deleted more than %s ago", purgeRetention)
+		report := purger.Purge()
+		report.Log()
+		if len(report.Errors) > 0 {
+			log.Fatalf("Purge failed for %d tables", len(report.Errors))
+		}
+		log.Infof("Purged %d records", report.Total)
+		return
+	}
+
+	// Everything a channel has can be exported and imported in one go
+	archiver := &archive.Archiver{
+		DB: &rdbConn,
+		Kinds: []archive.Kind{
+			commands.Archive(),
+			quotes.Archive(),
+			socials.Archive(),
+			trusted.Archive(),
+			events.Archive(),
+			filters.Archive(),
+			offences.Archive(),
 		},
-		"/user/:token/quote": &quote.Quote{
-			Conn:  &rdbConn,
-			Table: "quotes",
+		Sources: importer.Sources,
+	}
+
+	// Several commands and quotes can be changed at once, each change is sent
+	// through the router once it's set up
+	batches := &batch.Batch{
+		Resources: map[string]*resource.Resource{
+			"command": commands.Resource(),
+			"quote":   quotes.Resource(),
+		},
+	}
+
+	// Changes to commands, quotes and config are pushed to bots as they happen,
+	// and kept for a while so they can catch up after reconnecting
+	streamRetention, streamInterval, err := config.Stream.Durations()
+	if err != nil {
+		log.Fatal("Invalid stream config - ", err)
+	}
+	journal := &stream.Journal{
+		DB:    &rdbConn,
+		Table: "streamEvents",
+		Topics: []stream.Topic{
+			commands.Topic(),
+			quotes.Topic(),
+			filters.Topic(),
+			offences.Topic(),
 		},
+		Retention: streamRetention,
+		Interval:  streamInterval,
+	}
+	journal.Start()
+
+	handlers := map[string]types.Router{
+		"/user/:token":         archiver,
+		"/user/:token/batch":   batches,
+		"/user/:token/stream":  &stream.Stream{Journal: journal},
+		"/user/:token/command": commands,
+		"/user/:token/quote":   quotes,
+		"/user/:token/social":  socials,
+		"/user/:token/trust":   trusted,
+		"/user/:token/offence": offences,
+		"/user/:token/filter":  filters,
+		"/user/:token/event":   events,
+		"/user/:token/eventlog": &eventlog.Log{
+			DB:    &rdbConn,
+			Table: "eventlog",
+		},
+		"/user/:token/analytics": stats,
 	}
 
 	router := gin.Default()
-	api := router.Group("/api/v2")
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(util.NoRoute)
+	router.NoMethod(util.NoMethod)
+	batches.Handler = router
+	api := router.Group(util.BasePath)
 
 	// Intialize the monitoring/status system
 	monitor := rethink.Status{
@@ -118,16 +297,69 @@ func main() {
 			"cactus": {},
 		},
 		LastUpdated: time.Now(),
+		Jobs: map[string]rethink.Reporter{
+			"purge": purger,
+		},
 	}
 
 	monitor.Monitor(&rdbConn)
 	api.GET("/status", monitor.APIStatusHandler)
 
+	// Keep the event log from growing forever
+	retention, interval, err := config.EventLog.Durations()
+	if err != nil {
+		log.Fatal("Invalid eventlog config - ", err)
+	}
+	pruner := eventlog.Pruner{
+		DB:        &rdbConn,
+		Table:     "eventlog",
+		Retention: retention,
+		Interval:  interval,
+	}
+	pruner.Start()
+	purger.Start()
+
+	rollupInterval, backfill, err := config.Analytics.Durations()
+	if err != nil {
+		log.Fatal("Invalid analytics config - ", err)
+	}
+	rollup := analytics.Rollup{
+		DB:       &rdbConn,
+		LogTable: "eventlog",
+		Table:    "commandStats",
+		Interval: rollupInterval,
+		Since:    time.Now().UTC().Add(-backfill),
+	}
+	rollup.Start()
+
+	trail := &audit.Trail{
+		DB:    &rdbConn,
+		Table: "audit",
+	}
+
+	// Responses to requests with an Idempotency-Key are kept so retries can
+	// be replayed
+	keyTTL, keyInterval, err := config.Idempotency.Durations()
+	if err != nil {
+		log.Fatal("Invalid idempotency config - ", err)
+	}
+	keys := &idempotency.Store{
+		DB:       &rdbConn,
+		Table:    "idempotency",
+		TTL:      keyTTL,
+		Interval: keyInterval,
+	}
+	keys.Start()
+
 	for baseRoute, handler := range handlers {
 		group := api.Group(baseRoute)
-		generateRoutes(handler, group)
+		generateRoutes(handler, group, trail, keys)
 	}
 
+	// Admin endpoints need the admin key from the config
+	admin := api.Group("/admin", util.RequireAdmin(config.Admin.Key))
+	generateRoutes(trail, admin.Group("/audit"), trail, nil)
+
 	router.Run(fmt.Sprintf(":%d", config.Server.Port))
 
 	log.Warnf("API starting on :%d - %s", port, router.BasePath)
@@ -0,0 +1,333 @@
+package offence
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CactusDev/Xerophi/archive"
+	"github.com/CactusDev/Xerophi/rethink"
+	"github.com/CactusDev/Xerophi/stream"
+	"github.com/CactusDev/Xerophi/types"
+	"github.com/CactusDev/Xerophi/util"
+
+	"github.com/gin-gonic/gin"
+
+	mapstruct "github.com/mitchellh/mapstructure"
+	log "github.com/sirupsen/logrus"
+)
+
+// Offence handles recording viewer infractions and deciding what to do about them
+type Offence struct {
+	Conn        *rethink.Connection // The RethinkDB connection
+	Table       string              // The table offences are recorded in
+	PolicyTable string              // The table channel policies are stored in
+}
+
+// Routes returns the routing information for this endpoint
+func (o *Offence) Routes() []types.RouteDetails {
+	return []types.RouteDetails{
+		types.RouteDetails{
+			Enabled: true, Path: "", Verb: "GET",
+			Handler: o.GetPolicy,
+		},
+		types.RouteDetails{
+			Enabled: true, Path: "", Verb: "PATCH",
+			Handler: o.UpdatePolicy,
+		},
+		types.RouteDetails{
+			Enabled: true, Path: "/:viewer", Verb: "GET",
+			Handler: o.GetViewer,
+		},
+		types.RouteDetails{
+			Enabled: true, Path: "/:viewer", Verb: "POST",
+			Handler: o.Record,
+		},
+		types.RouteDetails{
+			Enabled: true, Path: "/:viewer", Verb: "DELETE",
+			Handler: o.Pardon,
+		},
+	}
+}
+
+// Archive describes how the offence policy is exported and imported, a
+// channel only has the one. Offences themselves expire so they aren't kept
+func (o *Offence) Archive() archive.Kind {
+	return archive.Kind{
+		Name:   "offencePolicies",
+		Table:  o.PolicyTable,
+		Schema: "/offence/policySchema.json",
+		Client: Policy{},
+	}
+}
+
+// Topic describes how changes to the escalation policy are sent down the
+// change stream
+func (o *Offence) Topic() stream.Topic {
+	return stream.Topic{
+		Name:  "offencePolicy",
+		Table: o.PolicyTable,
+		Render: func(record map[string]interface{}) (interface{}, error) {
+			var policy Policy
+			if err := mapstruct.Decode(record, &policy); err != nil {
+				return nil, err
+			}
+			id, _ := record["id"].(string)
+			token, _ := record["token"].(string)
+			resource, _ := util.MarshalResource(policyResponse(policy, id, token))
+			return resource, nil
+		},
+	}
+}
+
+// policyResponse is the policy as it's sent out
+func policyResponse(policy Policy, id string, token string) PolicyResponseSchema {
+	return PolicyResponseSchema{
+		ID:      id,
+		Decay:   policy.Decay,
+		Ladders: policy.Ladders,
+		Token:   token,
+	}
+}
+
+// ReturnPolicy retrieves the policy for the channel given, along with the ID
+// of the stored record. Channels without a policy get the default one and an
+// empty ID
+func (o *Offence) ReturnPolicy(token string) (Policy, string, error) {
+	filter := map[string]interface{}{"token": token}
+	fromDB, err := o.Conn.GetByFilter(o.PolicyTable, filter, 1)
+	if err != nil {
+		return DefaultPolicy, "", err
+	}
+	if len(fromDB) == 0 {
+		return DefaultPolicy, "", nil
+	}
+
+	var policy Policy
+	if err = mapstruct.Decode(fromDB[0], &policy); err != nil {
+		return DefaultPolicy, "", err
+	}
+
+	id, _ := fromDB[0].(map[string]interface{})["id"].(string)
+	return policy, id, nil
+}
+
+// ActiveOffences returns the offences that haven't decayed yet for a viewer,
+// optionally only those of a specific type
+func (o *Offence) ActiveOffences(token string, viewer string, offence string) ([]ResponseSchema, error) {
+	query := rethink.Query{
+		Filter: map[string]interface{}{"token": token, "viewer": viewer},
+		Ranges: []rethink.Range{
+			{Field: "expiresAt", Min: time.Now().UTC().Unix()},
+		},
+	}
+	if offence != "" {
+		query.Filter["offence"] = offence
+	}
+
+	fromDB, err := o.Conn.GetByQuery(o.Table, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var offences = make([]ResponseSchema, 0, len(fromDB))
+	for _, record := range fromDB {
+		var decoded ResponseSchema
+		// If there's an issue decoding it, just log it and move on to the next record
+		if err := mapstruct.Decode(record, &decoded); err != nil {
+			log.Error(err.Error())
+			continue
+		}
+		offences = append(offences, decoded)
+	}
+
+	return offences, nil
+}
+
+// GetPolicy returns the escalation policy for the channel
+func (o *Offence) GetPolicy(ctx *gin.Context) {
+	token := strings.ToLower(html.EscapeString(ctx.Param("token")))
+
+	policy, id, err := o.ReturnPolicy(token)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	if id == "" {
+		// Default policies aren't stored anywhere, just use the token
+		id = token
+	}
+
+	ctx.Header("x-total-count", "1")
+	ctx.JSON(http.StatusOK, util.MarshalResponse(policyResponse(policy, id, token)))
+}
+
+// UpdatePolicy updates the channel's escalation policy, creating it from the
+// default policy if the channel doesn't have one yet
+func (o *Offence) UpdatePolicy(ctx *gin.Context) {
+	token := strings.ToLower(html.EscapeString(ctx.Param("token")))
+
+	_, id, err := o.ReturnPolicy(token)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+
+	var policyData map[string]interface{}
+	if id == "" {
+		// Copy the default ladders so the user's ones get layered on top of
+		// them without touching the defaults themselves
+		createVals := PolicyCreationSchema{
+			Policy: Policy{
+				Decay:   DefaultPolicy.Decay,
+				Ladders: make(map[string][]Step),
+			},
+			CreatedAt: time.Now().UTC(),
+			DeletedAt: 0,
+			Token:     token,
+		}
+		for offence, ladder := range DefaultPolicy.Ladders {
+			createVals.Ladders[offence] = ladder
+		}
+		policyData, err = util.ValidateAndMap(
+			ctx.Request.Body, "/offence/policySchema.json", util.Body(createVals))
+	} else {
+		var updateVals PolicyUpdateSchema
+		policyData, err = util.ValidateAndMap(
+			ctx.Request.Body, "/offence/policySchema.json", util.Body(updateVals))
+	}
+
+	if validateErr, ok := err.(util.APIError); !ok && err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	} else if ok {
+		// It's a validation error
+		util.NiceError(ctx, validateErr, http.StatusBadRequest)
+		return
+	}
+
+	if id == "" {
+		_, err = o.Conn.Create(o.PolicyTable, policyData)
+	} else {
+		_, err = o.Conn.Update(o.PolicyTable, id, policyData)
+	}
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+
+	o.GetPolicy(ctx)
+}
+
+// GetViewer returns all the active offences for a viewer
+func (o *Offence) GetViewer(ctx *gin.Context) {
+	token := strings.ToLower(html.EscapeString(ctx.Param("token")))
+	viewer := strings.ToLower(html.EscapeString(ctx.Param("viewer")))
+
+	offences, err := o.ActiveOffences(token, viewer, "")
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	if len(offences) == 0 {
+		util.Abort(ctx, util.ErrNotFound, "No active offences found")
+		return
+	}
+
+	var records = make([]util.JSONAPISchema, len(offences))
+	for pos, offence := range offences {
+		records[pos] = offence
+	}
+
+	ctx.Header("x-total-count", fmt.Sprint(len(records)))
+	ctx.JSON(http.StatusOK, util.MarshalCollection(records))
+}
+
+// Record records a new offence against a viewer and returns the action the
+// bot should take based on the channel's policy
+func (o *Offence) Record(ctx *gin.Context) {
+	token := strings.ToLower(html.EscapeString(ctx.Param("token")))
+	viewer := strings.ToLower(html.EscapeString(ctx.Param("viewer")))
+
+	policy, _, err := o.ReturnPolicy(token)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().UTC()
+	createVals := CreationSchema{
+		CreatedAt: now,
+		DeletedAt: 0,
+		ExpiresAt: now.Add(time.Duration(policy.Decay) * time.Second).Unix(),
+		Token:     token,
+		Viewer:    viewer,
+	}
+
+	createData, err := util.ValidateAndMap(
+		ctx.Request.Body, "/offence/createSchema.json", util.Body(createVals))
+
+	if validateErr, ok := err.(util.APIError); !ok && err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	} else if ok {
+		// It's a validation error
+		util.NiceError(ctx, validateErr, http.StatusBadRequest)
+		return
+	}
+
+	offence := createData["offence"].(string)
+	if _, err := o.Conn.Create(o.Table, createData); err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+
+	// Includes the one we just recorded
+	active, err := o.ActiveOffences(token, viewer, offence)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+
+	step := policy.Evaluate(offence, len(active))
+	response := ActionResponseSchema{
+		ID:       fmt.Sprintf("%s:%s:%d", viewer, offence, len(active)),
+		Action:   step.Action,
+		Count:    len(active),
+		Duration: step.Duration,
+		Offence:  offence,
+		Viewer:   viewer,
+		Token:    token,
+	}
+
+	ctx.Header("x-total-count", "1")
+	ctx.JSON(http.StatusCreated, util.MarshalResponse(response))
+}
+
+// Pardon clears all of a viewer's active offences
+func (o *Offence) Pardon(ctx *gin.Context) {
+	token := strings.ToLower(html.EscapeString(ctx.Param("token")))
+	viewer := strings.ToLower(html.EscapeString(ctx.Param("viewer")))
+
+	// Expired offences are left alone, they've already stopped counting
+	removed, err := o.Conn.DisableByQuery(o.Table, rethink.Query{
+		Filter: map[string]interface{}{"token": token, "viewer": viewer},
+		Ranges: []rethink.Range{
+			{Field: "expiresAt", Min: time.Now().UTC().Unix()},
+		},
+	})
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	if removed == 0 {
+		// Nothing to pardon
+		util.Abort(ctx, util.ErrNotFound, "No active offences to pardon")
+		return
+	}
+
+	ctx.Header("x-total-count", fmt.Sprint(removed))
+	ctx.Status(http.StatusOK)
+}
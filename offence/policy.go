@@ -0,0 +1,66 @@
+package offence
+
+// Offence types that can be recorded against a viewer
+const (
+	Link       = "link"
+	Caps       = "caps"
+	Emote      = "emote"
+	BannedWord = "bannedWord"
+)
+
+// Actions the bot can be told to take
+const (
+	Warn    = "warn"
+	Purge   = "purge"
+	Timeout = "timeout"
+	Ban     = "ban"
+)
+
+// DefaultPolicy is used for any channel that hasn't configured their own
+var DefaultPolicy = Policy{
+	Decay: 86400,
+	Ladders: map[string][]Step{
+		"default": {
+			{Action: Warn},
+			{Action: Purge},
+			{Action: Timeout, Duration: 60},
+			{Action: Timeout, Duration: 600},
+			{Action: Ban},
+		},
+	},
+}
+
+// Policy is a channel's escalation policy
+type Policy struct {
+	Decay   int               `json:"decay"`   // Seconds until an offence stops counting
+	Ladders map[string][]Step `json:"ladders"` // Escalation ladders per offence type
+}
+
+// Step is a single rung on an escalation ladder
+type Step struct {
+	Action   string `json:"action"`
+	Duration int    `json:"duration,omitempty"` // Only used for timeouts, in seconds
+}
+
+// Evaluate returns the step to take for a viewer that now has count active
+// offences of the given type. Offence types without their own ladder fall back
+// to the channel's default ladder, then the API's default ladder. Once a viewer
+// reaches the top of the ladder they stay there
+func (p Policy) Evaluate(offence string, count int) Step {
+	ladder, ok := p.Ladders[offence]
+	if !ok || len(ladder) == 0 {
+		ladder, ok = p.Ladders["default"]
+	}
+	if !ok || len(ladder) == 0 {
+		ladder = DefaultPolicy.Ladders["default"]
+	}
+
+	if count < 1 {
+		count = 1
+	}
+	if count > len(ladder) {
+		count = len(ladder)
+	}
+
+	return ladder[count-1]
+}
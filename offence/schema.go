@@ -0,0 +1,92 @@
+package offence
+
+import (
+	"time"
+
+	"github.com/CactusDev/Xerophi/types"
+	"github.com/CactusDev/Xerophi/util"
+)
+
+// ResponseSchema is the schema for a recorded offence that will be sent out to the client
+type ResponseSchema struct {
+	ID        string `jsonapi:"primary,offence"`
+	CreatedAt string `jsonapi:"meta,createdAt,time"`
+	ExpiresAt int64  `jsonapi:"attr,expiresAt"`
+	Offence   string `jsonapi:"attr,offence"`
+	Viewer    string `jsonapi:"attr,viewer"`
+	Token     string `jsonapi:"meta,token"`
+}
+
+// ActionResponseSchema is the schema for the action the bot should take after
+// an offence has been recorded
+type ActionResponseSchema struct {
+	ID       string `jsonapi:"primary,offenceAction"`
+	Action   string `jsonapi:"attr,action"`
+	Count    int    `jsonapi:"attr,count"`
+	Duration int    `jsonapi:"attr,duration"`
+	Offence  string `jsonapi:"attr,offence"`
+	Viewer   string `jsonapi:"attr,viewer"`
+	Token    string `jsonapi:"meta,token"`
+}
+
+// PolicyResponseSchema is the schema for a channel's escalation policy
+type PolicyResponseSchema struct {
+	ID      string            `jsonapi:"primary,offencePolicy"`
+	Decay   int               `jsonapi:"attr,decay"`
+	Ladders map[string][]Step `jsonapi:"attr,ladders"`
+	Token   string            `jsonapi:"meta,token"`
+}
+
+// ClientSchema is the schema the data from the client will be marshalled into
+type ClientSchema struct {
+	Offence string `json:"offence"`
+}
+
+// CreationSchema is all the data required for a new offence to be recorded
+type CreationSchema struct {
+	ClientSchema
+	// Ignore these fields in user input, they will be filled automatically by the API
+	CreatedAt time.Time `json:"createdAt"`
+	DeletedAt float64   `json:"deletedAt"`
+	ExpiresAt int64     `json:"expiresAt"`
+	Token     string    `json:"token"`
+	Viewer    string    `json:"viewer"`
+}
+
+// PolicyCreationSchema is all the data required for a channel's policy to be stored
+type PolicyCreationSchema struct {
+	Policy
+	// Ignore these fields in user input, they will be filled automatically by the API
+	CreatedAt time.Time `json:"createdAt"`
+	DeletedAt float64   `json:"deletedAt"`
+	Token     string    `json:"token"`
+}
+
+// PolicyUpdateSchema is the schema used when updating an existing policy
+type PolicyUpdateSchema struct {
+	Decay   *int              `json:"decay,omitempty"`
+	Ladders map[string][]Step `json:"ladders,omitempty"`
+}
+
+// JSONAPIMeta returns a meta object for the response
+func (rs ResponseSchema) JSONAPIMeta() *types.Meta {
+	return &types.Meta{
+		"createdAt": rs.CreatedAt,
+		"token":     rs.Token,
+	}
+}
+
+// GetAPITag allows each of these types to implement the JSONAPISchema interface
+func (rs ResponseSchema) GetAPITag(lookup string) string {
+	return util.FieldTag(rs, lookup, "jsonapi")
+}
+
+// GetAPITag allows each of these types to implement the JSONAPISchema interface
+func (ar ActionResponseSchema) GetAPITag(lookup string) string {
+	return util.FieldTag(ar, lookup, "jsonapi")
+}
+
+// GetAPITag allows each of these types to implement the JSONAPISchema interface
+func (pr PolicyResponseSchema) GetAPITag(lookup string) string {
+	return util.FieldTag(pr, lookup, "jsonapi")
+}
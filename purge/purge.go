@@ -0,0 +1,104 @@
+package purge
+
+import (
+	"sync"
+	"time"
+
+	"github.com/CactusDev/Xerophi/rethink"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Report is what a single purge run removed
+type Report struct {
+	Started  time.Time      `json:"started"`
+	Finished time.Time      `json:"finished"`
+	Cutoff   time.Time      `json:"cutoff"`           // Records deleted before this were removed
+	Removed  map[string]int `json:"removed"`          // How many were removed from each table
+	Total    int            `json:"total"`            // How many were removed altogether
+	Errors   []string       `json:"errors,omitempty"` // Any tables that couldn't be purged
+}
+
+// Purger periodically hard-deletes records that were soft-deleted longer ago
+// than the retention period
+type Purger struct {
+	DB        rethink.Database // The storage backend the records are kept in
+	Tables    []string         // The tables that are purged
+	Retention time.Duration    // How long soft-deleted records are kept for
+	Interval  time.Duration    // How often old records are removed
+
+	mutex sync.RWMutex
+	last  *Report
+}
+
+// Purge removes every soft-deleted record older than the retention period
+// from each table. A table that fails doesn't stop the others from being
+// purged, the errors are kept in the report instead
+func (p *Purger) Purge() Report {
+	now := time.Now().UTC()
+	report := Report{
+		Started: now,
+		Cutoff:  now.Add(-p.Retention),
+		Removed: make(map[string]int, len(p.Tables)),
+	}
+
+	for _, table := range p.Tables {
+		removed, err := p.DB.DeleteByQuery(table, rethink.Query{
+			Deleted: rethink.DeletedOnly,
+			Ranges: []rethink.Range{
+				{Field: "deletedAt", Max: report.Cutoff.Unix()},
+			},
+		})
+		if err != nil {
+			log.Errorf("[%s] - Purge failed: %s", table, err)
+			report.Errors = append(report.Errors, table+": "+err.Error())
+			continue
+		}
+		report.Removed[table] = removed
+		report.Total += removed
+	}
+	report.Finished = time.Now().UTC()
+
+	p.mutex.Lock()
+	p.last = &report
+	p.mutex.Unlock()
+
+	return report
+}
+
+// LastRun returns the report from the most recent run, or nil if it hasn't
+// run yet
+func (p *Purger) LastRun() *Report {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.last
+}
+
+// Report allows the purger to be shown on the status endpoint
+func (p *Purger) Report() interface{} {
+	last := p.LastRun()
+	if last == nil {
+		return nil
+	}
+	return last
+}
+
+// Log writes out what a run removed
+func (r Report) Log() {
+	for table, removed := range r.Removed {
+		if removed > 0 {
+			log.Infof("[%s] - Purged %d records deleted before %s",
+				table, removed, r.Cutoff.Format(time.RFC3339))
+		}
+	}
+}
+
+// Start purges the tables in the background every interval
+func (p *Purger) Start() {
+	go func() {
+		for {
+			p.Purge().Log()
+			time.Sleep(p.Interval)
+		}
+	}()
+}
@@ -1,15 +1,17 @@
 package quote
 
 import (
-	"fmt"
 	"html"
 	"math/rand"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
+	"github.com/CactusDev/Xerophi/archive"
+	"github.com/CactusDev/Xerophi/resource"
 	"github.com/CactusDev/Xerophi/rethink"
+	"github.com/CactusDev/Xerophi/revision"
+	"github.com/CactusDev/Xerophi/stream"
 	"github.com/CactusDev/Xerophi/types"
 	"github.com/CactusDev/Xerophi/util"
 
@@ -21,137 +23,114 @@ import (
 
 // Quote is the struct that implements the handler interface for the quote resource
 type Quote struct {
-	Conn  *rethink.Connection // The RethinkDB connection
-	Table string              // The database table we're using
+	Conn       *rethink.Connection // The RethinkDB connection
+	Table      string              // The database table we're using
+	IndexTable string              // The table the search index is kept in
+	History    *revision.Store     // Where changes to quotes are kept
 }
 
-// Routes returns the routing information for this endpoint
-func (q *Quote) Routes() []types.RouteDetails {
-	return []types.RouteDetails{
-		types.RouteDetails{
-			Enabled: true, Path: "", Verb: "GET",
-			Handler: q.GetAll,
-		},
-		types.RouteDetails{
-			Enabled: true, Path: "", Verb: "POST",
-			Handler: q.Create,
-		},
-		types.RouteDetails{
-			Enabled: true, Path: "/:quoteId", Verb: "GET",
-			Handler: q.GetSingle,
+// parseQuoteID converts a quote's number from its route
+func parseQuoteID(raw string) (interface{}, error) {
+	return strconv.Atoi(raw)
+}
+
+// Resource returns the generic handler for quotes, which are keyed by their
+// number
+func (q *Quote) Resource() *resource.Resource {
+	return &resource.Resource{
+		Conn:   q.Conn,
+		Table:  q.Table,
+		Name:   "Quote",
+		Plural: "quotes",
+		Key: resource.Key{
+			Param: "quoteId", Field: "quoteId", Parse: parseQuoteID,
 		},
-		types.RouteDetails{
-			Enabled: true, Path: "/:quoteId", Verb: "PATCH",
-			Handler: q.Update,
+		Schema:       ResponseSchema{},
+		CreateSchema: "/quote/createSchema.json",
+		UpdateSchema: "/quote/schema.json",
+		UpdateBody:   UpdateSchema{},
+		CreatePath:   "",
+		Reserved: map[string]gin.HandlerFunc{
+			"random": q.GetRandom,
+			"search": q.Search,
 		},
-		types.RouteDetails{
-			Enabled: true, Path: "/:quoteId", Verb: "DELETE",
-			Handler: q.Delete,
+		History: q.History,
+		Hooks: resource.Hooks{
+			Defaults: q.defaults,
+			Transform: func(schema util.JSONAPISchema) util.JSONAPISchema {
+				return render(schema.(ResponseSchema))
+			},
+			AfterWrite: func(schema util.JSONAPISchema) {
+				q.reindex(schema.(ResponseSchema))
+			},
+			AfterDelete: func(id string) {
+				if err := q.unindexQuote(id); err != nil {
+					log.Errorf("[%s] - Failed to unindex quote %s: %s", q.Table, id, err)
+				}
+			},
 		},
 	}
 }
 
-// ReturnOne retrieves a single record given the filter provided
-func (q *Quote) ReturnOne(filter map[string]interface{}) (ResponseSchema, error) {
-	var response ResponseSchema
-
-	// Retrieve a single record from the DB based on the filter
-	fromDB, err := q.Conn.GetSingle(filter, q.Table)
-	if err != nil {
-		return response, err
-	}
-	// Was anything returned?
-	if fromDB == nil {
-		// Return nothing, it's not an error but there's nothing there
-		return response, rethink.RetrievalResult{
-			Success: false, SoftDeleted: false, Message: ""}
-	}
-
-	// Decode the response from the DB into the response schema object
-	if err = mapstruct.Decode(fromDB, &response); err != nil {
-		return response, err
-	}
-
-	if fromDB.(map[string]interface{})["deletedAt"].(float64) != 0 {
-		return response, rethink.RetrievalResult{true, true, ""}
-	}
-
-	return response, rethink.RetrievalResult{true, false, ""}
+// Routes returns the routing information for this endpoint
+func (q *Quote) Routes() []types.RouteDetails {
+	return q.Resource().Routes()
 }
 
-// GetAll returns all records associated with the token
-func (q *Quote) GetAll(ctx *gin.Context) {
-	// Get parameter values
-	token := html.EscapeString(ctx.Param("token"))
-	filter := map[string]interface{}{"token": token}
-
-	// Get all the records that match our filter
-	fromDB, err := q.Conn.GetByFilter(q.Table, filter, 0)
-	if err != nil {
-		util.NiceError(ctx, err, http.StatusBadRequest)
-		return
-	}
-	if fromDB == nil {
-		ctx.JSON(http.StatusNotFound, make([]struct{}, 0))
-		return
-	}
-
-	var respDecode ResponseSchema
-	var decoded = make([]map[string]interface{}, len(fromDB))
-	for pos, record := range fromDB {
-		// If there's an issue decoding it, just log it and move on to the next record
-		if err := mapstruct.Decode(record, &respDecode); err != nil {
-			log.Error(err.Error())
-			continue
-		}
-		marshalled := util.MarshalResponse(respDecode)
-		decoded[pos] = map[string]interface{}{
-			"id":         marshalled["data"].(map[string]interface{})["id"],
-			"attributes": marshalled["data"].(map[string]interface{})["attributes"],
-			"meta":       marshalled["meta"],
-		}
+// Archive describes how quotes are exported and imported. The search index
+// is rebuilt for the channel afterwards
+func (q *Quote) Archive() archive.Kind {
+	return archive.Kind{
+		Name:     "quotes",
+		Table:    q.Table,
+		Key:      []string{"quoteId"},
+		Parse:    map[string]func(string) (interface{}, error){"quoteId": parseQuoteID},
+		Schema:   "/quote/createSchema.json",
+		Client:   ClientSchema{},
+		Keep:     []string{"enabled"},
+		Defaults: map[string]interface{}{"enabled": true},
+		Sequence: "quoteId",
+		AfterImport: func(token string) error {
+			_, err := q.ReindexToken(token)
+			return err
+		},
+		History:  q.History,
+		Resource: "quote",
 	}
-	var response = make(map[string]interface{})
-
-	response["data"] = decoded
-
-	ctx.Header("x-total-count", fmt.Sprint(len(decoded)))
-	ctx.JSON(http.StatusOK, response)
 }
 
-// GetSingle returns a single record
-func (q *Quote) GetSingle(ctx *gin.Context) {
-	token := html.EscapeString(ctx.Param("token"))
-	filter := map[string]interface{}{"token": token}
-
-	if ctx.Param("quoteId") == "random" {
-		q.GetRandom(ctx)
-		return
-	}
+// Topic describes how changes to quotes are sent down the change stream
+func (q *Quote) Topic() stream.Topic {
+	return q.Resource().Topic()
+}
 
-	quoteID, err := strconv.Atoi(ctx.Param("quoteId"))
-	if err != nil {
-		util.NiceError(ctx, err, http.StatusBadRequest)
-		return
+// defaults are the values a new quote starts with
+func (q *Quote) defaults(ctx *gin.Context, token string) (interface{}, interface{}, error) {
+	createVals := CreationSchema{
+		CreatedAt: time.Now().UTC(),
+		DeletedAt: 0,
+		Token:     token,
+		QuoteID:   rand.Intn(10),
+		Enabled:   true,
+		// QuoteID: nextQuoteNum from user object for :token
 	}
-	filter["quoteId"] = quoteID
+	return createVals, createVals.QuoteID, nil
+}
 
-	res, err := q.ReturnOne(filter)
-	retRes, ok := err.(rethink.RetrievalResult)
-	// If !ok AND then err != nil then we have an actual error and not a RetRes
-	if !ok && err != nil {
-		util.NiceError(ctx, err, http.StatusInternalServerError)
-		return
-	}
+// render fills in the fields that aren't stored
+func render(quote ResponseSchema) ResponseSchema {
+	quote.Rendered = quote.Render()
+	return quote
+}
 
-	if retRes.Success && !retRes.SoftDeleted {
-		ctx.Header("x-total-count", "1")
-		ctx.JSON(http.StatusOK, util.MarshalResponse(res))
-		return
+// decodeQuote decodes a record from the DB and fills in the fields that
+// aren't stored
+func decodeQuote(record interface{}) (ResponseSchema, error) {
+	var quote ResponseSchema
+	if err := mapstruct.Decode(record, &quote); err != nil {
+		return quote, err
 	}
-
-	// None were found Jim, 404 that boyo
-	ctx.AbortWithStatus(http.StatusNotFound)
+	return render(quote), nil
 }
 
 // GetRandom retrieves a random quote if any exist
@@ -167,10 +146,11 @@ func (q *Quote) GetRandom(ctx *gin.Context) {
 	}
 	// None exist that match the filter, oh well
 	if fromDB == nil {
-		ctx.AbortWithStatus(http.StatusNotFound)
+		util.Abort(ctx, util.ErrNotFound, "No quotes found")
+		return
 	}
 	// We made it past the checks, at least one exists, return that
-	if err = mapstruct.Decode(fromDB, &resp); err != nil {
+	if resp, err = decodeQuote(fromDB); err != nil {
 		util.NiceError(ctx, err, http.StatusInternalServerError)
 		return
 	}
@@ -178,171 +158,3 @@ func (q *Quote) GetRandom(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, util.MarshalResponse(resp))
 	return
 }
-
-// Create creates a new record
-func (q *Quote) Create(ctx *gin.Context) {
-	// Declare default values
-	createVals := CreationSchema{
-		CreatedAt: time.Now().UTC(),
-		DeletedAt: 0,
-		Token:     strings.ToLower(html.EscapeString(ctx.Param("token"))),
-		QuoteID:   rand.Intn(10),
-		Enabled:   true,
-		// QuoteID: nextQuoteNum from user object for :token
-	}
-
-	// // Check if it exists yet
-	filter := map[string]interface{}{
-		"token": createVals.Token, "quoteId": createVals.QuoteID}
-	res, err := q.ReturnOne(filter)
-
-	// If !ok AND then err != nil then we have an actual error and not a RetRes
-	if retRes, ok := err.(rethink.RetrievalResult); !ok && err != nil {
-		util.NiceError(ctx, err, http.StatusInternalServerError)
-		return
-	} else if retRes.Success {
-		if !retRes.SoftDeleted {
-			// It exists already but isn't soft-deleted, error out
-			// can't edit from this endpoint
-			ctx.AbortWithStatusJSON(http.StatusConflict, util.MarshalResponse(res))
-			return
-		}
-		// It exists and is soft-deleted. Remove that one and then create a new one
-		_, err := q.Conn.Delete(q.Table, res.ID)
-		if err != nil {
-			util.NiceError(ctx, err, http.StatusInternalServerError)
-			return
-		}
-	}
-
-	// No records already exist that match, go ahead with creation
-	// Passed validation, put in the user data & prepare the data we're using
-	createData, err := util.ValidateAndMap(
-		ctx.Request.Body, "/quote/createSchema.json", createVals)
-
-	if validateErr, ok := err.(util.APIError); !ok && err != nil {
-		util.NiceError(ctx, err, http.StatusInternalServerError)
-		return
-	} else if ok {
-		// It's a validation error
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, validateErr.Data)
-	}
-
-	// Attempt to create the new resource
-	if _, err := q.Conn.Create(q.Table, createData); err != nil {
-		util.NiceError(ctx, err, http.StatusBadRequest)
-		return
-	}
-
-	// Retrieve the newly created record
-	res, err = q.ReturnOne(filter)
-	// If !ok AND then err != nil then we have an actual error and not a RetRes
-	if _, ok := err.(rethink.RetrievalResult); !ok && err != nil {
-		util.NiceError(ctx, err, http.StatusInternalServerError)
-		return
-	}
-
-	// Aaaand success
-	ctx.Header("x-total-count", "1")
-	ctx.JSON(http.StatusCreated, util.MarshalResponse(res))
-}
-
-// Update handles the updating of a record if the record exists
-func (q *Quote) Update(ctx *gin.Context) {
-	// Get the data we need from the request
-	token := strings.ToLower(html.EscapeString(ctx.Param("token")))
-
-	// Check if the resource that we want to edit exists
-	filter := map[string]interface{}{"token": token}
-	quoteID, err := strconv.Atoi(ctx.Param("quoteId"))
-	if err != nil {
-		util.NiceError(ctx, err, http.StatusBadRequest)
-		return
-	}
-	filter["quoteId"] = quoteID
-	resp, err := q.ReturnOne(filter)
-
-	if retRes, ok := err.(rethink.RetrievalResult); !ok && err != nil {
-		util.NiceError(ctx, err, http.StatusInternalServerError)
-		return
-	} else if retRes.Success && retRes.SoftDeleted {
-		// Record "doesn't exist", abort with a 404
-		ctx.AbortWithStatus(http.StatusNotFound)
-		return
-	}
-
-	// Made it past the checks, record exists
-	// Passed validation, put in the user data & prepare the data we're using
-	var updateVals UpdateSchema
-	updateData, err := util.ValidateAndMap(
-		ctx.Request.Body, "/quote/schema.json", updateVals)
-
-	if validateErr, ok := err.(util.APIError); !ok && err != nil {
-		util.NiceError(ctx, err, http.StatusInternalServerError)
-		return
-	} else if ok {
-		// It's a validation error
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, validateErr.Data)
-	}
-
-	// Attempt to update the new resource
-	_, err = q.Conn.Update(q.Table, resp.ID, updateData)
-	if err != nil {
-		util.NiceError(ctx, err, http.StatusInternalServerError)
-		return
-	}
-
-	// Retrieve the newly updated record
-	response, err := q.ReturnOne(filter)
-	// If !ok AND then err != nil then we have an actual error and not a RetRes
-	if _, ok := err.(rethink.RetrievalResult); !ok && err != nil {
-		util.NiceError(ctx, err, http.StatusInternalServerError)
-		return
-	}
-
-	// Success
-	ctx.Header("x-total-count", "1")
-	ctx.JSON(http.StatusOK, util.MarshalResponse(response))
-}
-
-// Delete soft-deletes a record
-func (q *Quote) Delete(ctx *gin.Context) {
-	token := strings.ToLower(html.EscapeString(ctx.Param("token")))
-	filter := map[string]interface{}{"token": token}
-	// Convert the quoteId parameter to an int
-	quoteID, err := strconv.Atoi(ctx.Param("quoteId"))
-	if err != nil {
-		util.NiceError(ctx, err, http.StatusBadRequest)
-		return
-	}
-	filter["quoteId"] = quoteID
-	resp, err := q.Conn.GetByFilter(q.Table, filter, 1)
-
-	if err != nil {
-		util.NiceError(ctx, err, http.StatusBadRequest)
-		return
-	}
-	if resp == nil {
-		// Resource doesn't exist, return a 404
-		ctx.AbortWithStatus(http.StatusNotFound)
-		return
-	}
-
-	rs, valid := resp[0].(map[string]interface{})
-	if !valid {
-		log.Errorf("[%s] - Unable to typecast response to correct type", q.Table)
-		ctx.AbortWithStatus(http.StatusInternalServerError)
-		return
-	}
-
-	// Soft-delete the record
-	_, err = q.Conn.Disable(q.Table, rs["id"].(string))
-	if err != nil {
-		util.NiceError(ctx, err, http.StatusInternalServerError)
-		return
-	}
-
-	// Success
-	ctx.Header("x-resource-id-removed", rs["id"].(string))
-	ctx.Status(http.StatusOK)
-}
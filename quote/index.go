@@ -0,0 +1,134 @@
+package quote
+
+import (
+	"github.com/CactusDev/Xerophi/rethink"
+
+	mapstruct "github.com/mitchellh/mapstructure"
+	log "github.com/sirupsen/logrus"
+)
+
+// indexEntry is a single term of a quote in the search index. There's one
+// entry for each unique term in each quote
+type indexEntry struct {
+	ID      string `mapstructure:"id"`
+	Token   string `mapstructure:"token"`
+	Quote   string `mapstructure:"quote"` // The ID of the quote record
+	QuoteID int    `mapstructure:"quoteId"`
+	Term    string `mapstructure:"term"`
+	Count   int    `mapstructure:"count"` // Times the term appears in the quote
+}
+
+// lookupTerms finds the quotes that contain any of the terms, along with how
+// many quotes each term appears in
+func (q *Quote) lookupTerms(token string, terms []string) (map[string]int, []interface{}, error) {
+	values := make([]interface{}, len(terms))
+	for i, term := range terms {
+		values[i] = term
+	}
+
+	fromDB, err := q.Conn.GetByQuery(q.IndexTable, rethink.Query{
+		Filter: map[string]interface{}{"token": token},
+		In:     map[string][]interface{}{"term": values},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	docFreq := make(map[string]int)
+	seen := make(map[string]bool)
+	var candidates []interface{}
+	for _, record := range fromDB {
+		var entry indexEntry
+		if err := mapstruct.Decode(record, &entry); err != nil {
+			log.Error(err.Error())
+			continue
+		}
+		docFreq[entry.Term]++
+		if !seen[entry.Quote] {
+			seen[entry.Quote] = true
+			candidates = append(candidates, entry.Quote)
+		}
+	}
+
+	return docFreq, candidates, nil
+}
+
+// indexQuote replaces whatever is in the index for the quote with its
+// current terms
+func (q *Quote) indexQuote(quote ResponseSchema) error {
+	if err := q.unindexQuote(quote.ID); err != nil {
+		return err
+	}
+
+	for term, count := range termCounts(quote.Quote) {
+		_, err := q.Conn.Upsert(q.IndexTable, map[string]interface{}{
+			"id":      quote.ID + ":" + term,
+			"token":   quote.Token,
+			"quote":   quote.ID,
+			"quoteId": quote.QuoteID,
+			"term":    term,
+			"count":   count,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unindexQuote removes the quote from the search index
+func (q *Quote) unindexQuote(id string) error {
+	_, err := q.Conn.DeleteByQuery(q.IndexTable, rethink.Query{
+		Filter: map[string]interface{}{"quote": id},
+	})
+	return err
+}
+
+// reindex keeps the index up to date after a quote has been written. The
+// write itself already succeeded, so failures are only logged
+func (q *Quote) reindex(quote ResponseSchema) {
+	if err := q.indexQuote(quote); err != nil {
+		log.Errorf("[%s] - Failed to index quote %s: %s", q.Table, quote.ID, err)
+	}
+}
+
+// Reindex throws away the whole search index and rebuilds it from the quotes
+// in the database, returning how many quotes were indexed
+func (q *Quote) Reindex() (int, error) {
+	return q.rebuild(nil)
+}
+
+// ReindexToken rebuilds the search index for a single channel's quotes,
+// returning how many were indexed
+func (q *Quote) ReindexToken(token string) (int, error) {
+	return q.rebuild(map[string]interface{}{"token": token})
+}
+
+// rebuild throws away the index for the quotes matching the filter and
+// rebuilds it from the database
+func (q *Quote) rebuild(filter map[string]interface{}) (int, error) {
+	if _, err := q.Conn.DeleteByQuery(q.IndexTable, rethink.Query{Filter: filter}); err != nil {
+		return 0, err
+	}
+
+	fromDB, err := q.Conn.GetByQuery(q.Table, rethink.Query{Filter: filter})
+	if err != nil {
+		return 0, err
+	}
+
+	var indexed int
+	for _, record := range fromDB {
+		var quote ResponseSchema
+		if err := mapstruct.Decode(record, &quote); err != nil {
+			log.Error(err.Error())
+			continue
+		}
+		if err := q.indexQuote(quote); err != nil {
+			return indexed, err
+		}
+		indexed++
+	}
+
+	return indexed, nil
+}
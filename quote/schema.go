@@ -2,6 +2,9 @@ package quote
 
 import (
 	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/CactusDev/Xerophi/types"
@@ -11,16 +14,26 @@ import (
 // ResponseSchema is the schema for the data that will be sent out to the client
 type ResponseSchema struct {
 	ID        string `jsonapi:"primary,quote"`
-	CreatedAt string `jsonapi:"meta,createdAt"`
-	Enabled   bool   `jsonapi:"attr,enabled"`
-	QuoteID   int    `jsonapi:"attr,quoteId"`
-	Quote     string `jsonapi:"attr,quote"`
+	CreatedAt string `jsonapi:"meta,createdAt,time" filter:"gt,gte,lt,lte"`
+	Enabled   bool   `jsonapi:"attr,enabled" filter:"eq"`
+	QuoteID   int    `jsonapi:"attr,quoteId" filter:"eq,gt,gte,lt,lte"`
+	Quote     string `jsonapi:"attr,quote" filter:"eq,prefix,contains"`
+	Speaker   string `jsonapi:"attr,speaker" filter:"eq,prefix,contains"`
+	AddedBy   string `jsonapi:"attr,addedBy" filter:"eq"`
+	Game      string `jsonapi:"attr,game" filter:"eq,prefix,contains"`
+	Date      string `jsonapi:"attr,date" filter:"eq,gt,gte,lt,lte"`
+	Rendered  string `jsonapi:"attr,rendered" mapstructure:"-"`
 	Token     string `jsonapi:"meta,token"`
+	Version   int    `jsonapi:"meta,version"`
 }
 
 // ClientSchema is the schema the data from the client will be marshalled into
 type ClientSchema struct {
-	Quote string `json:"quote"`
+	Quote   string `json:"quote"`
+	Speaker string `json:"speaker"` // Who said it
+	AddedBy string `json:"addedBy"` // Who added it
+	Game    string `json:"game"`    // The game or category being played at the time
+	Date    string `json:"date"`    // The date of the stream, YYYY-MM-DD
 }
 
 // CreationSchema is all the data required for a new quote to be created
@@ -34,10 +47,16 @@ type CreationSchema struct {
 	Enabled   bool      `json:"enabled"`
 }
 
-// UpdateSchema is ClientSchema that is used when updating
+// UpdateSchema is ClientSchema that is used when updating. The attribution
+// is kept raw so that it can be cleared with null or "", a *string can't tell
+// null apart from the field being left out
 type UpdateSchema struct {
-	Quote   string `json:"quote,omitempty"`
-	Enabled bool   `json:"enabled,omitempty"`
+	Quote   string          `json:"quote,omitempty"`
+	Enabled *bool           `json:"enabled,omitempty"`
+	Speaker json.RawMessage `json:"speaker,omitempty"`
+	AddedBy json.RawMessage `json:"addedBy,omitempty"`
+	Game    json.RawMessage `json:"game,omitempty"`
+	Date    json.RawMessage `json:"date,omitempty"`
 }
 
 // GetAPITag allows each of these types to implement the JSONAPISchema interface
@@ -55,78 +74,38 @@ func (us UpdateSchema) GetAPITag(lookup string) string {
 	return util.FieldTag(us, lookup, "jsonapi")
 }
 
-// JSONAPIMeta returns a meta object for the response
-func (rs ResponseSchema) JSONAPIMeta() *types.Meta {
-	return &types.Meta{
-		"createdAt": rs.CreatedAt,
-		"token":     rs.Token,
+// Render formats the quote along with whatever attribution it has, like
+// "..." - Person, 2026-03-01 playing Game
+func (rs ResponseSchema) Render() string {
+	var attribution []string
+	if rs.Speaker != "" {
+		attribution = append(attribution, rs.Speaker)
 	}
-}
-
-// DumpBody dumps the body data bytes into this specific schema and returns
-// the bytes from this
-func (cs CreationSchema) DumpBody(data []byte) ([]byte, error) {
-	// Unmarshal the byte slice into the provided schema
-	if err := json.Unmarshal(data, &cs); err != nil {
-		return nil, err
+	if rs.Date != "" {
+		attribution = append(attribution, rs.Date)
 	}
-
-	// Marshal the unmarshalled byte slice back into a byte array
-	schemaBytes, err := json.Marshal(cs)
-	if err != nil {
-		return nil, err
-	}
-
-	return schemaBytes, nil
-}
-
-// DumpBody dumps the body data bytes into this specific schema and returns
-// the bytes from this
-func (rs ResponseSchema) DumpBody(data []byte) ([]byte, error) {
-	// Unmarshal the byte slice into the provided schema
-	if err := json.Unmarshal(data, &rs); err != nil {
-		return nil, err
+	credit := strings.Join(attribution, ", ")
+	if rs.Game != "" {
+		credit = strings.TrimSpace(credit + " playing " + rs.Game)
 	}
 
-	// Marshal the unmarshalled byte slice back into a byte array
-	schemaBytes, err := json.Marshal(rs)
-	if err != nil {
-		return nil, err
+	rendered := fmt.Sprintf("\"%s\"", rs.Quote)
+	if credit != "" {
+		rendered += " - " + credit
 	}
-
-	return schemaBytes, nil
+	return rendered
 }
 
-// DumpBody dumps the body data bytes into this specific schema and returns
-// the bytes from this
-func (cs ClientSchema) DumpBody(data []byte) ([]byte, error) {
-	// Unmarshal the byte slice into the provided schema
-	if err := json.Unmarshal(data, &cs); err != nil {
-		return nil, err
-	}
-
-	// Marshal the unmarshalled byte slice back into a byte array
-	schemaBytes, err := json.Marshal(cs)
-	if err != nil {
-		return nil, err
-	}
-
-	return schemaBytes, nil
+// SelfLink returns the URL the quote can be retrieved from
+func (rs ResponseSchema) SelfLink() string {
+	return util.ResourceLink(rs.Token, "quote", strconv.Itoa(rs.QuoteID))
 }
 
-// DumpBody dumps the body data bytes into this specific schema and returns
-// the bytes from this
-func (us UpdateSchema) DumpBody(data []byte) ([]byte, error) {
-	// Unmarshal the byte slice into the provided schema
-	if err := json.Unmarshal(data, &us); err != nil {
-		return nil, err
-	}
-
-	// Marshal the unmarshalled byte slice back into a byte array
-	schemaBytes, err := json.Marshal(us)
-	if err != nil {
-		return nil, err
+// JSONAPIMeta returns a meta object for the response
+func (rs ResponseSchema) JSONAPIMeta() *types.Meta {
+	return &types.Meta{
+		"createdAt": rs.CreatedAt,
+		"token":     rs.Token,
+		"version":   rs.Version,
 	}
-
-	return schemaBytes, nil
 }
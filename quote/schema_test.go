@@ -0,0 +1,37 @@
+package quote
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/CactusDev/Xerophi/util"
+)
+
+func TestUpdateClearsAttribution(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want map[string]interface{}
+	}{
+		{"left out", `{"quote": "hi"}`, map[string]interface{}{"quote": "hi"}},
+		{"null", `{"speaker": null}`, map[string]interface{}{"speaker": nil}},
+		{"empty", `{"game": ""}`, map[string]interface{}{"game": ""}},
+		{"set", `{"date": "2026-03-01", "addedBy": null}`,
+			map[string]interface{}{"date": "2026-03-01", "addedBy": nil}},
+	}
+
+	for _, test := range tests {
+		dumped, err := util.Body(UpdateSchema{}).DumpBody([]byte(test.body))
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		var got map[string]interface{}
+		if err := json.Unmarshal(dumped, &got); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package quote
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/CactusDev/Xerophi/rethink"
+	"github.com/CactusDev/Xerophi/util"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/unicode/norm"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultSearchLimit = 25
+	maxSearchLimit     = 100
+	maxSearchTerms     = 16
+)
+
+// Span is the location of a match in the quote, in characters
+type Span struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// word is a single token of a piece of text along with where it was found
+type word struct {
+	Term string // The folded form that gets indexed and matched on
+	Span Span
+}
+
+// fold lowercases the text and strips any accents off it, so "Café" and
+// "cafe" are treated as the same term
+func fold(text string) string {
+	var folded strings.Builder
+	for _, char := range norm.NFD.String(text) {
+		if unicode.Is(unicode.Mn, char) {
+			continue
+		}
+		folded.WriteRune(unicode.ToLower(char))
+	}
+	return folded.String()
+}
+
+// tokenize splits the text into words. Letters and numbers make up words,
+// apostrophes inside of a word are dropped so "don't" is found by "dont"
+func tokenize(text string) []word {
+	var words []word
+	var current []rune
+	start, pos := 0, 0
+
+	flush := func() {
+		if len(current) > 0 {
+			if term := fold(string(current)); term != "" {
+				words = append(words, word{Term: term, Span: Span{start, pos}})
+			}
+		}
+		current = current[:0]
+	}
+
+	for _, char := range text {
+		switch {
+		case unicode.IsLetter(char) || unicode.IsNumber(char) || unicode.Is(unicode.Mn, char):
+			if len(current) == 0 {
+				start = pos
+			}
+			current = append(current, char)
+		case (char == '\'' || char == '’') && len(current) > 0:
+			// Skip it, but keep the word going
+		default:
+			flush()
+		}
+		pos++
+	}
+	flush()
+
+	return words
+}
+
+// termCounts returns how many times each term appears in the text
+func termCounts(text string) map[string]int {
+	counts := make(map[string]int)
+	for _, w := range tokenize(text) {
+		counts[w.Term]++
+	}
+	return counts
+}
+
+// queryTerms returns the unique terms in the search query, in order
+func queryTerms(query string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, w := range tokenize(query) {
+		if seen[w.Term] {
+			continue
+		}
+		seen[w.Term] = true
+		terms = append(terms, w.Term)
+	}
+	return terms
+}
+
+// highlight returns the spans of every word in the text that is one of the terms
+func highlight(text string, terms map[string]bool) []Span {
+	spans := make([]Span, 0)
+	for _, w := range tokenize(text) {
+		if !terms[w.Term] {
+			continue
+		}
+		// Merge matches that are only separated by whitespace into one span
+		if last := len(spans) - 1; last >= 0 && onlySpaces(text, spans[last].End, w.Span.Start) {
+			spans[last].End = w.Span.End
+			continue
+		}
+		spans = append(spans, w.Span)
+	}
+	return spans
+}
+
+// onlySpaces checks if the characters between start and end are all whitespace
+func onlySpaces(text string, start int, end int) bool {
+	pos := 0
+	for _, char := range text {
+		if pos >= end {
+			break
+		}
+		if pos >= start && !unicode.IsSpace(char) {
+			return false
+		}
+		pos++
+	}
+	return true
+}
+
+// score ranks a quote against the query. Each matched term is weighted by how
+// rare it is across all of the channel's quotes, and quotes matching more of
+// the query always rank above those matching less of it
+func score(counts map[string]int, terms []string, docFreq map[string]int, total int) float64 {
+	var matched int
+	var weight float64
+	for _, term := range terms {
+		tf := counts[term]
+		if tf == 0 {
+			continue
+		}
+		matched++
+		idf := math.Log(1 + float64(total)/float64(docFreq[term]))
+		weight += idf * (1 + math.Log(float64(tf)))
+	}
+	if matched == 0 {
+		return 0
+	}
+
+	length := 0
+	for _, count := range counts {
+		length += count
+	}
+	// Favour shorter quotes slightly when the match is otherwise the same
+	weight /= math.Sqrt(math.Max(float64(length), 1))
+
+	return float64(matched) + weight/(1+weight)
+}
+
+// Search finds the quotes that contain the words in the query, best match first
+func (q *Quote) Search(ctx *gin.Context) {
+	token := strings.ToLower(html.EscapeString(ctx.Param("token")))
+
+	terms := queryTerms(ctx.Query("q"))
+	if len(terms) == 0 {
+		util.NiceError(ctx, util.InvalidParameter("q",
+			"Search query must contain at least one word"), http.StatusBadRequest)
+		return
+	}
+	if len(terms) > maxSearchTerms {
+		util.NiceError(ctx, util.InvalidParameter("q",
+			"Search query can't have more than %d words", maxSearchTerms), http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultSearchLimit
+	if raw := ctx.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > maxSearchLimit {
+			util.NiceError(ctx, util.InvalidParameter("limit",
+				"limit must be between 1 and %d", maxSearchLimit), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	docFreq, candidates, err := q.lookupTerms(token, terms)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	if len(candidates) == 0 {
+		util.Abort(ctx, util.ErrNotFound, "No quotes matched the search")
+		return
+	}
+
+	total, err := q.Conn.CountByQuery(q.Table, rethink.Query{
+		Filter: map[string]interface{}{"token": token}})
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+
+	// The index only narrows things down, the live quotes are what get ranked
+	fromDB, err := q.Conn.GetByFilterIn(q.Table,
+		map[string]interface{}{"token": token}, "id", candidates)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+
+	type result struct {
+		quote ResponseSchema
+		score float64
+	}
+	var results []result
+	for _, record := range fromDB {
+		quote, err := decodeQuote(record)
+		if err != nil {
+			log.Error(err.Error())
+			continue
+		}
+		if s := score(termCounts(quote.Quote), terms, docFreq, total); s > 0 {
+			results = append(results, result{quote, s})
+		}
+	}
+	if len(results) == 0 {
+		util.Abort(ctx, util.ErrNotFound, "No quotes matched the search")
+		return
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		return results[i].quote.QuoteID < results[j].quote.QuoteID
+	})
+
+	matched := len(results)
+	if matched > limit {
+		results = results[:limit]
+	}
+
+	lookup := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		lookup[term] = true
+	}
+	var records = make([]util.JSONAPISchema, len(results))
+	for pos, res := range results {
+		records[pos] = res.quote
+	}
+	response := util.MarshalCollection(records)
+	for pos, resource := range response["data"].([]map[string]interface{}) {
+		meta, _ := resource["meta"].(map[string]interface{})
+		if meta == nil {
+			meta = make(map[string]interface{})
+		}
+		meta["score"] = math.Round(results[pos].score*1000) / 1000
+		meta["highlights"] = highlight(results[pos].quote.Quote, lookup)
+		resource["meta"] = meta
+	}
+	response["meta"] = map[string]interface{}{
+		"total": matched,
+		"terms": terms,
+	}
+
+	ctx.Header("x-total-count", fmt.Sprint(matched))
+	ctx.JSON(http.StatusOK, response)
+}
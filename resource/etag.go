@@ -0,0 +1,105 @@
+package resource
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/CactusDev/Xerophi/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// etag returns the entity tag for the record, which is its version quoted.
+// Returns "" if the schema doesn't have a version
+func etag(schema util.JSONAPISchema) string {
+	resource, _ := util.MarshalResource(schema)
+	meta, _ := resource["meta"].(map[string]interface{})
+	version, ok := meta["version"]
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%q", fmt.Sprint(version))
+}
+
+// splitTags splits a list of entity tags from a conditional header
+func splitTags(header string) []string {
+	var tags []string
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// ifMatch returns the versions the If-Match header allows the record to be at,
+// or nil if it's not set or matches any version. If-Match uses the strong
+// comparison, so weak tags never match anything
+func ifMatch(ctx *gin.Context) ([]int, error) {
+	header := ctx.GetHeader("If-Match")
+	if header == "" {
+		return nil, nil
+	}
+
+	var versions = make([]int, 0)
+	for _, tag := range splitTags(header) {
+		if tag == "*" {
+			return nil, nil
+		}
+		weak := strings.HasPrefix(tag, "W/")
+		opaque := strings.TrimPrefix(tag, "W/")
+		if len(opaque) < 2 || !strings.HasPrefix(opaque, `"`) || !strings.HasSuffix(opaque, `"`) {
+			return nil, fmt.Errorf("Invalid entity tag %s", tag)
+		}
+		version, err := strconv.Atoi(opaque[1 : len(opaque)-1])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid entity tag %s", tag)
+		}
+		if !weak {
+			versions = append(versions, version)
+		}
+	}
+	return versions, nil
+}
+
+// notModified returns if the If-None-Match header already has the current
+// entity tag, so the record doesn't need sending again
+func notModified(ctx *gin.Context, current string) bool {
+	header := ctx.GetHeader("If-None-Match")
+	if header == "" || current == "" {
+		return false
+	}
+	// If-None-Match uses the weak comparison, so weak tags match too
+	for _, tag := range splitTags(header) {
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == current {
+			return true
+		}
+	}
+	return false
+}
+
+// respond sends a single record along with its entity tag
+func (r *Resource) respond(ctx *gin.Context, status int, response util.JSONAPISchema) {
+	if tag := etag(response); tag != "" {
+		ctx.Header("ETag", tag)
+	}
+	ctx.Header("x-total-count", "1")
+	ctx.JSON(status, util.MarshalResponse(response))
+}
+
+// preconditionFailed ends the request because the record isn't at the version
+// the client expected
+func (r *Resource) preconditionFailed(ctx *gin.Context) {
+	util.Abort(ctx, util.ErrPrecondition, r.Name+" has been changed since it was retrieved")
+}
+
+// checkPrecondition parses If-Match, ending the request if it's malformed
+func (r *Resource) checkPrecondition(ctx *gin.Context) ([]int, bool) {
+	match, err := ifMatch(ctx)
+	if err != nil {
+		util.Abort(ctx, util.ErrBadRequest, err.Error())
+		return nil, false
+	}
+	return match, true
+}
@@ -0,0 +1,65 @@
+package resource
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIfMatch(t *testing.T) {
+	tests := []struct {
+		header   string
+		versions []int
+		invalid  bool
+	}{
+		{header: "", versions: nil},
+		{header: "*", versions: nil},
+		{header: `"3"`, versions: []int{3}},
+		{header: `"3", "4"`, versions: []int{3, 4}},
+		{header: `W/"3"`, versions: []int{}},
+		{header: `W/"3", "4"`, versions: []int{4}},
+		{header: `3`, invalid: true},
+		{header: `"three"`, invalid: true},
+		{header: `W/3`, invalid: true},
+		{header: `"`, invalid: true},
+	}
+
+	for _, test := range tests {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest("PATCH", "/", nil)
+		ctx.Request.Header.Set("If-Match", test.header)
+
+		versions, err := ifMatch(ctx)
+		if test.invalid {
+			if err == nil {
+				t.Errorf("%s: expected it to be invalid", test.header)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.header, err)
+		} else if !reflect.DeepEqual(versions, test.versions) {
+			t.Errorf("%s: expected %v, got %v", test.header, test.versions, versions)
+		}
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	for header, expected := range map[string]bool{
+		"":           false,
+		"*":          true,
+		`"3"`:        true,
+		`W/"3"`:      true,
+		`"2", W/"3"`: true,
+		`"4"`:        false,
+	} {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest("GET", "/", nil)
+		ctx.Request.Header.Set("If-None-Match", header)
+		if notModified(ctx, `"3"`) != expected {
+			t.Errorf("%s: expected %v", header, expected)
+		}
+	}
+}
@@ -0,0 +1,390 @@
+package resource
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CactusDev/Xerophi/rethink"
+	"github.com/CactusDev/Xerophi/revision"
+	"github.com/CactusDev/Xerophi/util"
+
+	"github.com/gin-gonic/gin"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// token returns the normalized token from the route
+func token(ctx *gin.Context) string {
+	return strings.ToLower(html.EscapeString(ctx.Param("token")))
+}
+
+// includeDeleted parses include=deleted, which lists soft-deleted records
+// along with the rest so they can be restored. Only resources have a restore
+// route, so it's not one of the shared collection parameters
+func includeDeleted(ctx *gin.Context) (bool, error) {
+	raw := ctx.Query("include")
+	if raw == "" {
+		return false, nil
+	}
+	for _, include := range strings.Split(raw, ",") {
+		if strings.TrimSpace(include) != "deleted" {
+			return false, util.InvalidParameter("include", "Can't include %s", include)
+		}
+	}
+	return true, nil
+}
+
+// GetAll returns all records associated with the token
+func (r *Resource) GetAll(ctx *gin.Context) {
+	params, err := util.ParseCollectionParams(ctx, r.Schema)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusBadRequest)
+		return
+	}
+	withDeleted, err := includeDeleted(ctx)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusBadRequest)
+		return
+	}
+
+	query := params.Query(map[string]interface{}{"token": token(ctx)})
+	if withDeleted {
+		query.Deleted = rethink.WithDeleted
+	}
+	total, err := r.Conn.CountByQuery(r.Table, query)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	if total == 0 {
+		util.Abort(ctx, util.ErrNotFound, fmt.Sprintf("No %s found", r.Plural))
+		return
+	}
+	fromDB, err := r.Conn.GetByQuery(r.Table, query)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+
+	var records = make([]util.JSONAPISchema, 0, len(fromDB))
+	var deleted = make([]interface{}, 0, len(fromDB))
+	for _, record := range fromDB {
+		// If there's an issue decoding it, just log it and move on to the next record
+		respDecode, err := r.Decode(record)
+		if err != nil {
+			log.Error(err.Error())
+			continue
+		}
+		records = append(records, respDecode)
+		deleted = append(deleted, deletedAt(record))
+	}
+
+	response := params.Document(ctx, records, fromDB, total)
+	// Point out which of them are soft-deleted so they can be restored
+	for pos, resource := range response["data"].([]map[string]interface{}) {
+		if deleted[pos] == nil {
+			continue
+		}
+		meta, _ := resource["meta"].(map[string]interface{})
+		if meta == nil {
+			meta = make(map[string]interface{})
+		}
+		meta["deletedAt"] = deleted[pos]
+		resource["meta"] = meta
+	}
+
+	ctx.Header("x-total-count", fmt.Sprint(total))
+	ctx.JSON(http.StatusOK, response)
+}
+
+// GetSingle returns a single record
+func (r *Resource) GetSingle(ctx *gin.Context) {
+	if handler, ok := r.Reserved[ctx.Param(r.Key.Param)]; ok {
+		handler(ctx)
+		return
+	}
+
+	key, err := r.key(ctx)
+	if err != nil {
+		badKey(ctx, err)
+		return
+	}
+	filter := map[string]interface{}{"token": token(ctx), r.Key.Field: key}
+
+	res, _, err := r.ReturnOne(filter)
+	retRes, ok := err.(rethink.RetrievalResult)
+	// If !ok AND then err != nil then we have an actual error and not a RetRes
+	if !ok && err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+
+	// If we find one then we're just going to return right away
+	if retRes.Success && !retRes.SoftDeleted {
+		// The client already has this version
+		if tag := etag(res); notModified(ctx, tag) {
+			ctx.Header("ETag", tag)
+			ctx.Status(http.StatusNotModified)
+			return
+		}
+		r.respond(ctx, http.StatusOK, res)
+		return
+	}
+
+	// None were found Jim, 404 that boyo
+	util.Abort(ctx, util.ErrNotFound, r.Name+" not found")
+}
+
+// Create creates a new record
+func (r *Resource) Create(ctx *gin.Context) {
+	// Declare default values
+	createVals, key, err := r.Defaults(ctx, token(ctx))
+	if err != nil {
+		badKey(ctx, err)
+		return
+	}
+
+	// Do an initial check if it exists
+	filter := map[string]interface{}{"token": token(ctx), r.Key.Field: key}
+	res, id, err := r.ReturnOne(filter)
+
+	// Check if it's a RetrievalResult, or an actual error
+	if retRes, ok := err.(rethink.RetrievalResult); !ok && err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	} else if retRes.Success {
+		if !retRes.SoftDeleted {
+			// It exists already but isn't soft-deleted, error out
+			// can't edit from this endpoint
+			util.Conflict(ctx, r.Name+" already exists", res)
+			return
+		}
+		// It exists and is soft-deleted. Remove that one and then create a new one
+		if _, err := r.Conn.Delete(r.Table, id); err != nil {
+			util.NiceError(ctx, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// No records already exist that match, go ahead with creation
+	// Passed validation, put in the user data & prepare the data we're using
+	createData, err := util.ValidateAndMap(
+		ctx.Request.Body, r.CreateSchema, util.Body(createVals))
+
+	if validateErr, ok := err.(util.APIError); !ok && err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	} else if ok {
+		// It's a validation error
+		util.NiceError(ctx, validateErr, http.StatusBadRequest)
+		return
+	}
+	if !r.validate(ctx, nil, createData) {
+		return
+	}
+	// The body is dumped over the defaults, so put back the fields the API
+	// owns in case it tried to set them
+	if err := util.KeepDefaults(createData, createVals, "token", "createdAt", "deletedAt"); err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	createData[r.Key.Field] = key
+
+	// Attempt to create the new resource
+	createData["version"] = 1
+	if _, err := r.Conn.Create(r.Table, createData); err != nil {
+		util.NiceError(ctx, err, http.StatusBadRequest)
+		return
+	}
+
+	// Retrieve the newly created record
+	response, _, err := r.ReturnOne(filter)
+	// Actual error, not a RetrievalResult
+	if _, ok := err.(rethink.RetrievalResult); !ok && err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	if response == nil {
+		util.Abort(ctx, util.ErrInternal, r.Name+" couldn't be retrieved after saving")
+		return
+	}
+	if r.AfterWrite != nil {
+		r.AfterWrite(response)
+	}
+	r.record(ctx, revision.Create, filter, nil, 0)
+
+	// Aaaand success
+	r.respond(ctx, http.StatusCreated, response)
+}
+
+// Update handles the updating of a record if the record exists
+func (r *Resource) Update(ctx *gin.Context) {
+	key, err := r.key(ctx)
+	if err != nil {
+		badKey(ctx, err)
+		return
+	}
+
+	// Check if the resource that we want to edit exists
+	filter := map[string]interface{}{"token": token(ctx), r.Key.Field: key}
+	current, id, err := r.ReturnOne(filter)
+	if retRes, ok := err.(rethink.RetrievalResult); !ok && err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	} else if !retRes.Success || retRes.SoftDeleted {
+		// Record "doesn't exist", abort with a 404
+		util.Abort(ctx, util.ErrNotFound, r.Name+" not found")
+		return
+	}
+
+	match, ok := r.checkPrecondition(ctx)
+	if !ok {
+		return
+	}
+
+	// Made it past the checks, record exists
+	// Passed validation, put in the user data & prepare the data we're using
+	updateData, err := util.ValidateAndMap(
+		ctx.Request.Body, r.UpdateSchema, util.Body(r.UpdateBody))
+
+	if validateErr, ok := err.(util.APIError); !ok && err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	} else if ok {
+		// It's a validation error
+		util.NiceError(ctx, validateErr, http.StatusBadRequest)
+		return
+	}
+	if !r.validate(ctx, current, updateData) {
+		return
+	}
+
+	r.apply(ctx, id, filter, updateData, revision.Update, 0, match)
+}
+
+// apply saves the changes to the record, records the revision and responds
+// with the updated record. If match isn't nil the record is only changed if
+// it's still at one of those versions
+func (r *Resource) apply(ctx *gin.Context, id string, filter map[string]interface{},
+	updateData map[string]interface{}, action string, from int, match []int) {
+	before, err := r.snapshot(filter)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+
+	// Attempt to update the new resource, checking the version as part of the
+	// same write so nothing can change it in between
+	updated, err := r.Conn.UpdateVersioned(r.Table, id, match, updateData)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	} else if !updated && match != nil {
+		r.preconditionFailed(ctx)
+		return
+	} else if !updated {
+		util.Abort(ctx, util.ErrNotFound, r.Name+" not found")
+		return
+	}
+
+	// Retrieve the newly updated record
+	response, _, err := r.ReturnOne(filter)
+	// If !ok AND then err != nil then we have an actual error and not a RetRes
+	if _, ok := err.(rethink.RetrievalResult); !ok && err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	if response == nil {
+		util.Abort(ctx, util.ErrInternal, r.Name+" couldn't be retrieved after saving")
+		return
+	}
+	if r.AfterWrite != nil {
+		r.AfterWrite(response)
+	}
+	r.record(ctx, action, filter, before, from)
+
+	// Success
+	r.respond(ctx, http.StatusOK, response)
+}
+
+// Delete soft-deletes a record
+func (r *Resource) Delete(ctx *gin.Context) {
+	key, err := r.key(ctx)
+	if err != nil {
+		badKey(ctx, err)
+		return
+	}
+	filter := map[string]interface{}{"token": token(ctx), r.Key.Field: key}
+	resp, err := r.Conn.GetByFilter(r.Table, filter, 1)
+
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusBadRequest)
+		return
+	}
+	if resp == nil {
+		// Resource doesn't exist, return a 404
+		util.Abort(ctx, util.ErrNotFound, r.Name+" not found")
+		return
+	}
+
+	rs, valid := resp[0].(map[string]interface{})
+	if !valid {
+		log.Errorf("[%s] - Unable to typecast response to correct type", r.Table)
+		util.Abort(ctx, util.ErrInternal, "")
+		return
+	}
+
+	match, ok := r.checkPrecondition(ctx)
+	if !ok {
+		return
+	}
+
+	// Soft-delete the record
+	deleted, err := r.Conn.UpdateVersioned(r.Table, rs["id"].(string), match,
+		map[string]interface{}{"deletedAt": time.Now().UTC().Unix()})
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	} else if !deleted && match != nil {
+		r.preconditionFailed(ctx)
+		return
+	} else if !deleted {
+		util.Abort(ctx, util.ErrNotFound, r.Name+" not found")
+		return
+	}
+	if r.AfterDelete != nil {
+		r.AfterDelete(rs["id"].(string))
+	}
+	r.record(ctx, revision.Delete, filter, rs, 0)
+
+	// Success
+	ctx.Header("x-resource-id-removed", rs["id"].(string))
+	ctx.Status(http.StatusOK)
+}
+
+// Restore brings back a soft-deleted record
+func (r *Resource) Restore(ctx *gin.Context) {
+	key, err := r.key(ctx)
+	if err != nil {
+		badKey(ctx, err)
+		return
+	}
+	filter := map[string]interface{}{"token": token(ctx), r.Key.Field: key}
+
+	_, id, err := r.ReturnOne(filter)
+	if retRes, ok := err.(rethink.RetrievalResult); !ok && err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	} else if !retRes.Success {
+		util.Abort(ctx, util.ErrNotFound, r.Name+" not found")
+		return
+	} else if !retRes.SoftDeleted {
+		util.Abort(ctx, util.ErrNotDeleted, r.Name+" hasn't been deleted")
+		return
+	}
+
+	r.apply(ctx, id, filter, map[string]interface{}{"deletedAt": 0}, revision.Restore, 0, nil)
+}
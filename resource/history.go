@@ -0,0 +1,141 @@
+package resource
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/CactusDev/Xerophi/rethink"
+	"github.com/CactusDev/Xerophi/revision"
+	"github.com/CactusDev/Xerophi/util"
+
+	"github.com/gin-gonic/gin"
+
+	mapstruct "github.com/mitchellh/mapstructure"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetHistory returns every revision of a record, newest first unless another
+// order is asked for
+func (r *Resource) GetHistory(ctx *gin.Context) {
+	key, err := r.key(ctx)
+	if err != nil {
+		badKey(ctx, err)
+		return
+	}
+	params, err := util.ParseCollectionParams(ctx, revision.ResponseSchema{})
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusBadRequest)
+		return
+	}
+	if ctx.Query("sort") == "" {
+		params.Sort = []rethink.Sort{{Field: "number", Descending: true}}
+	}
+
+	query := params.Query(revision.Filter(token(ctx), r.segment(), fmt.Sprint(key)))
+	total, err := r.History.DB.CountByQuery(r.History.Table, query)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	if total == 0 {
+		util.Abort(ctx, util.ErrNotFound, "No revisions found")
+		return
+	}
+	fromDB, err := r.History.DB.GetByQuery(r.History.Table, query)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+
+	var revisions = make([]util.JSONAPISchema, 0, len(fromDB))
+	for _, record := range fromDB {
+		var decoded revision.ResponseSchema
+		// If there's an issue decoding it, just log it and move on to the next record
+		if err := mapstruct.Decode(record, &decoded); err != nil {
+			log.Error(err.Error())
+			continue
+		}
+		revisions = append(revisions, decoded)
+	}
+
+	ctx.Header("x-total-count", fmt.Sprint(total))
+	ctx.JSON(http.StatusOK, params.Document(ctx, revisions, fromDB, total))
+}
+
+// Rollback puts the record back the way it was after the revision given.
+// The old version goes through the same validation as any other update, and
+// the rollback is recorded as a new revision
+func (r *Resource) Rollback(ctx *gin.Context) {
+	key, err := r.key(ctx)
+	if err != nil {
+		badKey(ctx, err)
+		return
+	}
+	number, err := strconv.Atoi(ctx.Param("revision"))
+	if err != nil {
+		util.Abort(ctx, util.ErrBadRequest, "Revision must be a number")
+		return
+	}
+
+	// The record has to still be around, even if it's soft-deleted
+	filter := map[string]interface{}{"token": token(ctx), r.Key.Field: key}
+	_, id, err := r.ReturnOne(filter)
+	retRes, ok := err.(rethink.RetrievalResult)
+	if !ok && err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	} else if !retRes.Success {
+		util.Abort(ctx, util.ErrNotFound, r.Name+" not found")
+		return
+	}
+
+	match, ok := r.checkPrecondition(ctx)
+	if !ok {
+		return
+	}
+
+	_, snapshot, err := r.History.Get(token(ctx), r.segment(), fmt.Sprint(key), number)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	if snapshot == nil {
+		util.Abort(ctx, util.ErrNotFound, fmt.Sprintf("Revision %d not found", number))
+		return
+	}
+
+	// Only the fields that can be updated are put back
+	stored, err := json.Marshal(snapshot)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	body, err := util.Body(r.UpdateBody).DumpBody(stored)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	updateData, err := util.ValidateAndMap(
+		bytes.NewReader(body), r.UpdateSchema, util.Body(r.UpdateBody))
+
+	if validateErr, ok := err.(util.APIError); !ok && err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	} else if ok {
+		// The old version doesn't pass the current schema
+		util.NiceError(ctx, validateErr, http.StatusBadRequest)
+		return
+	}
+
+	// Rolling back to a version from before it was deleted brings it back
+	if retRes.SoftDeleted {
+		if deleted, _ := snapshot["deletedAt"].(float64); deleted == 0 {
+			updateData["deletedAt"] = 0
+		}
+	}
+
+	r.apply(ctx, id, filter, updateData, revision.Rollback, number, match)
+}
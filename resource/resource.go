@@ -0,0 +1,289 @@
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/CactusDev/Xerophi/rethink"
+	"github.com/CactusDev/Xerophi/revision"
+	"github.com/CactusDev/Xerophi/stream"
+	"github.com/CactusDev/Xerophi/types"
+	"github.com/CactusDev/Xerophi/util"
+
+	"github.com/gin-gonic/gin"
+
+	mapstruct "github.com/mitchellh/mapstructure"
+	log "github.com/sirupsen/logrus"
+)
+
+// Key describes how a single record is picked out by its route
+type Key struct {
+	Param string                                // The route parameter, e.g. "name" for /:name
+	Field string                                // The field it's stored under
+	Parse func(raw string) (interface{}, error) // Converts the parameter, nil keeps it as a string
+}
+
+// UnknownKey is returned by a key's Parse when there can't be a record with
+// that key at all, e.g. an event that doesn't exist, which is a 404 rather
+// than a bad request
+type UnknownKey string
+
+func (k UnknownKey) Error() string {
+	return string(k)
+}
+
+// Hooks let a resource change how the generic handling works. All of them
+// are optional except Defaults
+type Hooks struct {
+	// Defaults returns the values the API fills in for a new record, which
+	// the request body is dumped on top of, along with the new record's key
+	Defaults func(ctx *gin.Context, token string) (interface{}, interface{}, error)
+	// Validate is run on a create or update body once it's passed the JSON
+	// schema, for the checks it can't do. Updates get the record as it is
+	// now, creates get nil. Returning an APIError rejects the body
+	Validate func(current util.JSONAPISchema, data map[string]interface{}) error
+	// Transform is run on every record after it's fetched, to fill in any
+	// fields that aren't stored
+	Transform func(util.JSONAPISchema) util.JSONAPISchema
+	// AfterWrite is run after a record has been created or updated
+	AfterWrite func(util.JSONAPISchema)
+	// AfterDelete is run with the ID of a record after it's been deleted
+	AfterDelete func(id string)
+}
+
+// Resource is a generic handler for a resource that's stored one record per
+// key under each token, providing the usual CRUD routes for it
+type Resource struct {
+	Conn   rethink.Database // The storage backend
+	Table  string           // The database table we're using
+	Name   string           // What a record is called in messages, e.g. "Command"
+	Plural string           // What more than one are called, e.g. "commands"
+	Key    Key
+
+	Schema       util.JSONAPISchema // The response schema records are decoded into
+	CreateSchema string             // The JSON schema creation bodies are validated against
+	UpdateSchema string             // The JSON schema update bodies are validated against, "" turns off updates
+	UpdateBody   interface{}        // The struct update bodies are dumped into
+	CreatePath   string             // Where new records are POSTed, "" or the key's route
+
+	// Values of the key parameter that are handled by something else rather
+	// than looked up, e.g. /quote/random
+	Reserved map[string]gin.HandlerFunc
+
+	// Where every change to a record is kept, nil turns off history
+	History *revision.Store
+
+	Hooks
+}
+
+// Routes returns the routing information for this endpoint
+func (r *Resource) Routes() []types.RouteDetails {
+	keyPath := "/:" + r.Key.Param
+	routes := []types.RouteDetails{
+		types.RouteDetails{
+			Enabled: true, Path: "", Verb: "GET",
+			Handler: r.GetAll,
+		},
+		types.RouteDetails{
+			Enabled: true, Path: r.CreatePath, Verb: "POST",
+			Handler: r.Create,
+		},
+		types.RouteDetails{
+			Enabled: true, Path: keyPath, Verb: "GET",
+			Handler: r.GetSingle,
+		},
+		types.RouteDetails{
+			Enabled: r.UpdateSchema != "", Path: keyPath, Verb: "PATCH",
+			Handler: r.Update,
+		},
+		types.RouteDetails{
+			Enabled: true, Path: keyPath, Verb: "DELETE",
+			Handler: r.Delete,
+		},
+		types.RouteDetails{
+			Enabled: true, Path: keyPath + "/restore", Verb: "POST",
+			Handler: r.Restore,
+		},
+	}
+	if r.History != nil {
+		routes = append(routes,
+			types.RouteDetails{
+				Enabled: true, Path: keyPath + "/history", Verb: "GET",
+				Handler: r.GetHistory,
+			},
+			types.RouteDetails{
+				Enabled: true, Path: keyPath + "/history/:revision/rollback", Verb: "POST",
+				Handler: r.Rollback,
+			},
+		)
+	}
+
+	return routes
+}
+
+// Decode decodes a record from the DB into the response schema and runs the
+// Transform hook on it
+func (r *Resource) Decode(record interface{}) (util.JSONAPISchema, error) {
+	decoded := reflect.New(reflect.TypeOf(r.Schema))
+	if err := mapstruct.Decode(record, decoded.Interface()); err != nil {
+		return nil, err
+	}
+
+	schema, ok := decoded.Elem().Interface().(util.JSONAPISchema)
+	if !ok {
+		return nil, errors.New("Response schema isn't a JSONAPISchema")
+	}
+	if r.Transform != nil {
+		schema = r.Transform(schema)
+	}
+
+	return schema, nil
+}
+
+// ReturnOne retrieves a single record given the filter provided, along with
+// its ID
+func (r *Resource) ReturnOne(filter map[string]interface{}) (util.JSONAPISchema, string, error) {
+	// Retrieve a single record from the DB based on the filter
+	fromDB, err := r.Conn.GetSingle(filter, r.Table)
+	if err != nil {
+		return nil, "", err
+	}
+	// Was anything returned?
+	if fromDB == nil {
+		// Return nothing, it's not an error but there's nothing there
+		return nil, "", rethink.RetrievalResult{
+			Success: false, SoftDeleted: false, Message: ""}
+	}
+
+	record, ok := fromDB.(map[string]interface{})
+	if !ok {
+		return nil, "", errors.New("Unable to typecast response to correct type")
+	}
+	response, err := r.Decode(record)
+	if err != nil {
+		return nil, "", err
+	}
+	id, _ := record["id"].(string)
+
+	if deletedAt, _ := record["deletedAt"].(float64); deletedAt != 0 {
+		return response, id, rethink.RetrievalResult{true, true, ""}
+	}
+
+	return response, id, rethink.RetrievalResult{true, false, ""}
+}
+
+// deletedAt returns when the record was soft-deleted, formatted like the
+// rest of the timestamps, or nil if it hasn't been
+func deletedAt(record interface{}) interface{} {
+	mapped, _ := record.(map[string]interface{})
+	deleted, _ := mapped["deletedAt"].(float64)
+	if deleted == 0 {
+		return nil
+	}
+	return time.Unix(int64(deleted), 0).UTC().Format(util.TimeFormat)
+}
+
+// Topic describes how changes to the records are sent down the change stream,
+// rendered the same way the routes return them
+func (r *Resource) Topic() stream.Topic {
+	return stream.Topic{
+		Name:  r.segment(),
+		Table: r.Table,
+		Render: func(record map[string]interface{}) (interface{}, error) {
+			schema, err := r.Decode(record)
+			if err != nil {
+				return nil, err
+			}
+			resource, _ := util.MarshalResource(schema)
+			return resource, nil
+		},
+	}
+}
+
+// segment is the route segment records are under, e.g. "command"
+func (r *Resource) segment() string {
+	return strings.ToLower(r.Name)
+}
+
+// snapshot retrieves the record as it's stored, for keeping in its history.
+// Returns nil if history is turned off or the record doesn't exist
+func (r *Resource) snapshot(filter map[string]interface{}) (map[string]interface{}, error) {
+	if r.History == nil {
+		return nil, nil
+	}
+	fromDB, err := r.Conn.GetSingle(filter, r.Table)
+	if err != nil || fromDB == nil {
+		return nil, err
+	}
+	record, ok := fromDB.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("Unable to typecast response to correct type")
+	}
+	return record, nil
+}
+
+// record adds a revision to the record's history, with the record as it was
+// before the change. Failing to record it is only logged since the change
+// itself has already been made
+func (r *Resource) record(ctx *gin.Context, action string, filter map[string]interface{},
+	before map[string]interface{}, from int) {
+	if r.History == nil {
+		return
+	}
+	after, err := r.snapshot(filter)
+	if err == nil {
+		err = r.History.Record(revision.Entry{
+			Token:    token(ctx),
+			Resource: r.segment(),
+			Key:      fmt.Sprint(filter[r.Key.Field]),
+			Action:   action,
+			Author:   util.Actor(ctx),
+			From:     from,
+			Before:   before,
+			After:    after,
+		})
+	}
+	if err != nil {
+		log.Errorf("[%s] - Failed to record %s revision: %s", r.Table, action, err)
+	}
+}
+
+// badKey ends the request because the key in the route can't be used
+func badKey(ctx *gin.Context, err error) {
+	if unknown, ok := err.(UnknownKey); ok {
+		util.Abort(ctx, util.ErrNotFound, unknown.Error())
+		return
+	}
+	util.NiceError(ctx, err, http.StatusBadRequest)
+}
+
+// validate runs the Validate hook on the body, ending the request if it's
+// rejected
+func (r *Resource) validate(ctx *gin.Context, current util.JSONAPISchema,
+	data map[string]interface{}) bool {
+	if r.Validate == nil {
+		return true
+	}
+	err := r.Validate(current, data)
+	if validateErr, ok := err.(util.APIError); !ok && err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return false
+	} else if ok {
+		util.NiceError(ctx, validateErr, http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// key pulls the record's key out of the route
+func (r *Resource) key(ctx *gin.Context) (interface{}, error) {
+	raw := ctx.Param(r.Key.Param)
+	if r.Key.Parse == nil {
+		return raw, nil
+	}
+	return r.Key.Parse(raw)
+}
@@ -0,0 +1,65 @@
+package rethink
+
+import (
+	log "github.com/sirupsen/logrus"
+	r "gopkg.in/gorethink/gorethink.v4"
+)
+
+// Change is a single write to one of the tables being watched. Old is nil for
+// a record that was just created and New is nil for one that was removed
+type Change struct {
+	Table string                 `gorethink:"table"`
+	Old   map[string]interface{} `gorethink:"old_val"`
+	New   map[string]interface{} `gorethink:"new_val"`
+}
+
+// Changes streams every change made to the tables until stop is closed, using
+// RethinkDB's changefeeds. The channel is closed if the feed drops, so it has
+// to be opened again
+func (c *Connection) Changes(tables []string, stop <-chan struct{}) (<-chan Change, error) {
+	var feed r.Term
+	for pos, table := range tables {
+		// Tag each change with its table so they can be told apart once merged
+		term := r.Table(table).Changes().Merge(map[string]interface{}{"table": table})
+		if pos == 0 {
+			feed = term
+		} else {
+			feed = feed.Union(term)
+		}
+	}
+
+	cursor, err := feed.Run(c.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(chan Change)
+	done := make(chan struct{})
+	go func() {
+		// Closing the cursor is what stops Next from blocking
+		select {
+		case <-stop:
+		case <-done:
+		}
+		cursor.Close()
+	}()
+	go func() {
+		defer close(changes)
+		defer close(done)
+
+		var change Change
+		for cursor.Next(&change) {
+			select {
+			case changes <- change:
+			case <-stop:
+				return
+			}
+			change = Change{}
+		}
+		if err := cursor.Err(); err != nil {
+			log.Error(err.Error())
+		}
+	}()
+
+	return changes, nil
+}
@@ -28,6 +28,26 @@ func (c *Connection) Create(table string, data map[string]interface{}) (interfac
 	return resp, nil
 }
 
+// UpdateVersioned updates the record and bumps its version in a single write.
+// If versions isn't nil the record is only updated if it's currently at one of
+// them, returning false if it wasn't. Records that predate versioning are at
+// version 0
+func (c *Connection) UpdateVersioned(table string, uid string, versions []int, data map[string]interface{}) (bool, error) {
+	resp, err := r.Table(table).Get(uid).Update(func(row r.Term) interface{} {
+		current := row.Field("version").Default(0)
+		update := r.Expr(data).Merge(map[string]interface{}{"version": current.Add(1)})
+		if versions == nil {
+			return update
+		}
+		return r.Branch(r.Expr(versions).Contains(current), update, map[string]interface{}{})
+	}).RunWrite(c.Session)
+	if err != nil {
+		log.Error(err.Error())
+		return false, err
+	}
+	return resp.Replaced > 0, nil
+}
+
 // Disable ... well, it deletes a record. Softly.
 func (c *Connection) Disable(table string, uid string) (interface{}, error) {
 	// Check if the record exists
@@ -48,3 +68,14 @@ func (c *Connection) Delete(table string, uid string) (interface{}, error) {
 	}
 	return resp, nil
 }
+
+// Upsert creates the record, or replaces it entirely if one with the same ID
+// already exists
+func (c *Connection) Upsert(table string, data map[string]interface{}) (interface{}, error) {
+	resp, err := r.Table(table).Insert(data, r.InsertOpts{Conflict: "replace"}).RunWrite(c.Session)
+	if err != nil {
+		log.Error(err.Error())
+		return nil, err
+	}
+	return resp, nil
+}
@@ -10,12 +10,18 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// Reporter is a background job that can report on its last run
+type Reporter interface {
+	Report() interface{} // nil if the job hasn't run yet
+}
+
 // Status keeps track of the status
 type Status struct {
 	Tables      map[string]struct{} // All tables we're monitoring
 	DBs         map[string]struct{} // All databases we're monitoring
 	Issues      []Issue             // Any active issues
 	LastUpdated time.Time           // The last time any value was updated
+	Jobs        map[string]Reporter // Background jobs shown alongside the status
 }
 
 // NewMonitor initializes a new Status monitor for the tables and DBs given
@@ -68,8 +74,16 @@ func (s *Status) APIStatusHandler(ctx *gin.Context) {
 	if len(s.Issues) > 0 {
 		code = http.StatusInternalServerError
 	}
-	ctx.JSON(code, gin.H{
+	response := gin.H{
 		"updated": s.LastUpdated.Format(time.UnixDate),
 		"issues":  s.Issues,
-	})
+	}
+	if len(s.Jobs) > 0 {
+		jobs := make(map[string]interface{}, len(s.Jobs))
+		for name, job := range s.Jobs {
+			jobs[name] = job.Report()
+		}
+		response["jobs"] = jobs
+	}
+	ctx.JSON(code, response)
 }
@@ -0,0 +1,211 @@
+package rethink
+
+import (
+	"sync"
+)
+
+// Publisher emulates changefeeds for backends that don't have them. The
+// backend publishes every change as it writes it, and anything watching the
+// table gets it
+type Publisher struct {
+	mutex       sync.Mutex
+	subscribers map[chan Change]map[string]struct{} // The tables each one is watching
+}
+
+// Publish sends the change to everything watching its table. Anything that's
+// fallen too far behind is dropped, the same as a changefeed that's dropped,
+// rather than holding up the write
+func (p *Publisher) Publish(change Change) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for changes, tables := range p.subscribers {
+		if _, ok := tables[change.Table]; !ok {
+			continue
+		}
+		select {
+		case changes <- change:
+		default:
+			delete(p.subscribers, changes)
+			close(changes)
+		}
+	}
+}
+
+// Changes streams every change published for the tables until stop is closed
+func (p *Publisher) Changes(tables []string, stop <-chan struct{}) (<-chan Change, error) {
+	var watching = make(map[string]struct{}, len(tables))
+	for _, table := range tables {
+		watching[table] = struct{}{}
+	}
+	// Buffered so a write isn't held up by whatever's reading the changes
+	changes := make(chan Change, 256)
+
+	p.mutex.Lock()
+	if p.subscribers == nil {
+		p.subscribers = make(map[chan Change]map[string]struct{})
+	}
+	p.subscribers[changes] = watching
+	p.mutex.Unlock()
+
+	go func() {
+		<-stop
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		if _, ok := p.subscribers[changes]; ok {
+			delete(p.subscribers, changes)
+			close(changes)
+		}
+	}()
+
+	return changes, nil
+}
+
+// Publishing adds a change feed to a backend that doesn't have its own, like
+// rethinktest.Memory, by publishing each write it makes. The records are
+// looked up around each write, so it's slower than a backend with real
+// changefeeds, and only writes made through it are seen
+type Publishing struct {
+	Database
+	Feed Publisher
+}
+
+// record looks up a record as it's stored whether it's soft-deleted or not,
+// nil if it doesn't exist
+func (p *Publishing) record(table string, uid string) map[string]interface{} {
+	fromDB, err := p.Database.GetSingle(map[string]interface{}{"id": uid}, table)
+	if err != nil {
+		return nil
+	}
+	record, _ := fromDB.(map[string]interface{})
+	return record
+}
+
+// records looks up every record the query matches
+func (p *Publishing) records(table string, q Query) []map[string]interface{} {
+	fromDB, err := p.Database.GetByQuery(table, q)
+	if err != nil {
+		return nil
+	}
+	var records = make([]map[string]interface{}, 0, len(fromDB))
+	for _, record := range fromDB {
+		if mapped, ok := record.(map[string]interface{}); ok {
+			records = append(records, mapped)
+		}
+	}
+	return records
+}
+
+// changed publishes the record's change if it was actually changed
+func (p *Publishing) changed(table string, uid string, old map[string]interface{}) {
+	change := Change{Table: table, Old: old, New: p.record(table, uid)}
+	if change.Old == nil && change.New == nil {
+		return
+	}
+	p.Feed.Publish(change)
+}
+
+// Changes streams the changes published by writes through this backend
+func (p *Publishing) Changes(tables []string, stop <-chan struct{}) (<-chan Change, error) {
+	return p.Feed.Changes(tables, stop)
+}
+
+// Update updates the record and publishes the change
+func (p *Publishing) Update(table string, uid string, data map[string]interface{}) (interface{}, error) {
+	old := p.record(table, uid)
+	resp, err := p.Database.Update(table, uid, data)
+	if err == nil {
+		p.changed(table, uid, old)
+	}
+	return resp, err
+}
+
+// UpdateVersioned updates the record if it's at one of the versions and
+// publishes the change if it was
+func (p *Publishing) UpdateVersioned(table string, uid string, versions []int, data map[string]interface{}) (bool, error) {
+	old := p.record(table, uid)
+	updated, err := p.Database.UpdateVersioned(table, uid, versions, data)
+	if err == nil && updated {
+		p.changed(table, uid, old)
+	}
+	return updated, err
+}
+
+// Create creates the record and publishes it
+func (p *Publishing) Create(table string, data map[string]interface{}) (interface{}, error) {
+	resp, err := p.Database.Create(table, data)
+	if err != nil {
+		return resp, err
+	}
+	if uid, _ := data["id"].(string); uid != "" {
+		p.changed(table, uid, nil)
+	} else {
+		p.Feed.Publish(Change{Table: table, New: data})
+	}
+	return resp, err
+}
+
+// Upsert creates or replaces the record and publishes the change
+func (p *Publishing) Upsert(table string, data map[string]interface{}) (interface{}, error) {
+	uid, _ := data["id"].(string)
+	var old map[string]interface{}
+	if uid != "" {
+		old = p.record(table, uid)
+	}
+	resp, err := p.Database.Upsert(table, data)
+	if err != nil {
+		return resp, err
+	}
+	if uid != "" {
+		p.changed(table, uid, old)
+	} else {
+		p.Feed.Publish(Change{Table: table, New: data})
+	}
+	return resp, err
+}
+
+// Delete removes the record and publishes its removal
+func (p *Publishing) Delete(table string, uid string) (interface{}, error) {
+	old := p.record(table, uid)
+	resp, err := p.Database.Delete(table, uid)
+	if err == nil && old != nil {
+		p.Feed.Publish(Change{Table: table, Old: old})
+	}
+	return resp, err
+}
+
+// DeleteByQuery removes every record the query matches and publishes each
+// removal
+func (p *Publishing) DeleteByQuery(table string, q Query) (int, error) {
+	old := p.records(table, q)
+	removed, err := p.Database.DeleteByQuery(table, q)
+	if err == nil {
+		for _, record := range old {
+			p.Feed.Publish(Change{Table: table, Old: record})
+		}
+	}
+	return removed, err
+}
+
+// Disable soft-deletes the record and publishes the change
+func (p *Publishing) Disable(table string, uid string) (interface{}, error) {
+	old := p.record(table, uid)
+	resp, err := p.Database.Disable(table, uid)
+	if err == nil {
+		p.changed(table, uid, old)
+	}
+	return resp, err
+}
+
+// DisableByQuery soft-deletes every record the query matches and publishes
+// each change
+func (p *Publishing) DisableByQuery(table string, q Query) (int, error) {
+	old := p.records(table, q)
+	disabled, err := p.Database.DisableByQuery(table, q)
+	if err == nil {
+		for _, record := range old {
+			uid, _ := record["id"].(string)
+			p.changed(table, uid, record)
+		}
+	}
+	return disabled, err
+}
@@ -0,0 +1,130 @@
+package rethink_test
+
+import (
+	"testing"
+
+	"github.com/CactusDev/Xerophi/rethink"
+	"github.com/CactusDev/Xerophi/rethink/rethinktest"
+)
+
+// watch returns a backend that publishes its writes, and the changes to the
+// commands table
+func watch(t *testing.T) (*rethink.Publishing, <-chan rethink.Change) {
+	db := &rethink.Publishing{Database: rethinktest.NewMemory()}
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	changes, err := db.Changes([]string{"commands"}, stop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, changes
+}
+
+// next returns the change that's been published, publishing doesn't wait so
+// it's already there if there is one
+func next(t *testing.T, changes <-chan rethink.Change) rethink.Change {
+	t.Helper()
+	select {
+	case change := <-changes:
+		return change
+	default:
+		t.Fatal("expected a change to be published")
+	}
+	return rethink.Change{}
+}
+
+// none checks nothing's been published
+func none(t *testing.T, changes <-chan rethink.Change) {
+	t.Helper()
+	select {
+	case change := <-changes:
+		t.Fatalf("expected nothing to be published, got %+v", change)
+	default:
+	}
+}
+
+func TestPublishingWrites(t *testing.T) {
+	db, changes := watch(t)
+
+	db.Create("commands", map[string]interface{}{"id": "a", "name": "hi", "deletedAt": 0})
+	change := next(t, changes)
+	if change.Table != "commands" || change.Old != nil || change.New["name"] != "hi" {
+		t.Errorf("unexpected create %+v", change)
+	}
+
+	db.Update("commands", "a", map[string]interface{}{"name": "hello"})
+	change = next(t, changes)
+	if change.Old["name"] != "hi" || change.New["name"] != "hello" {
+		t.Errorf("unexpected update %+v", change)
+	}
+
+	db.Disable("commands", "a")
+	change = next(t, changes)
+	if deletedAt, _ := change.New["deletedAt"].(float64); deletedAt == 0 {
+		t.Errorf("expected the record to be soft-deleted, got %+v", change)
+	}
+
+	// Soft-deleted records are still looked up so purging them is published
+	db.Delete("commands", "a")
+	change = next(t, changes)
+	if change.Old["id"] != "a" || change.New != nil {
+		t.Errorf("unexpected delete %+v", change)
+	}
+	none(t, changes)
+}
+
+func TestPublishingUnknownRecords(t *testing.T) {
+	db, changes := watch(t)
+
+	if _, err := db.Update("commands", "missing", map[string]interface{}{"name": "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.UpdateVersioned("commands", "missing", nil, map[string]interface{}{"name": "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Disable("commands", "missing"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Delete("commands", "missing"); err != nil {
+		t.Fatal(err)
+	}
+	none(t, changes)
+}
+
+func TestPublishingByQuery(t *testing.T) {
+	db, changes := watch(t)
+	db.Create("commands", map[string]interface{}{"id": "a", "token": "x", "deletedAt": 0})
+	db.Create("commands", map[string]interface{}{"id": "b", "token": "y", "deletedAt": 0})
+	next(t, changes)
+	next(t, changes)
+
+	removed, err := db.DeleteByQuery("commands", rethink.Query{
+		Filter: map[string]interface{}{"token": "x"},
+	})
+	if err != nil || removed != 1 {
+		t.Fatalf("expected 1 removed, got %d, %v", removed, err)
+	}
+	change := next(t, changes)
+	if change.Old["id"] != "a" || change.New != nil {
+		t.Errorf("unexpected delete %+v", change)
+	}
+	none(t, changes)
+}
+
+func TestPublishingOtherTables(t *testing.T) {
+	db, changes := watch(t)
+	db.Create("quotes", map[string]interface{}{"id": "a", "deletedAt": 0})
+	none(t, changes)
+}
+
+func TestPublisherStop(t *testing.T) {
+	var feed rethink.Publisher
+	stop := make(chan struct{})
+	changes, _ := feed.Changes([]string{"commands"}, stop)
+	close(stop)
+
+	// Closing is done in the background, it's finished once the feed closes
+	for range changes {
+	}
+	feed.Publish(rethink.Change{Table: "commands"})
+}
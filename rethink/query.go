@@ -0,0 +1,252 @@
+package rethink
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	r "gopkg.in/gorethink/gorethink.v4"
+)
+
+// Query describes a retrieval that can't be done with a plain equality filter
+type Query struct {
+	Filter  map[string]interface{}   // Fields that have to match exactly
+	In      map[string][]interface{} // Fields that have to match one of the values
+	Ranges  []Range                  // Fields that have to fall within bounds
+	Where   []Condition              // Any other conditions the fields have to meet
+	Sort    []Sort                   // Order to return records in, ties are broken by ID
+	After   *Position                // Only return records after this point in the sort order
+	Offset  int                      // Number of records to skip
+	Limit   int                      // 0 means no limit
+	Fields  []string                 // Only return these fields, nil means all of them
+	Deleted DeletedMode              // Whether soft-deleted records are matched
+}
+
+// DeletedMode controls whether a query matches soft-deleted records
+type DeletedMode int
+
+// The ways soft-deleted records can be handled
+const (
+	LiveOnly    DeletedMode = iota // Leave soft-deleted records out, the default
+	WithDeleted                    // Match records whether they're soft-deleted or not
+	DeletedOnly                    // Only match soft-deleted records
+)
+
+// Range limits a field to values between Min and Max, either can be nil
+// to leave that side of the range open
+type Range struct {
+	Field string
+	Min   interface{} // Inclusive lower bound
+	Max   interface{} // Exclusive upper bound
+}
+
+// Operators a Condition can use
+const (
+	Eq       = "eq"       // Equal to the value
+	Prefix   = "prefix"   // Starts with the value
+	Contains = "contains" // Contains the value anywhere, ignoring case
+	Gt       = "gt"       // Greater than the value
+	Gte      = "gte"      // Greater than or equal to the value
+	Lt       = "lt"       // Less than the value
+	Lte      = "lte"      // Less than or equal to the value
+)
+
+// Condition is a single comparison a field has to pass
+type Condition struct {
+	Field string
+	Op    string
+	Value interface{}
+}
+
+// term builds the ReQL term for the condition
+func (cond Condition) term() r.Term {
+	field := r.Row.Field(cond.Field)
+	switch cond.Op {
+	case Prefix:
+		return field.Match("^" + regexp.QuoteMeta(fmt.Sprint(cond.Value)))
+	case Contains:
+		return field.Match("(?i)" + regexp.QuoteMeta(fmt.Sprint(cond.Value)))
+	case Gt:
+		return field.Gt(cond.Value)
+	case Gte:
+		return field.Ge(cond.Value)
+	case Lt:
+		return field.Lt(cond.Value)
+	case Lte:
+		return field.Le(cond.Value)
+	default:
+		return field.Eq(cond.Value)
+	}
+}
+
+// Sort is a single field to order records by
+type Sort struct {
+	Field      string
+	Descending bool
+}
+
+// Position is a point in an ordered query, used for keyset pagination so
+// pages stay stable while new records are being added
+type Position struct {
+	Values []interface{} // Value of each sort field for the last record seen
+	ID     string        // ID of the last record seen
+}
+
+// filterTerm builds the ReQL term that selects the records the query matches
+// in the table given. Soft-deleted records are left out unless asked for
+func (q Query) filterTerm(table string) r.Term {
+	query := r.Table(table)
+	switch q.Deleted {
+	case LiveOnly:
+		query = query.Filter(r.Row.Field("deletedAt").Default(0).Eq(0))
+	case DeletedOnly:
+		query = query.Filter(r.Row.Field("deletedAt").Default(0).Ne(0))
+	}
+	if len(q.Filter) > 0 {
+		query = query.Filter(q.Filter)
+	}
+	for field, values := range q.In {
+		query = query.Filter(r.Expr(values).Contains(r.Row.Field(field)))
+	}
+	for _, rng := range q.Ranges {
+		if rng.Min != nil {
+			query = query.Filter(r.Row.Field(rng.Field).Ge(rng.Min))
+		}
+		if rng.Max != nil {
+			query = query.Filter(r.Row.Field(rng.Field).Lt(rng.Max))
+		}
+	}
+	for _, cond := range q.Where {
+		// Records without the field just don't match rather than erroring
+		query = query.Filter(cond.term(), r.FilterOpts{Default: false})
+	}
+
+	return query
+}
+
+// term builds the full ReQL term for retrieving the query's records in order
+func (q Query) term(table string) r.Term {
+	query := q.filterTerm(table)
+	if len(q.Sort) == 0 {
+		return query
+	}
+
+	first := q.Sort[0]
+	if q.After != nil {
+		query = query.Filter(q.after(), r.FilterOpts{Default: false})
+	}
+
+	var order []interface{}
+	for _, sort := range q.Sort {
+		if sort.Descending {
+			order = append(order, r.Desc(sort.Field))
+		} else {
+			order = append(order, r.Asc(sort.Field))
+		}
+	}
+	// Break ties by ID in the same direction so pages never overlap
+	if first.Descending {
+		order = append(order, r.Desc("id"))
+	} else {
+		order = append(order, r.Asc("id"))
+	}
+
+	return query.OrderBy(order...)
+}
+
+// beyond builds the term for the field coming after the value in the order
+// given
+func beyond(field r.Term, value interface{}, descending bool) r.Term {
+	if descending {
+		return field.Lt(value)
+	}
+	return field.Gt(value)
+}
+
+// after builds the term for the records that come after the query's position.
+// Each sort field is compared in turn, only moving on to the next one while
+// they're equal, and then the ID breaks the tie
+func (q Query) after() r.Term {
+	cond := beyond(r.Row.Field("id"), q.After.ID, q.Sort[0].Descending)
+	for pos := len(q.After.Values) - 1; pos >= 0; pos-- {
+		if pos >= len(q.Sort) {
+			continue
+		}
+		field, value := r.Row.Field(q.Sort[pos].Field), q.After.Values[pos]
+		cond = beyond(field, value, q.Sort[pos].Descending).Or(
+			field.Eq(value).And(cond))
+	}
+	return cond
+}
+
+// GetByQuery returns all the records that match the query
+func (c *Connection) GetByQuery(table string, q Query) ([]interface{}, error) {
+	query := q.term(table)
+	if q.Offset > 0 {
+		query = query.Skip(q.Offset)
+	}
+	if q.Limit > 0 {
+		query = query.Limit(q.Limit)
+	}
+	if len(q.Fields) > 0 {
+		var fields = make([]interface{}, len(q.Fields))
+		for pos, field := range q.Fields {
+			fields[pos] = field
+		}
+		query = query.Pluck(fields...)
+	}
+
+	res, err := query.Run(c.Session)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	var response []interface{}
+	if err = res.All(&response); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// CountByQuery returns how many records match the query in total, ignoring
+// any sorting, offset or limit
+func (c *Connection) CountByQuery(table string, q Query) (int, error) {
+	res, err := q.filterTerm(table).Count().Run(c.Session)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Close()
+
+	var count int
+	if err = res.One(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// DisableByQuery soft-deletes every record that matches the query and
+// returns how many were removed
+func (c *Connection) DisableByQuery(table string, q Query) (int, error) {
+	resp, err := q.filterTerm(table).
+		Update(map[string]interface{}{"deletedAt": time.Now().UTC().Unix()}).
+		RunWrite(c.Session)
+	if err != nil {
+		return 0, err
+	}
+
+	return resp.Replaced, nil
+}
+
+// DeleteByQuery hard-deletes every record that matches the query and returns
+// how many were removed
+func (c *Connection) DeleteByQuery(table string, q Query) (int, error) {
+	resp, err := q.filterTerm(table).Delete().RunWrite(c.Session)
+	if err != nil {
+		return 0, err
+	}
+
+	return resp.Deleted, nil
+}
@@ -24,18 +24,25 @@ type Connection struct {
 type Database interface {
 	Connect() error
 	Close() error
-	GetSingle(table string) (interface{}, error)
+	GetSingle(filter map[string]interface{}, table string) (interface{}, error)
 	GetMultiple(table string, limit int) ([]interface{}, error)
 	GetAll(table string) ([]interface{}, error)
-	GetByUUID(table string, uid string) (interface{}, error)
+	GetByUUID(uid string, table string) (interface{}, error)
 	GetByFilter(table string, filter map[string]interface{}, limit int) ([]interface{}, error)
+	GetByFilterIn(table string, filter map[string]interface{}, field string, values []interface{}) ([]interface{}, error)
+	GetByQuery(table string, q Query) ([]interface{}, error)
+	CountByQuery(table string, q Query) (int, error)
 	GetRandom(table string, filter map[string]interface{}) (interface{}, error)
 	Update(table string, uid string, data map[string]interface{}) (interface{}, error)
+	UpdateVersioned(table string, uid string, versions []int, data map[string]interface{}) (bool, error)
 	Create(table string, data map[string]interface{}) (interface{}, error)
+	Upsert(table string, data map[string]interface{}) (interface{}, error)
 	Delete(table string, uid string) (interface{}, error)  // Hard deletion
+	DeleteByQuery(table string, q Query) (int, error)      // Hard deletion
 	Disable(table string, uid string) (interface{}, error) // Soft deletion
-	Exists(table string, filter map[string]interface{}) (interface{}, error)
-	Status(table string) (interface{}, error)
+	DisableByQuery(table string, q Query) (int, error)     // Soft deletion
+	Status() ([]Issue, error)
+	Changes(tables []string, stop <-chan struct{}) (<-chan Change, error) // Every write to the tables as it happens
 }
 
 // Issue is the schema for any responses from RethinkDB will be in
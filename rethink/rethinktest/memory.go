@@ -0,0 +1,531 @@
+// Package rethinktest provides an in-memory database for testing anything
+// that uses a rethink.Database without needing RethinkDB running
+package rethinktest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CactusDev/Xerophi/rethink"
+
+	"github.com/Google/uuid"
+)
+
+// Memory is a rethink.Database that keeps every table in memory. Records are
+// stored and returned the way RethinkDB would, so numbers come back as
+// float64s. It doesn't have changefeeds of its own, wrap it in a
+// rethink.Publishing for those
+type Memory struct {
+	mutex  sync.Mutex
+	tables map[string]map[string]map[string]interface{}
+}
+
+// NewMemory returns an empty in-memory database
+func NewMemory() *Memory {
+	return &Memory{tables: make(map[string]map[string]map[string]interface{})}
+}
+
+// plain copies the value through JSON so nothing outside can change what's
+// stored, and numbers are float64s the same as they'd come back from the DB
+func plain(value interface{}) interface{} {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		panic(fmt.Sprintf("rethinktest: can't store %#v: %s", value, err))
+	}
+	var decoded interface{}
+	json.Unmarshal(encoded, &decoded)
+	return decoded
+}
+
+// copied returns a copy of the record as it's stored
+func copied(record map[string]interface{}) map[string]interface{} {
+	mapped, _ := plain(record).(map[string]interface{})
+	return mapped
+}
+
+// table returns the records in the table, creating it if needed
+func (m *Memory) table(name string) map[string]map[string]interface{} {
+	if m.tables == nil {
+		m.tables = make(map[string]map[string]map[string]interface{})
+	}
+	if m.tables[name] == nil {
+		m.tables[name] = make(map[string]map[string]interface{})
+	}
+	return m.tables[name]
+}
+
+// ordered returns the table's records ordered by ID, so results are the same
+// every time
+func (m *Memory) ordered(name string) []map[string]interface{} {
+	table := m.table(name)
+	var ids = make([]string, 0, len(table))
+	for id := range table {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	var records = make([]map[string]interface{}, len(ids))
+	for pos, id := range ids {
+		records[pos] = table[id]
+	}
+	return records
+}
+
+// live returns if the record hasn't been soft-deleted
+func live(record map[string]interface{}) bool {
+	deletedAt, _ := record["deletedAt"].(float64)
+	return deletedAt == 0
+}
+
+// matches returns if every field in the filter is equal in the record
+func matches(record map[string]interface{}, filter map[string]interface{}) bool {
+	for field, want := range filter {
+		have, ok := record[field]
+		if !ok || !reflect.DeepEqual(have, plain(want)) {
+			return false
+		}
+	}
+	return true
+}
+
+// rank orders values of different types, the same way RethinkDB does for the
+// types records are stored with
+func rank(value interface{}) int {
+	switch value.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case float64:
+		return 2
+	case string:
+		return 3
+	}
+	return 4
+}
+
+// compare returns -1, 0 or 1 as a is before, the same as or after b
+func compare(a interface{}, b interface{}) int {
+	a, b = plain(a), plain(b)
+	if ra, rb := rank(a), rank(b); ra != rb {
+		if ra < rb {
+			return -1
+		}
+		return 1
+	}
+	switch a := a.(type) {
+	case bool:
+		switch {
+		case a == b.(bool):
+			return 0
+		case !a:
+			return -1
+		}
+		return 1
+	case float64:
+		switch {
+		case a < b.(float64):
+			return -1
+		case a > b.(float64):
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(a, b.(string))
+	}
+	return 0
+}
+
+// passes returns if the record meets the condition, records without the
+// field never do
+func passes(record map[string]interface{}, cond rethink.Condition) bool {
+	value, ok := record[cond.Field]
+	if !ok {
+		return false
+	}
+	switch cond.Op {
+	case rethink.Prefix:
+		text, ok := value.(string)
+		return ok && strings.HasPrefix(text, fmt.Sprint(cond.Value))
+	case rethink.Contains:
+		text, ok := value.(string)
+		return ok && strings.Contains(strings.ToLower(text), strings.ToLower(fmt.Sprint(cond.Value)))
+	case rethink.Gt:
+		return compare(value, cond.Value) > 0
+	case rethink.Gte:
+		return compare(value, cond.Value) >= 0
+	case rethink.Lt:
+		return compare(value, cond.Value) < 0
+	case rethink.Lte:
+		return compare(value, cond.Value) <= 0
+	}
+	return reflect.DeepEqual(value, plain(cond.Value))
+}
+
+// selected returns if the record is one the query matches, ignoring its
+// sorting and paging
+func selected(record map[string]interface{}, q rethink.Query) bool {
+	switch q.Deleted {
+	case rethink.LiveOnly:
+		if !live(record) {
+			return false
+		}
+	case rethink.DeletedOnly:
+		if live(record) {
+			return false
+		}
+	}
+	if !matches(record, q.Filter) {
+		return false
+	}
+	for field, values := range q.In {
+		var found bool
+		for _, value := range plain(values).([]interface{}) {
+			found = found || reflect.DeepEqual(record[field], value)
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, rng := range q.Ranges {
+		value, ok := record[rng.Field]
+		if !ok && (rng.Min != nil || rng.Max != nil) {
+			return false
+		}
+		if rng.Min != nil && compare(value, rng.Min) < 0 {
+			return false
+		}
+		if rng.Max != nil && compare(value, rng.Max) >= 0 {
+			return false
+		}
+	}
+	for _, cond := range q.Where {
+		if !passes(record, cond) {
+			return false
+		}
+	}
+	return true
+}
+
+// query returns the records the query matches in order, before any offset or
+// limit
+func (m *Memory) query(table string, q rethink.Query) []map[string]interface{} {
+	var found []map[string]interface{}
+	for _, record := range m.ordered(table) {
+		if selected(record, q) {
+			found = append(found, record)
+		}
+	}
+	if len(q.Sort) == 0 {
+		return found
+	}
+
+	first := q.Sort[0]
+	sorts := append(append([]rethink.Sort(nil), q.Sort...),
+		rethink.Sort{Field: "id", Descending: first.Descending})
+	if q.After != nil {
+		var after []map[string]interface{}
+		for _, record := range found {
+			if beyond(record, sorts, q.After) {
+				after = append(after, record)
+			}
+		}
+		found = after
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		for _, by := range sorts {
+			order := compare(found[i][by.Field], found[j][by.Field])
+			if order == 0 {
+				continue
+			}
+			return (order < 0) != by.Descending
+		}
+		return false
+	})
+	return found
+}
+
+// beyond returns if the record comes after the position, comparing each sort
+// field in turn and then the ID
+func beyond(record map[string]interface{}, sorts []rethink.Sort, position *rethink.Position) bool {
+	last := len(sorts) - 1
+	for pos, by := range sorts {
+		var order int
+		if pos == last {
+			order = compare(record["id"], position.ID)
+		} else if pos < len(position.Values) {
+			order = compare(record[by.Field], position.Values[pos])
+		}
+		if order != 0 {
+			return (order > 0) != by.Descending
+		}
+	}
+	return false
+}
+
+// merge updates the record with the data, merging nested objects the way
+// RethinkDB's update does
+func merge(record map[string]interface{}, data map[string]interface{}) {
+	for field, value := range data {
+		nested, ok := value.(map[string]interface{})
+		existing, isMap := record[field].(map[string]interface{})
+		if ok && isMap {
+			merge(existing, nested)
+			continue
+		}
+		record[field] = value
+	}
+}
+
+// Connect does nothing, there's nothing to connect to
+func (m *Memory) Connect() error { return nil }
+
+// Close does nothing, there's nothing to disconnect from
+func (m *Memory) Close() error { return nil }
+
+// Status never has any issues to report
+func (m *Memory) Status() ([]rethink.Issue, error) { return nil, nil }
+
+// Changes isn't supported, wrap the database in a rethink.Publishing instead
+func (m *Memory) Changes(tables []string, stop <-chan struct{}) (<-chan rethink.Change, error) {
+	return nil, errors.New("rethinktest: changefeeds need a rethink.Publishing")
+}
+
+// GetSingle returns the first record the filter matches whether it's
+// soft-deleted or not, nil if there aren't any
+func (m *Memory) GetSingle(filter map[string]interface{}, table string) (interface{}, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, record := range m.ordered(table) {
+		if matches(record, filter) {
+			return copied(record), nil
+		}
+	}
+	return nil, nil
+}
+
+// GetMultiple returns up to limit records that aren't soft-deleted
+func (m *Memory) GetMultiple(table string, limit int) ([]interface{}, error) {
+	return m.GetByFilter(table, nil, limit)
+}
+
+// GetAll returns every record that isn't soft-deleted
+func (m *Memory) GetAll(table string) ([]interface{}, error) {
+	return m.GetByFilter(table, nil, 0)
+}
+
+// GetByUUID returns the record with the ID, nil if there isn't one
+func (m *Memory) GetByUUID(uid string, table string) (interface{}, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	record, ok := m.table(table)[uid]
+	if !ok {
+		return nil, nil
+	}
+	if !live(record) {
+		return copied(record), rethink.RetrievalResult{
+			Success: true, SoftDeleted: true, Message: "Requested UUID is soft-deleted"}
+	}
+	return copied(record), nil
+}
+
+// GetByFilter returns up to limit records the filter matches that aren't
+// soft-deleted
+func (m *Memory) GetByFilter(table string, filter map[string]interface{}, limit int) ([]interface{}, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var response []interface{}
+	for _, record := range m.ordered(table) {
+		if limit > 0 && len(response) == limit {
+			break
+		}
+		if live(record) && matches(record, filter) {
+			response = append(response, copied(record))
+		}
+	}
+	return response, nil
+}
+
+// GetByFilterIn is like GetByFilter, except the field also has to be one of
+// the values
+func (m *Memory) GetByFilterIn(table string, filter map[string]interface{}, field string, values []interface{}) ([]interface{}, error) {
+	return m.GetByQuery(table, rethink.Query{
+		Filter: filter,
+		In:     map[string][]interface{}{field: values},
+	})
+}
+
+// GetByQuery returns all the records that match the query
+func (m *Memory) GetByQuery(table string, q rethink.Query) ([]interface{}, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	found := m.query(table, q)
+	if q.Offset >= len(found) {
+		return nil, nil
+	}
+	found = found[q.Offset:]
+	if q.Limit > 0 && q.Limit < len(found) {
+		found = found[:q.Limit]
+	}
+
+	var response = make([]interface{}, 0, len(found))
+	for _, record := range found {
+		record = copied(record)
+		if len(q.Fields) > 0 {
+			var plucked = make(map[string]interface{}, len(q.Fields))
+			for _, field := range q.Fields {
+				if value, ok := record[field]; ok {
+					plucked[field] = value
+				}
+			}
+			record = plucked
+		}
+		response = append(response, record)
+	}
+	return response, nil
+}
+
+// CountByQuery returns how many records match the query, ignoring any
+// sorting, offset or limit
+func (m *Memory) CountByQuery(table string, q rethink.Query) (int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var count int
+	for _, record := range m.table(table) {
+		if selected(record, q) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// GetRandom returns a random record the filter matches that isn't
+// soft-deleted, nil if there aren't any
+func (m *Memory) GetRandom(table string, filter map[string]interface{}) (interface{}, error) {
+	response, _ := m.GetByFilter(table, filter, 0)
+	if len(response) == 0 {
+		return nil, nil
+	}
+	return response[rand.Intn(len(response))], nil
+}
+
+// Update merges the data into the record, doing nothing if it doesn't exist
+func (m *Memory) Update(table string, uid string, data map[string]interface{}) (interface{}, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if record, ok := m.table(table)[uid]; ok {
+		merge(record, copied(data))
+	}
+	return nil, nil
+}
+
+// UpdateVersioned updates the record and bumps its version, only if it's at
+// one of the versions when they're given
+func (m *Memory) UpdateVersioned(table string, uid string, versions []int, data map[string]interface{}) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	record, ok := m.table(table)[uid]
+	if !ok {
+		return false, nil
+	}
+	current, _ := record["version"].(float64)
+	if versions != nil {
+		var allowed bool
+		for _, version := range versions {
+			allowed = allowed || float64(version) == current
+		}
+		if !allowed {
+			return false, nil
+		}
+	}
+	merge(record, copied(data))
+	record["version"] = current + 1
+	return true, nil
+}
+
+// Create adds the record, giving it an ID if it doesn't have one. Errors if
+// there's already a record with its ID
+func (m *Memory) Create(table string, data map[string]interface{}) (interface{}, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	record := copied(data)
+	id, _ := record["id"].(string)
+	if id == "" {
+		id = uuid.New().String()
+		record["id"] = id
+	}
+	if _, exists := m.table(table)[id]; exists {
+		return nil, fmt.Errorf("Duplicate primary key `id`: %s", id)
+	}
+	m.table(table)[id] = record
+	return nil, nil
+}
+
+// Upsert adds the record, replacing any with the same ID
+func (m *Memory) Upsert(table string, data map[string]interface{}) (interface{}, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	record := copied(data)
+	id, _ := record["id"].(string)
+	if id == "" {
+		id = uuid.New().String()
+		record["id"] = id
+	}
+	m.table(table)[id] = record
+	return nil, nil
+}
+
+// Delete removes the record
+func (m *Memory) Delete(table string, uid string) (interface{}, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.table(table), uid)
+	return nil, nil
+}
+
+// DeleteByQuery removes every record the query matches and returns how many
+// were removed
+func (m *Memory) DeleteByQuery(table string, q rethink.Query) (int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var removed int
+	for id, record := range m.table(table) {
+		if selected(record, q) {
+			delete(m.table(table), id)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// Disable soft-deletes the record
+func (m *Memory) Disable(table string, uid string) (interface{}, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if record, ok := m.table(table)[uid]; ok {
+		record["deletedAt"] = float64(time.Now().UTC().Unix())
+	}
+	return nil, nil
+}
+
+// DisableByQuery soft-deletes every record the query matches and returns how
+// many were
+func (m *Memory) DisableByQuery(table string, q rethink.Query) (int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var disabled int
+	now := float64(time.Now().UTC().Unix())
+	for _, record := range m.table(table) {
+		if selected(record, q) {
+			record["deletedAt"] = now
+			disabled++
+		}
+	}
+	return disabled, nil
+}
@@ -41,17 +41,22 @@ func (c *Connection) GetSingle(filter map[string]interface{}, table string) (int
 	return response, nil
 }
 
-// GetByUUID returns a single object from the current table via the uuid
+// GetByUUID returns a single object from the current table via the uuid, nil
+// if there isn't one
 func (c *Connection) GetByUUID(uuid string, table string) (interface{}, error) {
 	res, err := r.Table(table).Get(uuid).Run(c.Session)
-	defer res.Close()
 	if err != nil {
 		return nil, err
 	}
+	defer res.Close()
 	var response interface{}
 	res.One(&response)
 
-	if response.(map[string]interface{})["deletedAt"].(float64) != 0 {
+	record, _ := response.(map[string]interface{})
+	if record == nil {
+		return nil, nil
+	}
+	if deletedAt, _ := record["deletedAt"].(float64); deletedAt != 0 {
 		// Don't include anything that has a non-zero deletedAt (soft deleted)
 		return response, RetrievalResult{true, true, "Requested UUID is soft-deleted"}
 	}
@@ -138,3 +143,25 @@ func (c *Connection) GetRandom(table string, filter map[string]interface{}) (int
 
 	return response[rand.Intn(len(response))], nil
 }
+
+// GetByFilterIn is like GetByFilter, except it also only returns records where
+// the field given is one of the values provided. Soft-deleted records are
+// filtered out by the database rather than afterwards
+func (c *Connection) GetByFilterIn(table string, filter map[string]interface{}, field string, values []interface{}) ([]interface{}, error) {
+	query := r.Table(table).Filter(filter).
+		Filter(r.Row.Field("deletedAt").Eq(0)).
+		Filter(r.Expr(values).Contains(r.Row.Field(field)))
+
+	res, err := query.Run(c.Session)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	var response []interface{}
+	if err = res.All(&response); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
@@ -0,0 +1,59 @@
+package revision
+
+import (
+	"fmt"
+
+	"github.com/CactusDev/Xerophi/types"
+	"github.com/CactusDev/Xerophi/util"
+)
+
+// Actions a revision can record
+const (
+	Create   = "create"
+	Update   = "update"
+	Delete   = "delete"
+	Restore  = "restore"
+	Rollback = "rollback"
+	Import   = "import"
+)
+
+// Change is the before and after value of a single field
+type Change struct {
+	From interface{} `json:"from" mapstructure:"from"`
+	To   interface{} `json:"to" mapstructure:"to"`
+}
+
+// ResponseSchema is the schema for the data that will be sent out to the client
+type ResponseSchema struct {
+	ID        string            `jsonapi:"primary,revision"`
+	Number    int               `jsonapi:"attr,number" filter:"eq,gt,gte,lt,lte"`
+	Action    string            `jsonapi:"attr,action" filter:"eq"`
+	Author    string            `jsonapi:"attr,author" filter:"eq"`
+	Changes   map[string]Change `jsonapi:"attr,changes"`
+	From      int               `jsonapi:"attr,from"` // The revision rolled back to, if it's a rollback
+	CreatedAt string            `jsonapi:"meta,createdAt,time" filter:"gt,gte,lt,lte"`
+	Token     string            `jsonapi:"meta,token"`
+	Resource  string            `jsonapi:"meta,resource"`
+	Key       string            `jsonapi:"meta,key"`
+}
+
+// SelfLink returns the URL the revision can be retrieved from
+func (rs ResponseSchema) SelfLink() string {
+	return fmt.Sprintf("%s/history/%d",
+		util.ResourceLink(rs.Token, rs.Resource, rs.Key), rs.Number)
+}
+
+// JSONAPIMeta returns a meta object for the response
+func (rs ResponseSchema) JSONAPIMeta() *types.Meta {
+	return &types.Meta{
+		"createdAt": rs.CreatedAt,
+		"token":     rs.Token,
+		"resource":  rs.Resource,
+		"key":       rs.Key,
+	}
+}
+
+// GetAPITag allows each of these types to implement the JSONAPISchema interface
+func (rs ResponseSchema) GetAPITag(lookup string) string {
+	return util.FieldTag(rs, lookup, "jsonapi")
+}
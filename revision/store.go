@@ -0,0 +1,166 @@
+package revision
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CactusDev/Xerophi/rethink"
+
+	mapstruct "github.com/mitchellh/mapstructure"
+)
+
+// Store keeps every change made to a resource's records so they can be
+// looked back over and rolled back
+type Store struct {
+	DB    rethink.Database // The storage backend the revisions are kept in
+	Table string           // The table the revisions are kept in
+}
+
+// Entry is everything needed to record a single revision
+type Entry struct {
+	Token    string
+	Resource string // The resource the record belongs to, e.g. "command"
+	Key      string // The record's key, e.g. the command name
+	Action   string
+	Author   string                 // Who made the change, if we know
+	From     int                    // The revision rolled back to
+	Before   map[string]interface{} // The record before the change, nil if it was just created
+	After    map[string]interface{} // The record after the change
+}
+
+// ignored are the fields that aren't worth recording a change to
+var ignored = map[string]struct{}{
+	"id":      {},
+	"version": {},
+}
+
+// Diff returns the fields that differ between the two versions of a record
+func Diff(before map[string]interface{}, after map[string]interface{}) map[string]Change {
+	var changes = make(map[string]Change)
+	for field, to := range after {
+		if _, skip := ignored[field]; skip {
+			continue
+		}
+		from, existed := before[field]
+		if !existed || !reflect.DeepEqual(from, to) {
+			changes[field] = Change{From: from, To: to}
+		}
+	}
+	for field, from := range before {
+		if _, skip := ignored[field]; skip {
+			continue
+		}
+		if _, exists := after[field]; !exists {
+			changes[field] = Change{From: from, To: nil}
+		}
+	}
+	return changes
+}
+
+// Filter picks out every revision of a single record
+func Filter(token string, resource string, key string) map[string]interface{} {
+	return map[string]interface{}{"token": token, "resource": resource, "key": key}
+}
+
+// maxAttempts is how many numbers are tried for a revision before giving up.
+// A number's only taken if another revision of the record was recorded at the
+// same time
+const maxAttempts = 10
+
+// revisionID is the ID a revision is stored under, made from its number so
+// the database turns away a second revision with the same one
+func revisionID(token string, resource string, key string, number int) string {
+	sum := sha256.Sum256([]byte(strings.Join(
+		[]string{token, resource, key, strconv.Itoa(number)}, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// latest returns the number of the record's latest revision, 0 if it doesn't
+// have any
+func (s *Store) latest(token string, resource string, key string) (int, error) {
+	fromDB, err := s.DB.GetByQuery(s.Table, rethink.Query{
+		Filter: Filter(token, resource, key),
+		Sort:   []rethink.Sort{{Field: "number", Descending: true}},
+		Limit:  1,
+		Fields: []string{"number"},
+	})
+	if err != nil || len(fromDB) == 0 {
+		return 0, err
+	}
+	record, _ := fromDB[0].(map[string]interface{})
+	number, _ := record["number"].(float64)
+	return int(number), nil
+}
+
+// Record saves a new revision, numbered one after the latest revision of the
+// record. If another revision takes that number first the next one is tried
+func (s *Store) Record(entry Entry) error {
+	latest, err := s.latest(entry.Token, entry.Resource, entry.Key)
+	if err != nil {
+		return err
+	}
+
+	var changes = make(map[string]interface{})
+	for field, change := range Diff(entry.Before, entry.After) {
+		changes[field] = map[string]interface{}{"from": change.From, "to": change.To}
+	}
+
+	for number := latest + 1; number <= latest+maxAttempts; number++ {
+		id := revisionID(entry.Token, entry.Resource, entry.Key, number)
+		_, err = s.DB.Create(s.Table, map[string]interface{}{
+			"id":        id,
+			"token":     entry.Token,
+			"resource":  entry.Resource,
+			"key":       entry.Key,
+			"number":    number,
+			"action":    entry.Action,
+			"author":    entry.Author,
+			"from":      entry.From,
+			"changes":   changes,
+			"snapshot":  entry.After,
+			"createdAt": time.Now().UTC().Format(time.RFC3339),
+			"deletedAt": 0,
+		})
+		if err == nil {
+			return nil
+		}
+		// Only try the next number if this one's actually been taken
+		taken, lookupErr := s.DB.GetSingle(map[string]interface{}{"id": id}, s.Table)
+		if lookupErr != nil || taken == nil {
+			return err
+		}
+	}
+	return fmt.Errorf("Couldn't number the revision after %d attempts: %s", maxAttempts, err)
+}
+
+// Get retrieves a single revision along with the snapshot of the record as it
+// was after it. Returns nil if the revision doesn't exist
+func (s *Store) Get(token string, resource string, key string, number int) (*ResponseSchema, map[string]interface{}, error) {
+	where := Filter(token, resource, key)
+	where["number"] = number
+	fromDB, err := s.DB.GetByFilter(s.Table, where, 1)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(fromDB) == 0 {
+		return nil, nil, nil
+	}
+
+	record, ok := fromDB[0].(map[string]interface{})
+	if !ok {
+		return nil, nil, errors.New("Unable to typecast response to correct type")
+	}
+	var revision ResponseSchema
+	if err := mapstruct.Decode(record, &revision); err != nil {
+		return nil, nil, err
+	}
+	snapshot, _ := record["snapshot"].(map[string]interface{})
+
+	return &revision, snapshot, nil
+}
@@ -0,0 +1,62 @@
+package revision
+
+import (
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/CactusDev/Xerophi/rethink/rethinktest"
+)
+
+func TestRecordNumbersConcurrently(t *testing.T) {
+	store := &Store{DB: rethinktest.NewMemory(), Table: "revisions"}
+	const writers = 5
+
+	var wait sync.WaitGroup
+	for pos := 0; pos < writers; pos++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			if err := store.Record(Entry{Token: "channel", Resource: "command", Key: "hello",
+				Action: Update, After: map[string]interface{}{"enabled": true}}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wait.Wait()
+
+	fromDB, err := store.DB.GetByFilter("revisions", Filter("channel", "command", "hello"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var numbers []int
+	for _, record := range fromDB {
+		number, _ := record.(map[string]interface{})["number"].(float64)
+		numbers = append(numbers, int(number))
+	}
+	sort.Ints(numbers)
+	for pos, number := range numbers {
+		if number != pos+1 {
+			t.Fatalf("expected revisions 1 to %d, got %v", writers, numbers)
+		}
+	}
+	if len(numbers) != writers {
+		t.Fatalf("expected %d revisions, got %v", writers, numbers)
+	}
+}
+
+func TestRecordSkipsTakenNumbers(t *testing.T) {
+	db := rethinktest.NewMemory()
+	store := &Store{DB: db, Table: "revisions"}
+	// Something else has already got the next number but isn't visible as
+	// the latest yet
+	db.Create("revisions", map[string]interface{}{"id": revisionID("channel", "command", "hello", 1)})
+
+	if err := store.Record(Entry{Token: "channel", Resource: "command", Key: "hello", Action: Create}); err != nil {
+		t.Fatal(err)
+	}
+	revision, _, err := store.Get("channel", "command", "hello", 2)
+	if err != nil || revision == nil {
+		t.Fatalf("expected revision 2, got %v, %v", revision, err)
+	}
+}
@@ -1,8 +1,88 @@
 package schemas
 
+import (
+	"sort"
+	"strings"
+)
+
 // MessagePacket is the low-level format for storing contents of a message and arguments
 type MessagePacket struct {
 	Data string `jsonapi:"attr,data" json:"data" validate:"required"`
 	Text string `jsonapi:"attr,text" json:"text" validate:"required"`
 	Type string `jsonapi:"attr,type" json:"type" validate:"required"`
 }
+
+// Render returns a copy of the packet with every %VARIABLE% in it replaced by
+// its value. Variable names are case-insensitive and unknown ones are left
+// alone. If two of the variables only differ by case, the one that sorts first
+// is used
+func (mp MessagePacket) Render(vars map[string]string) MessagePacket {
+	return mp.render(variables(vars))
+}
+
+// render replaces the variables in the packet, keyed by their uppercased names
+func (mp MessagePacket) render(values map[string]string) MessagePacket {
+	return MessagePacket{
+		Data: render(mp.Data, values),
+		Text: render(mp.Text, values),
+		Type: mp.Type,
+	}
+}
+
+// variables keys the values by their uppercased names. The names are gone
+// through in order, so it's the same every time when two only differ by case
+func variables(vars map[string]string) map[string]string {
+	var names = make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var values = make(map[string]string, len(vars))
+	for _, name := range names {
+		upper := strings.ToUpper(name)
+		if _, taken := values[upper]; !taken {
+			values[upper] = vars[name]
+		}
+	}
+	return values
+}
+
+// render replaces every variable in the text. The values themselves aren't
+// rendered, so a value with a %VARIABLE% in it is left as it is
+func render(text string, values map[string]string) string {
+	var rendered strings.Builder
+	for {
+		start := strings.IndexByte(text, '%')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(text[start+1:], '%')
+		if end < 0 {
+			break
+		}
+		end += start + 1
+
+		if value, ok := values[strings.ToUpper(text[start+1:end])]; ok {
+			rendered.WriteString(text[:start])
+			rendered.WriteString(value)
+			text = text[end+1:]
+			continue
+		}
+		// Not a variable, but the closing % might be the start of one
+		rendered.WriteString(text[:end])
+		text = text[end:]
+	}
+	rendered.WriteString(text)
+	return rendered.String()
+}
+
+// RenderAll renders every packet in a message with the variables given
+func RenderAll(packets []MessagePacket, vars map[string]string) []MessagePacket {
+	values := variables(vars)
+	var rendered = make([]MessagePacket, len(packets))
+	for pos, packet := range packets {
+		rendered[pos] = packet.render(values)
+	}
+	return rendered
+}
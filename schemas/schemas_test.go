@@ -0,0 +1,35 @@
+package schemas
+
+import "testing"
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		vars map[string]string
+		want string
+	}{
+		{"plain", "hello", map[string]string{"user": "bob"}, "hello"},
+		{"variable", "hi %USER%!", map[string]string{"user": "bob"}, "hi bob!"},
+		{"any case", "hi %user% %User%", map[string]string{"USER": "bob"}, "hi bob bob"},
+		{"unknown", "hi %NOPE%", map[string]string{"user": "bob"}, "hi %NOPE%"},
+		{"adjacent", "%USER%%COUNT%", map[string]string{"user": "bob", "count": "3"}, "bob3"},
+		{"after unknown", "%NOPE%USER%", map[string]string{"user": "bob"}, "%NOPEbob"},
+		{"percentages", "100% of %USER%", map[string]string{"user": "bob"}, "100% of bob"},
+		{"unclosed", "50% %USER", map[string]string{"user": "bob"}, "50% %USER"},
+		{"empty", "%%", map[string]string{"user": "bob"}, "%%"},
+		{"values aren't rendered", "%USER%", map[string]string{"user": "%COUNT%", "count": "3"}, "%COUNT%"},
+		{"collisions", "%USER%", map[string]string{"user": "lower", "USER": "upper", "User": "title"}, "upper"},
+	}
+
+	for _, test := range tests {
+		// Maps are iterated in a different order each time, so collisions
+		// have to come out the same way every time
+		for run := 0; run < 20; run++ {
+			got := MessagePacket{Text: test.text, Data: test.text, Type: "text"}.Render(test.vars)
+			if got.Text != test.want || got.Data != test.want {
+				t.Fatalf("%s: expected %q, got %q", test.name, test.want, got.Text)
+			}
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package social
+
+import (
+	"errors"
+	"html"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/CactusDev/Xerophi/archive"
+	"github.com/CactusDev/Xerophi/resource"
+	"github.com/CactusDev/Xerophi/rethink"
+	"github.com/CactusDev/Xerophi/schemas"
+	"github.com/CactusDev/Xerophi/types"
+	"github.com/CactusDev/Xerophi/util"
+
+	"github.com/gin-gonic/gin"
+
+	mapstruct "github.com/mitchellh/mapstructure"
+	log "github.com/sirupsen/logrus"
+)
+
+// Social is the struct that implements the handler interface for the social resource
+type Social struct {
+	Conn  rethink.Database // The storage backend
+	Table string           // The database table we're using
+}
+
+// Resource returns the generic handler for social links, which are keyed by
+// name
+func (s *Social) Resource() *resource.Resource {
+	return &resource.Resource{
+		Conn:   s.Conn,
+		Table:  s.Table,
+		Name:   "Social link",
+		Plural: "social links",
+		Key: resource.Key{
+			Param: "name", Field: "name", Parse: parseName,
+		},
+		Schema:       ResponseSchema{},
+		CreateSchema: "/social/createSchema.json",
+		UpdateSchema: "/social/schema.json",
+		UpdateBody:   UpdateSchema{},
+		CreatePath:   "/:name",
+		Reserved:     map[string]gin.HandlerFunc{"summary": s.GetSummary},
+		Hooks: resource.Hooks{
+			Defaults: s.defaults,
+			Validate: validateLink,
+		},
+	}
+}
+
+// Routes returns the routing information for this endpoint
+func (s *Social) Routes() []types.RouteDetails {
+	return s.Resource().Routes()
+}
+
+// Archive describes how social links are exported and imported
+func (s *Social) Archive() archive.Kind {
+	return archive.Kind{
+		Name:     "socials",
+		Table:    s.Table,
+		Key:      []string{"name"},
+		Parse:    map[string]func(string) (interface{}, error){"name": parseName},
+		Schema:   "/social/createSchema.json",
+		Client:   ClientSchema{},
+		Defaults: map[string]interface{}{"enabled": true},
+	}
+}
+
+// parseName normalizes a social's name the way its routes do
+func parseName(raw string) (interface{}, error) {
+	return strings.ToLower(html.EscapeString(raw)), nil
+}
+
+// defaults are the values a new link starts with, it's named by the route
+func (s *Social) defaults(ctx *gin.Context, token string) (interface{}, interface{}, error) {
+	name, _ := parseName(ctx.Param("name"))
+	createVals := CreationSchema{
+		CreatedAt: time.Now().UTC(),
+		DeletedAt: 0,
+		Token:     token,
+		Name:      name.(string),
+		Enabled:   true,
+	}
+
+	// summary is taken by the summary endpoint, so it can't be a link name
+	if createVals.Name == "summary" {
+		return nil, nil, errors.New("summary is a reserved name")
+	}
+	return createVals, createVals.Name, nil
+}
+
+// validateLink makes sure the URL is the right kind for the service, since
+// the JSON schema only knows it's a URL. Changing either the service or the
+// URL means the pair needs to be checked again, so whichever one isn't
+// changing is filled in from the current link
+func validateLink(current util.JSONAPISchema, data map[string]interface{}) error {
+	var service, url string
+	if link, ok := current.(ResponseSchema); ok {
+		service, url = link.Service, link.URL
+	}
+	if val, ok := data["service"].(string); ok {
+		service = val
+	}
+	if val, ok := data["url"].(string); ok {
+		url = val
+	}
+	return validateURL(service, url)
+}
+
+// ReturnAll retrieves all of the non-deleted links for the token given
+func (s *Social) ReturnAll(token string) ([]ResponseSchema, error) {
+	filter := map[string]interface{}{"token": token}
+	fromDB, err := s.Conn.GetByFilter(s.Table, filter, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var links = make([]ResponseSchema, 0, len(fromDB))
+	for _, record := range fromDB {
+		var link ResponseSchema
+		// If there's an issue decoding it, just log it and move on to the next record
+		if err := mapstruct.Decode(record, &link); err != nil {
+			log.Error(err.Error())
+			continue
+		}
+		links = append(links, link)
+	}
+
+	return links, nil
+}
+
+// GetSummary renders all of the enabled links into a message that can be
+// sent straight to chat
+func (s *Social) GetSummary(ctx *gin.Context) {
+	token := strings.ToLower(html.EscapeString(ctx.Param("token")))
+	links, err := s.ReturnAll(token)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+
+	summary := SummarySchema{
+		ID:      token,
+		Packets: Summarize(links),
+		Socials: make([]ResponseSchema, 0, len(links)),
+		Token:   token,
+	}
+	for _, link := range links {
+		if link.Enabled {
+			summary.Socials = append(summary.Socials, link)
+		}
+	}
+	if len(summary.Packets) == 0 {
+		// Nothing enabled, so there's nothing to say
+		util.Abort(ctx, util.ErrNotFound, "No social links are enabled")
+		return
+	}
+
+	ctx.Header("x-total-count", "1")
+	ctx.JSON(http.StatusOK, util.MarshalResponse(summary))
+}
+
+// Summarize turns a list of links into the message packets for a summary,
+// e.g. "Twitter: <url> | Discord: <url>"
+func Summarize(links []ResponseSchema) []schemas.MessagePacket {
+	var packets = make([]schemas.MessagePacket, 0)
+
+	// Keep the summary in a predictable order
+	sort.Slice(links, func(i, j int) bool { return links[i].Name < links[j].Name })
+
+	for _, link := range links {
+		if !link.Enabled {
+			continue
+		}
+		if len(packets) > 0 {
+			packets = append(packets, schemas.MessagePacket{
+				Data: " | ", Text: " | ", Type: "text"})
+		}
+		// Custom links don't have a service name, use what they called it
+		label := services[link.Service].Label
+		if label == "" {
+			label = link.Name
+		}
+		label += ": "
+		packets = append(packets,
+			schemas.MessagePacket{Data: label, Text: label, Type: "text"},
+			schemas.MessagePacket{Data: link.URL, Text: link.URL, Type: "url"},
+		)
+	}
+
+	return packets
+}
@@ -0,0 +1,78 @@
+package social
+
+import (
+	"time"
+
+	"github.com/CactusDev/Xerophi/schemas"
+	"github.com/CactusDev/Xerophi/types"
+	"github.com/CactusDev/Xerophi/util"
+)
+
+// ResponseSchema is the schema for the data that will be sent out to the client
+type ResponseSchema struct {
+	ID        string `jsonapi:"primary,social"`
+	CreatedAt string `jsonapi:"meta,createdAt,time"`
+	Enabled   bool   `jsonapi:"attr,enabled" filter:"eq"`
+	Name      string `jsonapi:"attr,name" filter:"eq,prefix"`
+	Service   string `jsonapi:"attr,service" filter:"eq"`
+	URL       string `jsonapi:"attr,url"`
+	Token     string `jsonapi:"meta,token"`
+	Version   int    `jsonapi:"meta,version"`
+}
+
+// SummarySchema is the rendered summary of all of a channel's social links
+type SummarySchema struct {
+	ID      string                  `jsonapi:"primary,socialSummary"`
+	Packets []schemas.MessagePacket `jsonapi:"attr,packets"`
+	Socials []ResponseSchema        `jsonapi:"relation,socials"` // The links that are in it
+	Token   string                  `jsonapi:"meta,token"`
+}
+
+// ClientSchema is the schema the data from the client will be marshalled into
+type ClientSchema struct {
+	Enabled *bool  `json:"enabled"`
+	Service string `json:"service"`
+	URL     string `json:"url"`
+}
+
+// CreationSchema is all the data required for a new social link to be created
+type CreationSchema struct {
+	ClientSchema
+	// Ignore these fields in user input, they will be filled automatically by the API
+	CreatedAt time.Time `json:"createdAt"`
+	DeletedAt float64   `json:"deletedAt"`
+	Token     string    `json:"token"`
+	Name      string    `json:"name"`
+	Enabled   bool      `json:"enabled"`
+}
+
+// UpdateSchema is ClientSchema that is used when updating
+type UpdateSchema struct {
+	Enabled *bool  `json:"enabled,omitempty"`
+	Service string `json:"service,omitempty"`
+	URL     string `json:"url,omitempty"`
+}
+
+// SelfLink returns the URL the social link can be retrieved from
+func (rs ResponseSchema) SelfLink() string {
+	return util.ResourceLink(rs.Token, "social", rs.Name)
+}
+
+// JSONAPIMeta returns a meta object for the response
+func (rs ResponseSchema) JSONAPIMeta() *types.Meta {
+	return &types.Meta{
+		"createdAt": rs.CreatedAt,
+		"token":     rs.Token,
+		"version":   rs.Version,
+	}
+}
+
+// GetAPITag allows each of these types to implement the JSONAPISchema interface
+func (rs ResponseSchema) GetAPITag(lookup string) string {
+	return util.FieldTag(rs, lookup, "jsonapi")
+}
+
+// GetAPITag allows each of these types to implement the JSONAPISchema interface
+func (ss SummarySchema) GetAPITag(lookup string) string {
+	return util.FieldTag(ss, lookup, "jsonapi")
+}
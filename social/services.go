@@ -0,0 +1,58 @@
+package social
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/CactusDev/Xerophi/util"
+)
+
+// service describes a type of link that can be stored
+type service struct {
+	Label string   // Human-readable name of the service used in summaries
+	Hosts []string // Hosts the link is allowed to point at, empty means any
+}
+
+// services are all the link types supported by the social resource
+var services = map[string]service{
+	"twitter": {Label: "Twitter", Hosts: []string{"twitter.com", "x.com"}},
+	"youtube": {Label: "YouTube", Hosts: []string{"youtube.com", "youtu.be"}},
+	"discord": {Label: "Discord", Hosts: []string{"discord.gg", "discord.com", "discordapp.com"}},
+	"custom":  {Label: "", Hosts: []string{}},
+}
+
+// validateURL makes sure the link given is a valid URL for the service
+func validateURL(serviceName string, link string) error {
+	svc, ok := services[serviceName]
+	if !ok {
+		return util.APIError{Data: map[string]interface{}{
+			"service": fmt.Sprintf("Unknown service %s", serviceName)}}
+	}
+
+	parsed, err := url.Parse(link)
+	if err != nil || parsed.Host == "" {
+		return util.APIError{Data: map[string]interface{}{
+			"url": "Not a valid absolute URL"}}
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return util.APIError{Data: map[string]interface{}{
+			"url": "URL must use http or https"}}
+	}
+
+	// Custom links can go anywhere
+	if len(svc.Hosts) == 0 {
+		return nil
+	}
+
+	host := strings.ToLower(parsed.Hostname())
+	for _, allowed := range svc.Hosts {
+		// Allow the host itself and any of its subdomains (www., m., etc.)
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return nil
+		}
+	}
+
+	return util.APIError{Data: map[string]interface{}{
+		"url": fmt.Sprintf("URL is not a valid %s link", svc.Label)}}
+}
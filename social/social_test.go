@@ -0,0 +1,191 @@
+package social
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/CactusDev/Xerophi/rethink/rethinktest"
+	"github.com/CactusDev/Xerophi/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// setup routes socials through a router backed by an in-memory database
+func setup(t *testing.T) (http.Handler, *rethinktest.Memory) {
+	db := rethinktest.NewMemory()
+	socials := (&Social{Conn: db, Table: "socials"}).Resource()
+	// The real schemas reference each other by absolute path
+	socials.CreateSchema = "/testdata/createSchema.json"
+	socials.UpdateSchema = "/testdata/schema.json"
+
+	router := gin.New()
+	group := router.Group(util.BasePath + "/user/:token/social")
+	for _, route := range socials.Routes() {
+		group.Handle(route.Verb, route.Path, route.Handler)
+	}
+	return router, db
+}
+
+// send makes a request against the router and returns the status
+func send(router http.Handler, verb string, path string, body string) int {
+	req := httptest.NewRequest(verb, util.BasePath+"/user/channel/social"+path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder.Code
+}
+
+func TestCreateChecksURL(t *testing.T) {
+	router, db := setup(t)
+
+	if code := send(router, "POST", "/twitter", `{"service": "twitter", "url": "https://example.com"}`); code != http.StatusBadRequest {
+		t.Errorf("expected a link to the wrong host to be rejected, got %d", code)
+	}
+	if code := send(router, "POST", "/Twitter", `{"service": "twitter", "url": "https://twitter.com/channel"}`); code != http.StatusCreated {
+		t.Fatalf("expected the link to be created, got %d", code)
+	}
+	found, err := db.GetSingle(map[string]interface{}{"token": "channel", "name": "twitter"}, "socials")
+	if err != nil || found == nil {
+		t.Fatalf("expected the link to be stored under its lowercased name, got %v %v", found, err)
+	}
+}
+
+func TestCreateReservesSummary(t *testing.T) {
+	router, _ := setup(t)
+
+	if code := send(router, "POST", "/summary", `{"service": "custom", "url": "https://example.com"}`); code != http.StatusBadRequest {
+		t.Errorf("expected summary to be reserved, got %d", code)
+	}
+}
+
+func TestUpdateChecksURLAgainstStoredService(t *testing.T) {
+	router, _ := setup(t)
+	if code := send(router, "POST", "/mine", `{"service": "custom", "url": "https://example.com"}`); code != http.StatusCreated {
+		t.Fatalf("expected the link to be created, got %d", code)
+	}
+
+	// The stored URL isn't a Discord one
+	if code := send(router, "PATCH", "/mine", `{"service": "discord"}`); code != http.StatusBadRequest {
+		t.Errorf("expected changing the service to check the stored URL, got %d", code)
+	}
+	if code := send(router, "PATCH", "/mine", `{"url": "https://example.org"}`); code != http.StatusOK {
+		t.Errorf("expected a new URL for the same service to be fine, got %d", code)
+	}
+}
+
+func TestSummaryRoute(t *testing.T) {
+	router, _ := setup(t)
+
+	if code := send(router, "GET", "/summary", ""); code != http.StatusNotFound {
+		t.Errorf("expected no summary without links, got %d", code)
+	}
+	send(router, "POST", "/mine", `{"service": "custom", "url": "https://example.com"}`)
+	send(router, "POST", "/off", `{"service": "custom", "url": "https://example.org", "enabled": false}`)
+
+	req := httptest.NewRequest("GET", util.BasePath+"/user/channel/social/summary", nil)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected the summary, got %d", recorder.Code)
+	}
+
+	// Only the enabled links are related to the summary
+	var document struct {
+		Data struct {
+			Relationships struct {
+				Socials struct {
+					Data []map[string]string `json:"data"`
+				} `json:"socials"`
+			} `json:"relationships"`
+		} `json:"data"`
+		Included []map[string]interface{} `json:"included"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &document); err != nil {
+		t.Fatal(err)
+	}
+	if linkage := document.Data.Relationships.Socials.Data; len(linkage) != 1 || linkage[0]["type"] != "social" {
+		t.Errorf("expected the enabled link to be related, got %v", linkage)
+	}
+	if len(document.Included) != 1 {
+		t.Errorf("expected the enabled link to be included, got %v", document.Included)
+	}
+}
+
+func TestCreateKeepsOwnedFields(t *testing.T) {
+	router, db := setup(t)
+
+	body := `{"service": "custom", "url": "https://example.com", "token": "other",
+		"name": "renamed", "deletedAt": 5, "createdAt": "2000-01-01T00:00:00Z"}`
+	if code := send(router, "POST", "/mine", body); code != http.StatusCreated {
+		t.Fatalf("expected the link to be created, got %d", code)
+	}
+	found, err := db.GetSingle(map[string]interface{}{"token": "channel", "name": "mine"}, "socials")
+	if err != nil || found == nil {
+		t.Fatalf("expected the link to stay in the channel under its route's name, got %v %v", found, err)
+	}
+	record := found.(map[string]interface{})
+	if record["deletedAt"] != float64(0) || record["createdAt"] == "2000-01-01T00:00:00Z" {
+		t.Errorf("expected the body not to change when it was made, got %v", record)
+	}
+}
+
+func TestPagesFollowTheCursor(t *testing.T) {
+	router, _ := setup(t)
+
+	// Services repeat, so the cursor has to fall back on the ID to split them
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		service := map[string]string{"a": "twitter", "b": "youtube", "c": "twitter", "d": "youtube", "e": "twitter"}[name]
+		body := `{"service": "` + service + `", "url": "https://` + service + `.com/` + name + `"}`
+		if code := send(router, "POST", "/"+name, body); code != http.StatusCreated {
+			t.Fatalf("expected %s to be created, got %d", name, code)
+		}
+	}
+
+	seen := map[string]bool{}
+	var services []string
+	next := util.BasePath + "/user/channel/social?sort=-service&page[limit]=2"
+	for next != "" {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("GET", next, nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("expected %s to be found, got %d", next, recorder.Code)
+		}
+		var page struct {
+			Data []struct {
+				Attributes struct {
+					Name    string `json:"name"`
+					Service string `json:"service"`
+				} `json:"attributes"`
+			} `json:"data"`
+			Links map[string]string `json:"links"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &page); err != nil {
+			t.Fatal(err)
+		}
+		for _, social := range page.Data {
+			if seen[social.Attributes.Name] {
+				t.Errorf("expected %s to only be on one page", social.Attributes.Name)
+			}
+			seen[social.Attributes.Name] = true
+			services = append(services, social.Attributes.Service)
+		}
+		next = page.Links["next"]
+	}
+
+	if len(seen) != 5 {
+		t.Errorf("expected every link across the pages, got %v", seen)
+	}
+	want := "youtube,youtube,twitter,twitter,twitter"
+	if got := strings.Join(services, ","); got != want {
+		t.Errorf("expected the pages in the order %s, got %s", want, got)
+	}
+}
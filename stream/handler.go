@@ -0,0 +1,148 @@
+package stream
+
+import (
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CactusDev/Xerophi/types"
+	"github.com/CactusDev/Xerophi/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Stream sends a channel's changes to its commands, quotes and config as they
+// happen, over a WebSocket or as server-sent events
+type Stream struct {
+	Journal *Journal
+}
+
+// Routes returns the routing information for this endpoint
+func (s *Stream) Routes() []types.RouteDetails {
+	return []types.RouteDetails{
+		types.RouteDetails{
+			Enabled: true, Path: "", Verb: "GET",
+			Handler: s.Watch,
+		},
+		types.RouteDetails{
+			Enabled: true, Path: "/events", Verb: "GET",
+			Handler: s.Events,
+		},
+	}
+}
+
+// sender is how events get to the client
+type sender interface {
+	send(event Event) bool // Sends the event, false once the client can't be sent to
+	heartbeat() bool       // Lets the client and anything in between know it's still open
+	behind()               // Tells the client it fell behind and has to reconnect
+	failed(detail string)  // Tells the client something went wrong on our end
+}
+
+// token returns the normalized token from the route
+func token(ctx *gin.Context) string {
+	return strings.ToLower(html.EscapeString(ctx.Param("token")))
+}
+
+// parseCursor parses a cursor to resume from, returning false if there isn't
+// one
+func parseCursor(param string, raw string) (int64, bool, error) {
+	if raw == "" {
+		return 0, false, nil
+	}
+	parsed, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || parsed < 0 {
+		return 0, false, util.InvalidParameter(param, "Invalid cursor %s", raw)
+	}
+	return parsed, true, nil
+}
+
+// resources parses which resources the client wants events for, nil means
+// all of them
+func (s *Stream) resources(ctx *gin.Context) (map[string]struct{}, error) {
+	raw := ctx.Query("resources")
+	if raw == "" {
+		return nil, nil
+	}
+	var only = make(map[string]struct{})
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		var known bool
+		for _, topic := range s.Journal.Topics {
+			known = known || topic.Name == name
+		}
+		if !known {
+			return nil, util.InvalidParameter("resources", "Unknown resource %s", name)
+		}
+		only[name] = struct{}{}
+	}
+	return only, nil
+}
+
+// follow sends the channel's events to the client until it leaves. When
+// resuming, everything after the cursor is sent first, then a ready event,
+// then the changes as they happen. The events have to have been subscribed
+// to before catching up so nothing's missed in between, anything caught up on
+// that turns up again is skipped by its cursor
+func (s *Stream) follow(channel string, events <-chan Event, after int64, resume bool,
+	only map[string]struct{}, out sender, closed <-chan struct{}, heartbeat time.Duration) {
+	wanted := func(event Event) bool {
+		_, ok := only[event.Resource]
+		return only == nil || ok
+	}
+
+	// Only events sent while catching up can turn up twice, anything else
+	// that's come in since subscribing hasn't been sent yet
+	var sent int64
+	last := s.Journal.Current()
+	switch {
+	case resume && s.Journal.Expired(after):
+		if !out.send(Event{Type: Reset, Cursor: strconv.FormatInt(last, 10)}) {
+			return
+		}
+	case resume:
+		missed, err := s.Journal.Since(channel, after)
+		if err != nil {
+			out.failed("Couldn't retrieve missed events")
+			return
+		}
+		last = after
+		for _, event := range missed {
+			last, _ = strconv.ParseInt(event.Cursor, 10, 64)
+			if wanted(event) && !out.send(event) {
+				return
+			}
+		}
+		sent = last
+	}
+	if !out.send(Event{Type: Ready, Cursor: strconv.FormatInt(last, 10)}) {
+		return
+	}
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				// Fell too far behind, the client can catch up by reconnecting
+				out.behind()
+				return
+			}
+			position, _ := strconv.ParseInt(event.Cursor, 10, 64)
+			if position <= sent {
+				continue
+			}
+			if wanted(event) && !out.send(event) {
+				return
+			}
+		case <-ticker.C:
+			if !out.heartbeat() {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package stream
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/CactusDev/Xerophi/rethink"
+)
+
+// collector keeps whatever follow sends it
+type collector struct {
+	events chan Event
+}
+
+func (c collector) send(event Event) bool {
+	c.events <- event
+	return true
+}
+
+func (c collector) heartbeat() bool { return true }
+
+func (c collector) behind() { c.events <- Event{Type: "behind"} }
+
+func (c collector) failed(detail string) { c.events <- Event{Type: "failed"} }
+
+// following starts sending the channel's events to a collector from the
+// subscription given, and returns what it's sent so far as it's called
+func following(t *testing.T, f *fixture, events <-chan Event, after int64, resume bool,
+	only map[string]struct{}) func(count int) []Event {
+	out := collector{events: make(chan Event, 64)}
+	closed := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		(&Stream{Journal: f.journal}).follow("channel", events, after, resume, only, out, closed, time.Hour)
+	}()
+	t.Cleanup(func() {
+		close(closed)
+		<-done
+	})
+
+	return func(count int) []Event {
+		t.Helper()
+		var got []Event
+		for len(got) < count {
+			select {
+			case event := <-out.events:
+				got = append(got, event)
+			case <-time.After(time.Second):
+				t.Fatalf("expected %d events, got %v", count, described(got))
+			}
+		}
+		select {
+		case event := <-out.events:
+			t.Fatalf("expected only %d events, also got %+v", count, event)
+		case <-time.After(10 * time.Millisecond):
+		}
+		return got
+	}
+}
+
+// command writes a command for the channel, returning the cursor it's given
+func command(f *fixture, id string) int64 {
+	f.write(func(db rethink.Database) {
+		db.Create("commands", map[string]interface{}{"id": id, "token": "channel", "deletedAt": 0})
+	})
+	kept, _ := f.journal.Since("channel", 0)
+	cursor, _ := strconv.ParseInt(kept[len(kept)-1].Cursor, 10, 64)
+	return cursor
+}
+
+func TestFollowCatchesUp(t *testing.T) {
+	f := setup(t)
+	after := command(f, "a")
+
+	events, cancel := f.journal.Subscribe("channel")
+	defer cancel()
+	// Written after subscribing but before catching up, so they turn up both
+	// in the journal and live
+	command(f, "b")
+	last := command(f, "c")
+
+	next := following(t, f, events, after, true, nil)
+	got := next(3)
+	sameTypes(t, got, "create command b", "create command c", "ready  ")
+	if got[2].Cursor != strconv.FormatInt(last, 10) {
+		t.Errorf("expected to be ready from %d, got %s", last, got[2].Cursor)
+	}
+
+	command(f, "d")
+	sameTypes(t, next(1), "create command d")
+}
+
+func TestFollowFromNow(t *testing.T) {
+	f := setup(t)
+	command(f, "a")
+
+	events, cancel := f.journal.Subscribe("channel")
+	defer cancel()
+	// Written after subscribing but before the stream starts, it hasn't been
+	// sent so it can't be skipped
+	command(f, "b")
+
+	next := following(t, f, events, 0, false, nil)
+	sameTypes(t, next(2), "ready  ", "create command b")
+
+	command(f, "c")
+	sameTypes(t, next(1), "create command c")
+}
+
+func TestFollowResetsExpired(t *testing.T) {
+	f := setup(t)
+	command(f, "a")
+	old := f.journal.Current() - int64(2*time.Hour/time.Microsecond)
+
+	events, cancel := f.journal.Subscribe("channel")
+	defer cancel()
+
+	next := following(t, f, events, old, true, nil)
+	got := next(2)
+	sameTypes(t, got, "reset  ", "ready  ")
+	if got[0].Cursor != got[1].Cursor {
+		t.Errorf("expected to be ready from where it reset, got %s and %s", got[0].Cursor, got[1].Cursor)
+	}
+}
+
+func TestFollowOnly(t *testing.T) {
+	f := setup(t)
+	after := f.journal.Current() - 1
+	f.write(func(db rethink.Database) {
+		db.Create("commands", map[string]interface{}{"id": "a", "token": "channel", "deletedAt": 0})
+		db.Create("quotes", map[string]interface{}{"id": "q", "token": "channel", "deletedAt": 0})
+	})
+
+	events, cancel := f.journal.Subscribe("channel")
+	defer cancel()
+
+	next := following(t, f, events, after, true, map[string]struct{}{"quote": {}})
+	sameTypes(t, next(2), "create quote q", "ready  ")
+
+	f.write(func(db rethink.Database) {
+		db.Update("commands", "a", map[string]interface{}{"name": "hi"})
+		db.Update("quotes", "q", map[string]interface{}{"quote": "hi"})
+	})
+	sameTypes(t, next(1), "update quote q")
+}
+
+func TestFollowBehind(t *testing.T) {
+	f := setup(t)
+	events, cancel := f.journal.Subscribe("channel")
+	defer cancel()
+
+	next := following(t, f, events, 0, false, nil)
+	sameTypes(t, next(1), "ready  ")
+
+	// Dropping the subscriber is what happens when it falls behind
+	cancel()
+	sameTypes(t, next(1), "behind  ")
+}
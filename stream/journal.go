@@ -0,0 +1,327 @@
+package stream
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/CactusDev/Xerophi/rethink"
+
+	mapstruct "github.com/mitchellh/mapstructure"
+	log "github.com/sirupsen/logrus"
+)
+
+// The types of event sent down the stream
+const (
+	Created = "create" // A record was created, or restored after being deleted
+	Updated = "update" // A record was changed
+	Deleted = "delete" // A record was deleted, the data is how it was before
+	Ready   = "ready"  // Everything missed has been sent, what follows is live
+	Reset   = "reset"  // The cursor is too old to catch up from, refetch everything
+)
+
+// pageSize is how many missed events are retrieved at a time
+const pageSize = 500
+
+// retryDelay is how long to wait before reopening a feed that's dropped
+const retryDelay = 5 * time.Second
+
+// Topic is a resource whose changes are sent down the stream
+type Topic struct {
+	Name  string // What the records are called in events, e.g. "command"
+	Table string // The table the records are stored in
+	// Render turns a stored record into what's sent, nil sends it as stored
+	Render func(record map[string]interface{}) (interface{}, error)
+}
+
+// Event is a single change sent down the stream
+type Event struct {
+	Cursor   string      `json:"cursor,omitempty"`
+	Type     string      `json:"type"`
+	Resource string      `json:"resource,omitempty"`
+	ID       string      `json:"id,omitempty"`
+	Data     interface{} `json:"data,omitempty"`
+}
+
+// entry is an event as it's kept in the journal
+type entry struct {
+	Cursor   int64       `mapstructure:"cursor"`
+	Type     string      `mapstructure:"type"`
+	Resource string      `mapstructure:"resource"`
+	RecordID string      `mapstructure:"recordId"`
+	Data     interface{} `mapstructure:"data"`
+}
+
+// Journal watches the topics' tables for changes and keeps every one of them
+// for a while, each with a cursor, so a client that reconnects can pick up
+// from the last event it got. Cursors are only ordered within a single
+// instance of the API, so only one of them should keep the journal
+type Journal struct {
+	DB        rethink.Database // The storage backend, which provides the feed
+	Table     string           // The table events are kept in
+	Topics    []Topic          // What's sent down the stream
+	Retention time.Duration    // How long events are kept for catching up
+	Interval  time.Duration    // How often expired events are removed
+
+	mutex       sync.Mutex
+	last        int64                 // The latest cursor given out
+	subscribers map[chan Event]string // The channel each subscriber is watching
+}
+
+// topic finds the topic stored in the table
+func (j *Journal) topic(table string) (Topic, bool) {
+	for _, topic := range j.Topics {
+		if topic.Table == table {
+			return topic, true
+		}
+	}
+	return Topic{}, false
+}
+
+// live returns if the record exists and isn't soft-deleted
+func live(record map[string]interface{}) bool {
+	if record == nil {
+		return false
+	}
+	deletedAt, _ := record["deletedAt"].(float64)
+	return deletedAt == 0
+}
+
+// kind works out what sort of event the change is from the client's point of
+// view, soft-deleting is a delete and restoring is a create. Returns "" for
+// changes the client can't see, like purging a deleted record
+func kind(change rethink.Change) string {
+	was, is := live(change.Old), live(change.New)
+	switch {
+	case !was && is:
+		return Created
+	case was && is:
+		return Updated
+	case was && !is:
+		return Deleted
+	}
+	return ""
+}
+
+// next gives out the next cursor, which is the time in microseconds but
+// always after the one before it
+func (j *Journal) next() int64 {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	cursor := time.Now().UTC().UnixNano() / int64(time.Microsecond)
+	if cursor <= j.last {
+		cursor = j.last + 1
+	}
+	j.last = cursor
+	return cursor
+}
+
+// Current returns the latest cursor given out, which a client without one
+// can start from
+func (j *Journal) Current() int64 {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if j.last == 0 {
+		return time.Now().UTC().UnixNano() / int64(time.Microsecond)
+	}
+	return j.last
+}
+
+// Expired returns if events after the cursor might have been pruned already
+func (j *Journal) Expired(cursor int64) bool {
+	cutoff := time.Now().UTC().Add(-j.Retention)
+	return cursor < cutoff.UnixNano()/int64(time.Microsecond)
+}
+
+// plain puts the data through JSON so it's stored the same way it's sent
+func plain(data interface{}) (interface{}, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var decoded interface{}
+	err = json.Unmarshal(encoded, &decoded)
+	return decoded, err
+}
+
+// record turns the change into an event, keeps it in the journal and sends
+// it to anyone watching the channel
+func (j *Journal) record(change rethink.Change) {
+	topic, ok := j.topic(change.Table)
+	if !ok {
+		return
+	}
+	eventType := kind(change)
+	if eventType == "" {
+		return
+	}
+	record := change.New
+	if eventType == Deleted {
+		record = change.Old
+	}
+	token, _ := record["token"].(string)
+	id, _ := record["id"].(string)
+
+	var data interface{} = record
+	var err error
+	if topic.Render != nil {
+		data, err = topic.Render(record)
+	}
+	if err == nil {
+		data, err = plain(data)
+	}
+	if err != nil {
+		log.Errorf("[%s] - Failed to render %s %s: %s", j.Table, topic.Name, id, err)
+		data = nil
+	}
+
+	cursor := j.next()
+	if _, err := j.DB.Create(j.Table, map[string]interface{}{
+		"cursor":    cursor,
+		"token":     token,
+		"type":      eventType,
+		"resource":  topic.Name,
+		"recordId":  id,
+		"data":      data,
+		"createdAt": time.Now().UTC().Format(time.RFC3339),
+	}); err != nil {
+		log.Errorf("[%s] - Failed to keep %s event for %s: %s", j.Table, eventType, id, err)
+	}
+
+	j.publish(token, Event{
+		Cursor:   strconv.FormatInt(cursor, 10),
+		Type:     eventType,
+		Resource: topic.Name,
+		ID:       id,
+		Data:     data,
+	})
+}
+
+// publish sends the event to everyone watching the channel. Anyone that's
+// fallen too far behind is dropped, they can catch up from the journal once
+// they reconnect
+func (j *Journal) publish(token string, event Event) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	for events, watching := range j.subscribers {
+		if watching != token {
+			continue
+		}
+		select {
+		case events <- event:
+		default:
+			delete(j.subscribers, events)
+			close(events)
+		}
+	}
+}
+
+// Subscribe returns every event for the channel from now on, until the
+// returned function is called. The events stop early if the subscriber falls
+// too far behind
+func (j *Journal) Subscribe(token string) (<-chan Event, func()) {
+	events := make(chan Event, 64)
+
+	j.mutex.Lock()
+	if j.subscribers == nil {
+		j.subscribers = make(map[chan Event]string)
+	}
+	j.subscribers[events] = token
+	j.mutex.Unlock()
+
+	return events, func() {
+		j.mutex.Lock()
+		defer j.mutex.Unlock()
+		if _, ok := j.subscribers[events]; ok {
+			delete(j.subscribers, events)
+			close(events)
+		}
+	}
+}
+
+// Since retrieves every event for the channel after the cursor, oldest first
+func (j *Journal) Since(token string, cursor int64) ([]Event, error) {
+	var events []Event
+	for {
+		fromDB, err := j.DB.GetByQuery(j.Table, rethink.Query{
+			Filter: map[string]interface{}{"token": token},
+			Ranges: []rethink.Range{{Field: "cursor", Min: cursor + 1}},
+			Sort:   []rethink.Sort{{Field: "cursor"}},
+			Limit:  pageSize,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, record := range fromDB {
+			var kept entry
+			if err := mapstruct.Decode(record, &kept); err != nil {
+				return nil, err
+			}
+			events = append(events, Event{
+				Cursor:   strconv.FormatInt(kept.Cursor, 10),
+				Type:     kept.Type,
+				Resource: kept.Resource,
+				ID:       kept.RecordID,
+				Data:     kept.Data,
+			})
+			cursor = kept.Cursor
+		}
+		if len(fromDB) < pageSize {
+			return events, nil
+		}
+	}
+}
+
+// watch keeps the journal up to date with the feed, reopening it if it drops.
+// Anything changed while it's being reopened is missed
+func (j *Journal) watch() {
+	var tables = make([]string, 0, len(j.Topics))
+	for _, topic := range j.Topics {
+		tables = append(tables, topic.Table)
+	}
+
+	for {
+		changes, err := j.DB.Changes(tables, nil)
+		if err != nil {
+			log.Errorf("[%s] - Failed to open the change feed: %s", j.Table, err)
+		} else {
+			for change := range changes {
+				j.record(change)
+			}
+			log.Warnf("[%s] - Change feed dropped, reopening it", j.Table)
+		}
+
+		time.Sleep(retryDelay)
+	}
+}
+
+// Prune removes every event older than the retention period and returns how
+// many were removed
+func (j *Journal) Prune() (int, error) {
+	cutoff := time.Now().UTC().Add(-j.Retention)
+	return j.DB.DeleteByQuery(j.Table, rethink.Query{
+		Ranges: []rethink.Range{
+			{Field: "cursor", Max: cutoff.UnixNano() / int64(time.Microsecond)},
+		},
+	})
+}
+
+// Start watches for changes and prunes old events in the background
+func (j *Journal) Start() {
+	go j.watch()
+	go func() {
+		for {
+			removed, err := j.Prune()
+			if err != nil {
+				log.Error(err.Error())
+			} else if removed > 0 {
+				log.Infof("[%s] - Pruned %d events older than %s",
+					j.Table, removed, j.Retention)
+			}
+
+			time.Sleep(j.Interval)
+		}
+	}()
+}
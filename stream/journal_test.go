@@ -0,0 +1,214 @@
+package stream
+
+import (
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/CactusDev/Xerophi/rethink"
+	"github.com/CactusDev/Xerophi/rethink/rethinktest"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// fixture is a journal of the commands and quotes tables, kept up to date
+// with what's written through db
+type fixture struct {
+	journal *Journal
+	db      *rethink.Publishing
+	changes <-chan rethink.Change
+}
+
+// setup returns a journal backed by an in-memory database that publishes
+// its writes
+func setup(t *testing.T) *fixture {
+	db := &rethink.Publishing{Database: rethinktest.NewMemory()}
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	changes, err := db.Changes([]string{"commands", "quotes"}, stop)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &fixture{
+		journal: &Journal{
+			DB:    db,
+			Table: "streamEvents",
+			Topics: []Topic{
+				{Name: "command", Table: "commands"},
+				{Name: "quote", Table: "quotes", Render: func(record map[string]interface{}) (interface{}, error) {
+					return map[string]interface{}{"quote": record["quote"]}, nil
+				}},
+			},
+			Retention: time.Hour,
+		},
+		db:      db,
+		changes: changes,
+	}
+}
+
+// sync records every change that's been published, publishing doesn't wait
+// so they're all there already
+func (f *fixture) sync() {
+	for {
+		select {
+		case change := <-f.changes:
+			f.journal.record(change)
+		default:
+			return
+		}
+	}
+}
+
+// write runs the write and records the changes it made
+func (f *fixture) write(write func(db rethink.Database)) {
+	write(f.db)
+	f.sync()
+}
+
+// received returns the events that have been sent to the subscriber so far
+func received(events <-chan Event) []Event {
+	var got []Event
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return got
+			}
+			got = append(got, event)
+		default:
+			return got
+		}
+	}
+}
+
+// described lists the type of each event along with its resource and ID
+func described(events []Event) []string {
+	var listed = make([]string, len(events))
+	for pos, event := range events {
+		listed[pos] = event.Type + " " + event.Resource + " " + event.ID
+	}
+	return listed
+}
+
+func sameTypes(t *testing.T, events []Event, want ...string) {
+	t.Helper()
+	got := described(events)
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for pos := range want {
+		if got[pos] != want[pos] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
+
+func TestRecordTypes(t *testing.T) {
+	f := setup(t)
+	events, cancel := f.journal.Subscribe("channel")
+	defer cancel()
+
+	f.write(func(db rethink.Database) {
+		db.Create("commands", map[string]interface{}{
+			"id": "a", "token": "channel", "name": "hi", "deletedAt": 0})
+		db.Update("commands", "a", map[string]interface{}{"name": "hello"})
+		db.Disable("commands", "a")
+		// Restoring it is a create as far as the client's concerned
+		db.Update("commands", "a", map[string]interface{}{"deletedAt": 0})
+		db.Disable("commands", "a")
+		// It's already gone from the client's point of view
+		db.Delete("commands", "a")
+	})
+
+	sent := received(events)
+	sameTypes(t, sent,
+		"create command a", "update command a", "delete command a",
+		"create command a", "delete command a")
+	if data := sent[2].Data.(map[string]interface{}); data["name"] != "hello" {
+		t.Errorf("expected the delete to have the record as it was, got %v", data)
+	}
+
+	kept, err := f.journal.Since("channel", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameTypes(t, kept, described(sent)...)
+	for pos := range kept {
+		if kept[pos].Cursor != sent[pos].Cursor {
+			t.Errorf("expected the kept event to have the cursor sent, %s != %s",
+				kept[pos].Cursor, sent[pos].Cursor)
+		}
+	}
+}
+
+func TestRecordRendersAndScopes(t *testing.T) {
+	f := setup(t)
+	events, cancel := f.journal.Subscribe("channel")
+	defer cancel()
+	others, cancelOthers := f.journal.Subscribe("other")
+	defer cancelOthers()
+
+	f.write(func(db rethink.Database) {
+		db.Create("quotes", map[string]interface{}{
+			"id": "q", "token": "channel", "quote": "hi", "secret": "no", "deletedAt": 0})
+		db.Create("commands", map[string]interface{}{
+			"id": "b", "token": "other", "deletedAt": 0})
+	})
+
+	sent := received(events)
+	sameTypes(t, sent, "create quote q")
+	if data := sent[0].Data.(map[string]interface{}); data["quote"] != "hi" || data["secret"] != nil {
+		t.Errorf("expected the quote to be rendered, got %v", data)
+	}
+	sameTypes(t, received(others), "create command b")
+}
+
+func TestSincePages(t *testing.T) {
+	f := setup(t)
+
+	// More than a page of them, along with some for another channel
+	total := pageSize*2 + 10
+	for cursor := 1; cursor <= total; cursor++ {
+		for _, token := range []string{"channel", "other"} {
+			f.db.Create(f.journal.Table, map[string]interface{}{
+				"cursor": cursor, "token": token, "type": Created,
+				"resource": "command", "recordId": strconv.Itoa(cursor),
+			})
+		}
+	}
+
+	for _, after := range []int{0, 5, pageSize, total} {
+		missed, err := f.journal.Since("channel", int64(after))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(missed) != total-after {
+			t.Fatalf("after %d: expected %d events, got %d", after, total-after, len(missed))
+		}
+		for pos, event := range missed {
+			if want := strconv.Itoa(after + pos + 1); event.Cursor != want || event.ID != want {
+				t.Fatalf("after %d: expected event %s in order, got %+v", after, want, event)
+			}
+		}
+	}
+}
+
+func TestExpired(t *testing.T) {
+	f := setup(t)
+	now := f.journal.Current()
+
+	if f.journal.Expired(now) {
+		t.Error("expected the current cursor to be kept")
+	}
+	old := now - int64(2*time.Hour/time.Microsecond)
+	if !f.journal.Expired(old) {
+		t.Error("expected a cursor from before the retention period to have expired")
+	}
+}
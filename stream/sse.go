@@ -0,0 +1,95 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/CactusDev/Xerophi/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// heartbeatPeriod is how often a comment is sent so proxies don't close the
+// connection for being idle
+const heartbeatPeriod = 15 * time.Second
+
+// retryAfter is how long browsers wait before reconnecting, in milliseconds
+const retryAfter = 3000
+
+// eventSource sends events as server-sent events, each with its cursor as
+// the ID so browsers send it back as Last-Event-ID when they reconnect
+type eventSource struct {
+	writer gin.ResponseWriter
+}
+
+// write sends the text and flushes it so it isn't held in a buffer
+func (e eventSource) write(text string) bool {
+	if _, err := e.writer.WriteString(text); err != nil {
+		return false
+	}
+	e.writer.Flush()
+	return true
+}
+
+func (e eventSource) send(event Event) bool {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return false
+	}
+	var id string
+	if event.Cursor != "" {
+		id = "id: " + event.Cursor + "\n"
+	}
+	return e.write(fmt.Sprintf("%sevent: %s\ndata: %s\n\n", id, event.Type, data))
+}
+
+func (e eventSource) heartbeat() bool {
+	return e.write(": heartbeat\n\n")
+}
+
+func (e eventSource) behind() {
+	// Ending the response is enough, the browser reconnects with the last ID
+}
+
+func (e eventSource) failed(detail string) {
+	data, _ := json.Marshal(util.NewError(util.ErrInternal, detail))
+	e.write(fmt.Sprintf("event: error\ndata: %s\n\n", data))
+}
+
+// Events sends every change for the channel as server-sent events, or just
+// those for the resources given. Browsers resume with Last-Event-ID when they
+// reconnect, anything else can pass the last cursor it got as cursor
+func (s *Stream) Events(ctx *gin.Context) {
+	channel := token(ctx)
+	after, resume, err := parseCursor("Last-Event-ID", ctx.GetHeader("Last-Event-ID"))
+	if err == nil && !resume {
+		after, resume, err = parseCursor("cursor", ctx.Query("cursor"))
+	}
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusBadRequest)
+		return
+	}
+	only, err := s.resources(ctx)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusBadRequest)
+		return
+	}
+
+	events, cancel := s.Journal.Subscribe(channel)
+	defer cancel()
+
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	// Stop nginx from buffering the stream
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+
+	out := eventSource{writer: ctx.Writer}
+	if !out.write(fmt.Sprintf("retry: %d\n\n", retryAfter)) {
+		return
+	}
+	s.follow(channel, events, after, resume, only, out, ctx.Request.Context().Done(), heartbeatPeriod)
+}
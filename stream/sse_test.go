@@ -0,0 +1,178 @@
+package stream
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CactusDev/Xerophi/rethink"
+	"github.com/CactusDev/Xerophi/util"
+)
+
+// frame is a single message from an event stream, by field
+type frame map[string]string
+
+// listen opens the event stream with the query and Last-Event-ID given, and
+// returns a function for reading the next frames from it
+func listen(t *testing.T, f *fixture, query string, lastID string) (*http.Response, func(count int) []frame) {
+	server := serve(t, f)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	req, err := http.NewRequest("GET", server.URL+util.BasePath+"/user/channel/stream/events?"+query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	frames := make(chan frame)
+	go func() {
+		defer close(frames)
+		lines := bufio.NewScanner(resp.Body)
+		var current = frame{}
+		for lines.Scan() {
+			line := lines.Text()
+			if line == "" {
+				frames <- current
+				current = frame{}
+				continue
+			}
+			split := strings.SplitN(line, ":", 2)
+			current[split[0]] = strings.TrimPrefix(split[1], " ")
+		}
+	}()
+
+	return resp, func(count int) []frame {
+		t.Helper()
+		var got []frame
+		for len(got) < count {
+			select {
+			case next, ok := <-frames:
+				if !ok {
+					t.Fatalf("expected %d frames, the stream ended after %v", count, got)
+				}
+				got = append(got, next)
+			case <-time.After(time.Second):
+				t.Fatalf("expected %d frames, got %v", count, got)
+			}
+		}
+		return got
+	}
+}
+
+// sameEvent checks the frame is the event given, and that its ID is the
+// event's cursor
+func sameEvent(t *testing.T, got frame, eventType string, id string) {
+	t.Helper()
+	var event Event
+	if err := json.Unmarshal([]byte(got["data"]), &event); err != nil {
+		t.Fatalf("expected the data to be the event, got %v", got)
+	}
+	if got["event"] != eventType || event.Type != eventType || event.ID != id {
+		t.Errorf("expected a %s event for %q, got %v", eventType, id, got)
+	}
+	if got["id"] != event.Cursor {
+		t.Errorf("expected the ID to be the cursor %s, got %v", event.Cursor, got)
+	}
+}
+
+func TestEventsFraming(t *testing.T) {
+	f := setup(t)
+	resp, next := listen(t, f, "", "")
+
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	got := next(2)
+	if got[0]["retry"] != strconv.Itoa(retryAfter) || len(got[0]) != 1 {
+		t.Errorf("expected to be told how long to wait before retrying, got %v", got[0])
+	}
+	sameEvent(t, got[1], Ready, "")
+
+	command(f, "a")
+	sameEvent(t, next(1)[0], Created, "a")
+}
+
+func TestEventsResume(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		lastID bool // Whether the cursor's sent as Last-Event-ID
+	}{
+		{name: "Last-Event-ID", lastID: true},
+		{name: "cursor", query: "cursor="},
+		// Browsers send Last-Event-ID when they reconnect to the same URL, so
+		// it takes over from the cursor it was opened with
+		{name: "both", query: "cursor=0&", lastID: true},
+	}
+
+	for _, test := range tests {
+		f := setup(t)
+		after := strconv.FormatInt(command(f, "a"), 10)
+		command(f, "b")
+
+		query, lastID := test.query, ""
+		if test.lastID {
+			lastID = after
+		} else {
+			query += after
+		}
+		_, next := listen(t, f, query, lastID)
+		got := next(3)
+		sameEvent(t, got[1], Created, "b")
+		sameEvent(t, got[2], Ready, "")
+		if got[2]["id"] != got[1]["id"] {
+			t.Errorf("%s: expected to be ready from %s, got %v", test.name, got[1]["id"], got[2])
+		}
+	}
+}
+
+func TestEventsResources(t *testing.T) {
+	f := setup(t)
+	after := strconv.FormatInt(f.journal.Current()-1, 10)
+	f.write(func(db rethink.Database) {
+		db.Create("commands", map[string]interface{}{"id": "a", "token": "channel", "deletedAt": 0})
+		db.Create("quotes", map[string]interface{}{"id": "q", "token": "channel", "deletedAt": 0})
+	})
+
+	_, next := listen(t, f, "resources=quote", after)
+	got := next(3)
+	sameEvent(t, got[1], Created, "q")
+	sameEvent(t, got[2], Ready, "")
+
+	f.write(func(db rethink.Database) {
+		db.Update("commands", "a", map[string]interface{}{"name": "hi"})
+		db.Update("quotes", "q", map[string]interface{}{"quote": "hi"})
+	})
+	sameEvent(t, next(1)[0], Updated, "q")
+}
+
+func TestEventsRejects(t *testing.T) {
+	tests := []struct {
+		query  string
+		lastID string
+	}{
+		{lastID: "soon"},
+		{query: "cursor=-1"},
+		{query: "resources=command,nope"},
+	}
+
+	for _, test := range tests {
+		resp, _ := listen(t, setup(t), test.query, test.lastID)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s %s: expected it to be rejected, got %d", test.query, test.lastID, resp.StatusCode)
+		}
+	}
+}
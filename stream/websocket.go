@@ -0,0 +1,100 @@
+package stream
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/CactusDev/Xerophi/util"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// How long the connection's given for writes, and for the client to answer
+// a ping before it's assumed to be gone
+const (
+	writeWait  = 10 * time.Second
+	pongWait   = time.Minute
+	pingPeriod = pongWait * 9 / 10
+)
+
+var upgrader = websocket.Upgrader{
+	// Bots connect from anywhere, the token is what picks out the channel
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// socket sends events as JSON messages over a WebSocket
+type socket struct {
+	conn *websocket.Conn
+}
+
+func (s socket) send(event Event) bool {
+	s.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return s.conn.WriteJSON(event) == nil
+}
+
+func (s socket) heartbeat() bool {
+	return s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)) == nil
+}
+
+func (s socket) close(code int, detail string) {
+	s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, detail),
+		time.Now().Add(writeWait))
+}
+
+func (s socket) behind() {
+	s.close(websocket.CloseTryAgainLater, "Resume from the last cursor")
+}
+
+func (s socket) failed(detail string) {
+	s.close(websocket.CloseInternalServerErr, detail)
+}
+
+// Watch upgrades to a WebSocket and sends every change for the channel, or
+// just those for the resources given. Every event has a cursor a reconnecting
+// client can resume from by passing it as cursor
+func (s *Stream) Watch(ctx *gin.Context) {
+	channel := token(ctx)
+	after, resume, err := parseCursor("cursor", ctx.Query("cursor"))
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusBadRequest)
+		return
+	}
+	only, err := s.resources(ctx)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusBadRequest)
+		return
+	}
+	if !websocket.IsWebSocketUpgrade(ctx.Request) {
+		util.Abort(ctx, util.ErrBadRequest, "The stream is only available over a WebSocket")
+		return
+	}
+
+	events, cancel := s.Journal.Subscribe(channel)
+	defer cancel()
+
+	conn, err := upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		// The upgrader has already responded with the error
+		return
+	}
+	defer conn.Close()
+
+	// Nothing's expected from the client, reading is just how pongs and
+	// the client leaving are noticed
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(pongWait))
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	s.follow(channel, events, after, resume, only, socket{conn: conn}, closed, pingPeriod)
+}
@@ -0,0 +1,92 @@
+package stream
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CactusDev/Xerophi/util"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// serve runs the stream for the fixture's journal on a test server
+func serve(t *testing.T, f *fixture) *httptest.Server {
+	router := gin.New()
+	group := router.Group(util.BasePath + "/user/:token/stream")
+	for _, route := range (&Stream{Journal: f.journal}).Routes() {
+		group.Handle(route.Verb, route.Path, route.Handler)
+	}
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// dial opens the WebSocket with the query given
+func dial(t *testing.T, server *httptest.Server, query string) *websocket.Conn {
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + util.BasePath + "/user/channel/stream?" + query
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// read returns the next events sent over the socket
+func read(t *testing.T, conn *websocket.Conn, count int) []Event {
+	t.Helper()
+	var got []Event
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for len(got) < count {
+		var event Event
+		if err := conn.ReadJSON(&event); err != nil {
+			t.Fatalf("expected %d events, got %v: %s", count, described(got), err)
+		}
+		got = append(got, event)
+	}
+	return got
+}
+
+func TestWatch(t *testing.T) {
+	f := setup(t)
+	after := command(f, "a")
+	command(f, "b")
+	server := serve(t, f)
+
+	conn := dial(t, server, "cursor="+strconv.FormatInt(after, 10))
+	got := read(t, conn, 2)
+	sameTypes(t, got, "create command b", "ready  ")
+
+	// The subscription is made before the upgrade, so anything written now
+	// is sent live
+	command(f, "c")
+	sameTypes(t, read(t, conn, 1), "create command c")
+}
+
+func TestWatchRejects(t *testing.T) {
+	f := setup(t)
+	server := serve(t, f)
+
+	for _, query := range []string{"cursor=soon", "resources=nope"} {
+		url := "ws" + strings.TrimPrefix(server.URL, "http") + util.BasePath + "/user/channel/stream?" + query
+		_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+		if err == nil || resp == nil || resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected it to be rejected, got %v", query, resp)
+		}
+	}
+
+	// It's only available as a WebSocket
+	resp, err := http.Get(server.URL + util.BasePath + "/user/channel/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected a plain request to be rejected, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,160 @@
+package trust
+
+import (
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CactusDev/Xerophi/archive"
+	"github.com/CactusDev/Xerophi/resource"
+	"github.com/CactusDev/Xerophi/rethink"
+	"github.com/CactusDev/Xerophi/types"
+	"github.com/CactusDev/Xerophi/util"
+
+	"github.com/gin-gonic/gin"
+
+	mapstruct "github.com/mitchellh/mapstructure"
+	log "github.com/sirupsen/logrus"
+)
+
+// Trust is the struct that implements the handler interface for the trust resource
+type Trust struct {
+	Conn  rethink.Database // The storage backend
+	Table string           // The database table we're using
+}
+
+// Resource returns the generic handler for trusted viewers, which are keyed
+// by the viewer's name. Revoking trust soft-deletes the grant, so the
+// revocation time is kept as its deletedAt
+func (t *Trust) Resource() *resource.Resource {
+	return &resource.Resource{
+		Conn:   t.Conn,
+		Table:  t.Table,
+		Name:   "Trusted viewer",
+		Plural: "trusted viewers",
+		Key: resource.Key{
+			Param: "viewer", Field: "viewer", Parse: parseViewer,
+		},
+		Schema:       ResponseSchema{},
+		CreateSchema: "/trust/createSchema.json",
+		CreatePath:   "/:viewer",
+		Hooks: resource.Hooks{
+			Defaults: t.defaults,
+		},
+	}
+}
+
+// Routes returns the routing information for this endpoint. Trust is either
+// granted or it isn't, so there's no update schema and nothing to edit
+func (t *Trust) Routes() []types.RouteDetails {
+	return append(t.Resource().Routes(), types.RouteDetails{
+		Enabled: true, Path: "", Verb: "POST", ReadOnly: true,
+		Handler: t.Check,
+	})
+}
+
+// Archive describes how trusted viewers are exported and imported
+func (t *Trust) Archive() archive.Kind {
+	return archive.Kind{
+		Name:   "trusted",
+		Table:  t.Table,
+		Key:    []string{"viewer"},
+		Parse:  map[string]func(string) (interface{}, error){"viewer": parseViewer},
+		Schema: "/trust/createSchema.json",
+		Client: ClientSchema{},
+	}
+}
+
+// parseViewer normalizes a viewer's name the way the routes do
+func parseViewer(raw string) (interface{}, error) {
+	return strings.ToLower(html.EscapeString(raw)), nil
+}
+
+// defaults are the values a new grant starts with, it's for the viewer in
+// the route
+func (t *Trust) defaults(ctx *gin.Context, token string) (interface{}, interface{}, error) {
+	viewer, _ := parseViewer(ctx.Param("viewer"))
+	createVals := CreationSchema{
+		CreatedAt: time.Now().UTC(),
+		DeletedAt: 0,
+		Token:     token,
+		Viewer:    viewer.(string),
+	}
+	return createVals, createVals.Viewer, nil
+}
+
+// Lookup returns the trust state of every viewer given in a single query.
+// Every viewer asked about will be in the result lowercased, untrusted ones
+// map to false. They're looked up the way Create stores them
+func (t *Trust) Lookup(token string, viewers []string) (map[string]bool, error) {
+	var states = make(map[string]bool, len(viewers))
+	var values = make([]interface{}, len(viewers))
+	// What each stored name was asked about as
+	var asked = make(map[string][]string, len(viewers))
+	for pos, viewer := range viewers {
+		viewer = strings.ToLower(viewer)
+		stored := html.EscapeString(viewer)
+		states[viewer] = false
+		values[pos] = stored
+		asked[stored] = append(asked[stored], viewer)
+	}
+	if len(values) == 0 {
+		return states, nil
+	}
+
+	filter := map[string]interface{}{"token": strings.ToLower(token)}
+	fromDB, err := t.Conn.GetByFilterIn(t.Table, filter, "viewer", values)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, record := range fromDB {
+		viewer, ok := record.(map[string]interface{})["viewer"].(string)
+		if !ok {
+			log.Errorf("[%s] - Record has no viewer field", t.Table)
+			continue
+		}
+		for _, name := range asked[viewer] {
+			states[name] = true
+		}
+	}
+
+	return states, nil
+}
+
+// Check returns the trust state of a list of viewers all at once, meant for
+// the bot to use while it's handling chat
+func (t *Trust) Check(ctx *gin.Context) {
+	token := strings.ToLower(html.EscapeString(ctx.Param("token")))
+
+	var checkVals CheckSchema
+	checkData, err := util.ValidateAndMap(
+		ctx.Request.Body, "/trust/checkSchema.json", util.Body(checkVals))
+
+	if validateErr, ok := err.(util.APIError); !ok && err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	} else if ok {
+		// It's a validation error
+		util.NiceError(ctx, validateErr, http.StatusBadRequest)
+		return
+	}
+
+	if err = mapstruct.Decode(checkData, &checkVals); err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+
+	states, err := t.Lookup(token, checkVals.Viewers)
+	if err != nil {
+		util.NiceError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, util.MarshalResponse(CheckResponseSchema{
+		ID:      token,
+		Viewers: states,
+		Token:   token,
+	}))
+}
@@ -0,0 +1,69 @@
+package trust
+
+import (
+	"time"
+
+	"github.com/CactusDev/Xerophi/types"
+	"github.com/CactusDev/Xerophi/util"
+)
+
+// ResponseSchema is the schema for the data that will be sent out to the client
+type ResponseSchema struct {
+	ID        string `jsonapi:"primary,trust"`
+	CreatedAt string `jsonapi:"meta,createdAt,time" filter:"gt,gte,lt,lte"`
+	GrantedBy string `jsonapi:"attr,grantedBy" filter:"eq"`
+	Viewer    string `jsonapi:"attr,viewer" filter:"eq,prefix"`
+	Token     string `jsonapi:"meta,token"`
+	Version   int    `jsonapi:"meta,version"`
+}
+
+// CheckResponseSchema is the schema for the result of a bulk trust check
+type CheckResponseSchema struct {
+	ID      string          `jsonapi:"primary,trustCheck"`
+	Viewers map[string]bool `jsonapi:"attr,viewers"`
+	Token   string          `jsonapi:"meta,token"`
+}
+
+// ClientSchema is the schema the data from the client will be marshalled into
+type ClientSchema struct {
+	GrantedBy string `json:"grantedBy"`
+}
+
+// CreationSchema is all the data required for a viewer to be trusted
+type CreationSchema struct {
+	ClientSchema
+	// Ignore these fields in user input, they will be filled automatically by the API
+	CreatedAt time.Time `json:"createdAt"`
+	DeletedAt float64   `json:"deletedAt"`
+	Token     string    `json:"token"`
+	Viewer    string    `json:"viewer"`
+}
+
+// CheckSchema is the list of viewers the client wants the trust state of
+type CheckSchema struct {
+	Viewers []string `json:"viewers"`
+}
+
+// SelfLink returns the URL the trusted viewer can be retrieved from
+func (rs ResponseSchema) SelfLink() string {
+	return util.ResourceLink(rs.Token, "trust", rs.Viewer)
+}
+
+// JSONAPIMeta returns a meta object for the response
+func (rs ResponseSchema) JSONAPIMeta() *types.Meta {
+	return &types.Meta{
+		"createdAt": rs.CreatedAt,
+		"token":     rs.Token,
+		"version":   rs.Version,
+	}
+}
+
+// GetAPITag allows each of these types to implement the JSONAPISchema interface
+func (rs ResponseSchema) GetAPITag(lookup string) string {
+	return util.FieldTag(rs, lookup, "jsonapi")
+}
+
+// GetAPITag allows each of these types to implement the JSONAPISchema interface
+func (cr CheckResponseSchema) GetAPITag(lookup string) string {
+	return util.FieldTag(cr, lookup, "jsonapi")
+}
@@ -0,0 +1,73 @@
+package trust
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/CactusDev/Xerophi/rethink/rethinktest"
+	"github.com/CactusDev/Xerophi/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	// Schemas are found relative to the root of the repo
+	if err := os.Chdir(".."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func TestGrantAndRevoke(t *testing.T) {
+	trusted := &Trust{Conn: rethinktest.NewMemory(), Table: "trusted"}
+	router := gin.New()
+	group := router.Group(util.BasePath + "/user/:token/trust")
+	for _, route := range trusted.Routes() {
+		if route.Enabled {
+			group.Handle(route.Verb, route.Path, route.Handler)
+		}
+	}
+	send := func(verb string, body string) int {
+		req := httptest.NewRequest(verb, util.BasePath+"/user/channel/trust/Viewer", strings.NewReader(body))
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+	lookup := func() bool {
+		states, err := trusted.Lookup("channel", []string{"VIEWER"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return states["viewer"]
+	}
+
+	if code := send("POST", `{"grantedBy": "mod"}`); code != http.StatusCreated {
+		t.Fatalf("expected the viewer to be trusted, got %d", code)
+	}
+	if code := send("POST", `{"grantedBy": "mod"}`); code != http.StatusConflict {
+		t.Errorf("expected granting trust twice to conflict, got %d", code)
+	}
+	if !lookup() {
+		t.Error("expected the viewer to be looked up as trusted")
+	}
+	if code := send("PATCH", `{"grantedBy": "someone"}`); code != http.StatusNotFound {
+		t.Errorf("expected there to be no way to edit trust, got %d", code)
+	}
+
+	if code := send("DELETE", ""); code != http.StatusOK {
+		t.Fatalf("expected trust to be revoked, got %d", code)
+	}
+	if lookup() {
+		t.Error("expected the viewer not to be trusted once revoked")
+	}
+	if code := send("GET", ""); code != http.StatusNotFound {
+		t.Errorf("expected a revoked viewer not to be found, got %d", code)
+	}
+	if code := send("POST", `{"grantedBy": "mod"}`); code != http.StatusCreated {
+		t.Errorf("expected trust to be granted again, got %d", code)
+	}
+}
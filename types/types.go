@@ -22,17 +22,27 @@ type RouteDetails struct {
 	Handler gin.HandlerFunc
 	Path    string
 	Verb    string
+	// ReadOnly marks a route that doesn't change anything despite its verb,
+	// like a POST that only checks something, so it's left out of the audit
+	// trail
+	ReadOnly bool
 	// Protected secure.AuthDetails	// Information on whether authentication is required
 }
 
+// Router is anything that can provide routes to be registered, for endpoints
+// that don't fit into the usual CRUD handler
+type Router interface {
+	Routes() []RouteDetails
+}
+
 // Handler is the collection of methods required for a type to be a handler
 type Handler interface {
+	Router
 	Update(*gin.Context)
 	GetAll(*gin.Context)
 	GetSingle(*gin.Context)
 	Create(*gin.Context)
 	Delete(*gin.Context)
-	Routes() []RouteDetails
 }
 
 // DatabaseInfo keeps track of the information each handler requires
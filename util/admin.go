@@ -0,0 +1,31 @@
+package util
+
+import (
+	"crypto/subtle"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHeader is the header the admin key is sent in
+const AdminHeader = "X-Admin-Key"
+
+// RequireAdmin only lets requests through that have the admin key. If no key
+// is set the admin endpoints can't be used at all
+func RequireAdmin(key string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if key == "" {
+			Abort(ctx, ErrForbidden, "Admin endpoints are disabled")
+			return
+		}
+		given := ctx.GetHeader(AdminHeader)
+		if given == "" {
+			Abort(ctx, ErrUnauthorized, "The "+AdminHeader+" header is required")
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(given), []byte(key)) != 1 {
+			Abort(ctx, ErrForbidden, "Invalid admin key")
+			return
+		}
+		ctx.Next()
+	}
+}
@@ -0,0 +1,231 @@
+package util
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Error codes clients can switch on. Once a code has been added its meaning
+// must never change, add a new one instead
+const (
+	ErrBadRequest       = "bad_request"         // The request couldn't be handled as is
+	ErrInvalidDocument  = "invalid_document"    // The body isn't valid JSON or a valid JSON:API document
+	ErrValidation       = "validation_failed"   // A field in the body failed validation
+	ErrInvalidParameter = "invalid_parameter"   // A query parameter is malformed or not allowed
+	ErrUnauthorized     = "unauthorized"        // The request needs credentials it didn't have
+	ErrForbidden        = "forbidden"           // The credentials given aren't allowed to do that
+	ErrNotFound         = "not_found"           // The resource or endpoint doesn't exist
+	ErrConflict         = "conflict"            // The resource already exists
+	ErrNotDeleted       = "not_deleted"         // Only a deleted resource can be restored
+	ErrMethodNotAllowed = "method_not_allowed"  // The endpoint doesn't support the method
+	ErrPrecondition     = "precondition_failed" // The resource has changed since the version given
+	ErrInProgress       = "in_progress"         // The same request is already being handled
+	ErrKeyReused        = "key_reused"          // The idempotency key was sent with a different request
+	ErrInternal         = "internal_error"      // Something went wrong on our end
+	ErrUnavailable      = "unavailable"         // A service we depend on is down
+)
+
+// catalogEntry is the status and title that goes with an error code
+type catalogEntry struct {
+	Status int
+	Title  string
+}
+
+// ErrorCatalog is every error code the API can return
+var ErrorCatalog = map[string]catalogEntry{
+	ErrBadRequest:       {http.StatusBadRequest, "Bad request"},
+	ErrInvalidDocument:  {http.StatusBadRequest, "Invalid request document"},
+	ErrValidation:       {http.StatusBadRequest, "Validation failed"},
+	ErrInvalidParameter: {http.StatusBadRequest, "Invalid query parameter"},
+	ErrUnauthorized:     {http.StatusUnauthorized, "Unauthorized"},
+	ErrForbidden:        {http.StatusForbidden, "Forbidden"},
+	ErrNotFound:         {http.StatusNotFound, "Not found"},
+	ErrConflict:         {http.StatusConflict, "Resource already exists"},
+	ErrNotDeleted:       {http.StatusConflict, "Resource isn't deleted"},
+	ErrMethodNotAllowed: {http.StatusMethodNotAllowed, "Method not allowed"},
+	ErrPrecondition:     {http.StatusPreconditionFailed, "Precondition failed"},
+	ErrInProgress:       {http.StatusConflict, "Request in progress"},
+	ErrKeyReused:        {http.StatusUnprocessableEntity, "Idempotency key reused"},
+	ErrInternal:         {http.StatusInternalServerError, "Internal server error"},
+	ErrUnavailable:      {http.StatusServiceUnavailable, "Service unavailable"},
+}
+
+// ErrorSource points at what in the request caused the error
+type ErrorSource struct {
+	Pointer   string `json:"pointer,omitempty"`   // JSON pointer into the request body
+	Parameter string `json:"parameter,omitempty"` // Query parameter name
+}
+
+// ErrorObject is a single JSON:API error object
+type ErrorObject struct {
+	Status string                 `json:"status"`
+	Code   string                 `json:"code"`
+	Title  string                 `json:"title"`
+	Detail string                 `json:"detail,omitempty"`
+	Source *ErrorSource           `json:"source,omitempty"`
+	Meta   map[string]interface{} `json:"meta,omitempty"`
+}
+
+// NewError creates the error object for the code, filling in the status and
+// title from the catalog
+func NewError(code string, detail string) ErrorObject {
+	entry, ok := ErrorCatalog[code]
+	if !ok {
+		log.Errorf("Unknown error code %s", code)
+		code, entry = ErrInternal, ErrorCatalog[ErrInternal]
+	}
+	return ErrorObject{
+		Status: strconv.Itoa(entry.Status),
+		Code:   code,
+		Title:  entry.Title,
+		Detail: detail,
+	}
+}
+
+// ParameterError is an error caused by one of the request's query parameters
+type ParameterError struct {
+	Parameter string
+	Detail    string
+}
+
+// Error allows ParameterError to be returned as an error object
+func (e ParameterError) Error() string {
+	return e.Detail
+}
+
+// InvalidParameter creates a ParameterError for the parameter with a
+// formatted detail message
+func InvalidParameter(param string, format string, args ...interface{}) ParameterError {
+	return ParameterError{Parameter: param, Detail: fmt.Sprintf(format, args...)}
+}
+
+// Objects converts the validation failures into error objects, each pointing
+// at the field that failed
+func (e APIError) Objects() []ErrorObject {
+	code := e.Code
+	if code == "" {
+		code = ErrValidation
+	}
+
+	// Sort the fields so the errors always come out in the same order
+	fields := make([]string, 0, len(e.Data))
+	for field := range e.Data {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	objects := make([]ErrorObject, 0, len(fields))
+	for _, field := range fields {
+		obj := NewError(code, fmt.Sprint(e.Data[field]))
+		pointer := e.Prefix
+		if field != "" && field != "(root)" {
+			pointer += "/" + strings.Replace(field, ".", "/", -1)
+		}
+		if pointer != "" {
+			obj.Source = &ErrorSource{Pointer: pointer}
+		}
+		objects = append(objects, obj)
+	}
+
+	return objects
+}
+
+// codeForStatus picks the generic error code for an HTTP status
+func codeForStatus(status int) string {
+	switch status {
+	case http.StatusUnauthorized:
+		return ErrUnauthorized
+	case http.StatusForbidden:
+		return ErrForbidden
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusConflict:
+		return ErrConflict
+	case http.StatusMethodNotAllowed:
+		return ErrMethodNotAllowed
+	case http.StatusPreconditionFailed:
+		return ErrPrecondition
+	case http.StatusServiceUnavailable:
+		return ErrUnavailable
+	}
+	if status >= 500 {
+		return ErrInternal
+	}
+	return ErrBadRequest
+}
+
+// AbortWithErrors ends the request with an errors document. The response
+// status is the status shared by the errors, or the most general one for its
+// class if they differ
+func AbortWithErrors(ctx *gin.Context, errs ...ErrorObject) {
+	status := http.StatusInternalServerError
+	for pos, obj := range errs {
+		code, _ := strconv.Atoi(obj.Status)
+		if pos == 0 {
+			status = code
+		} else if code != status {
+			status = code / 100 * 100
+		}
+	}
+
+	ctx.AbortWithStatusJSON(status, map[string]interface{}{
+		"jsonapi": map[string]interface{}{"version": JSONAPIVersion},
+		"errors":  errs,
+	})
+}
+
+// Abort ends the request with a single error
+func Abort(ctx *gin.Context, code string, detail string) {
+	AbortWithErrors(ctx, NewError(code, detail))
+}
+
+// Conflict ends the request because the resource already exists, including
+// the existing resource in the error's meta
+func Conflict(ctx *gin.Context, detail string, existing JSONAPISchema) {
+	obj := NewError(ErrConflict, detail)
+	resource, _ := MarshalResource(existing)
+	obj.Meta = map[string]interface{}{"existing": resource}
+	AbortWithErrors(ctx, obj)
+}
+
+// NiceError ends the request with the error given. Validation and parameter
+// errors are turned into error objects pointing at what caused them
+func NiceError(ctx *gin.Context, err error, code int) {
+	if code >= 500 {
+		log.Error(err.Error())
+	} else {
+		log.Debug(err.Error())
+	}
+
+	switch typed := err.(type) {
+	case APIError:
+		AbortWithErrors(ctx, typed.Objects()...)
+	case ParameterError:
+		obj := NewError(ErrInvalidParameter, typed.Detail)
+		obj.Source = &ErrorSource{Parameter: typed.Parameter}
+		AbortWithErrors(ctx, obj)
+	default:
+		obj := NewError(codeForStatus(code), err.Error())
+		// Keep whatever status the caller asked for
+		obj.Status = strconv.Itoa(code)
+		AbortWithErrors(ctx, obj)
+	}
+}
+
+// NoRoute is used for any request that doesn't match an endpoint
+func NoRoute(ctx *gin.Context) {
+	Abort(ctx, ErrNotFound, fmt.Sprintf("No endpoint at %s", ctx.Request.URL.Path))
+}
+
+// NoMethod is used for requests to an endpoint that doesn't support the method
+func NoMethod(ctx *gin.Context) {
+	Abort(ctx, ErrMethodNotAllowed,
+		fmt.Sprintf("%s isn't supported by %s", ctx.Request.Method, ctx.Request.URL.Path))
+}
@@ -1,6 +1,9 @@
 package util
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/url"
 	"reflect"
 	"strings"
 	"time"
@@ -8,73 +11,165 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// JSONAPIVersion is the version of the JSON:API spec our documents follow
+const JSONAPIVersion = "1.0"
+
+// BasePath is where the API's routes are mounted
+const BasePath = "/api/v2"
+
+// TimeFormat is how timestamps are formatted in responses
+var TimeFormat = time.RFC1123
+
 // JSONAPISchema is an interface used for generating the proper JSON API response packet
 type JSONAPISchema interface {
 	GetAPITag(lookup string) string
 }
 
+// SelfLinker is implemented by schemas that know the URL the resource can be
+// retrieved from, which is used for the resource's links.self
+type SelfLinker interface {
+	SelfLink() string
+}
+
+// ResourceLink builds the URL of a channel's resource from the resource type
+// and whatever identifies it in the route
+func ResourceLink(token string, resource string, key string) string {
+	return fmt.Sprintf("%s/user/%s/%s/%s", BasePath,
+		url.PathEscape(token), resource, url.PathEscape(key))
+}
+
+// The tags a field can have after its name in the jsonapi tag
+const (
+	timeOption = "time" // The string field holds an RFC3339 timestamp
+)
+
 // MarshalResponse takes an object that implements the JSONAPISchema interface and marshals it to a map[string]interface{}
-// Sub-structs will be placed automatically under their parent (meta/attr) so there is no need to have that tag on
-// any sub-struct
+// holding a full JSON:API document for that single resource
 func MarshalResponse(s JSONAPISchema) map[string]interface{} {
-	var response = make(map[string]interface{})
+	data, included := MarshalResource(s)
+	return document(data, included)
+}
 
+// MarshalCollection marshals the records into a JSON:API document with the
+// records as the primary data
+func MarshalCollection(records []JSONAPISchema) map[string]interface{} {
+	data, included := marshalResources(records)
+	return document(data, included)
+}
+
+// document wraps the primary data and anything included alongside it into a
+// top level document
+func document(data interface{}, included []map[string]interface{}) map[string]interface{} {
+	var response = map[string]interface{}{
+		"jsonapi": map[string]interface{}{"version": JSONAPIVersion},
+		"data":    data,
+	}
+	if len(included) > 0 {
+		response["included"] = included
+	}
+
+	return response
+}
+
+// marshalResources marshals each of the records, merging everything they
+// include so each related resource only shows up once
+func marshalResources(records []JSONAPISchema) ([]map[string]interface{}, []map[string]interface{}) {
+	var data = make([]map[string]interface{}, 0, len(records))
+	var included []map[string]interface{}
+	for _, record := range records {
+		resource, related := MarshalResource(record)
+		data = append(data, resource)
+		included = mergeIncluded(included, related...)
+	}
+	// Anything that's already primary data doesn't need to be included
+	var filtered []map[string]interface{}
+	for _, resource := range included {
+		if indexOf(data, resource) == -1 {
+			filtered = append(filtered, resource)
+		}
+	}
+
+	return data, filtered
+}
+
+// MarshalResource builds the resource object for the schema, along with the
+// resource objects for everything it has a relationship with.
+// Sub-structs will be placed automatically under their parent (meta/attr) so there is no need to have that tag on
+// any sub-struct
+func MarshalResource(s JSONAPISchema) (map[string]interface{}, []map[string]interface{}) {
 	var data = make(map[string]interface{})
 	ift := reflect.TypeOf(s)
 	ifv := reflect.ValueOf(s)
-	attributes, meta, id, objectType := pullVals(ift, ifv)
+	vals := pullVals(ift, ifv)
 
-	data["attributes"] = attributes
-	data["id"] = id
-	data["type"] = objectType
-	if len(meta) > 0 {
-		response["meta"] = meta
+	data["attributes"] = vals.attr
+	data["id"] = vals.id
+	data["type"] = vals.recordType
+	// A record's meta is about the record rather than the response, so it's
+	// kept in the resource object. It used to be at the top level of the
+	// document, which only leaves the collection meta like the total there
+	if len(vals.meta) > 0 {
+		data["meta"] = vals.meta
+	}
+	if len(vals.relationships) > 0 {
+		data["relationships"] = vals.relationships
+	}
+	if linker, ok := s.(SelfLinker); ok {
+		data["links"] = map[string]string{"self": linker.SelfLink()}
 	}
 
-	response["data"] = data
+	return data, vals.included
+}
 
-	return response
+// fieldVals is everything pulled out of a schema's fields
+type fieldVals struct {
+	attr          map[string]interface{}
+	meta          map[string]interface{}
+	relationships map[string]interface{}
+	included      []map[string]interface{}
+	id            string
+	recordType    string
 }
 
-func pullVals(ift reflect.Type, ifv reflect.Value) (map[string]interface{}, map[string]interface{}, string, string) {
-	var attr = make(map[string]interface{})
-	var meta = make(map[string]interface{})
-	var recordType = ""
-	var id = ""
+func pullVals(ift reflect.Type, ifv reflect.Value) fieldVals {
+	vals := fieldVals{
+		attr:          make(map[string]interface{}),
+		meta:          make(map[string]interface{}),
+		relationships: make(map[string]interface{}),
+	}
 	// Iterate over all the fields in the value
 	for i := 0; i < ift.NumField(); i++ {
-		var value interface{}
 		// Get the tags in array/slice form
 		split := GetTags(ift.Field(i))
 		if split == nil {
 			// It's an anonymous field, ignore it
 			continue
 		}
-		if ifv.Field(i).Kind() == reflect.Struct {
-			var subID = ""
-			var subMeta map[string]interface{}
-			value, subMeta, subID, _ = pullVals(ift.Field(i).Type, ifv.Field(i))
-			if len(subMeta) > 0 {
-				meta[split[0]] = subMeta
-			}
-			if subID != "" && id == "" {
-				id = subID
-			}
+
+		if len(split) > 1 && split[0] == "relation" {
+			linkage, related := marshalRelation(ifv.Field(i))
+			vals.relationships[split[1]] = map[string]interface{}{"data": linkage}
+			vals.included = mergeIncluded(vals.included, related...)
+			continue
 		}
-		value = ifv.Field(i).Interface()
 
-		// HACKity hack hack but it does what we need it to and isn't specifically
-		// BAD code, just code that only currently applies to this specific key
-		// Check if the current key is createdAt
-		if len(split) > 1 && split[1] == "createdAt" {
-			// Format the datetime as human-readable RFC1123
-			t, err := time.Parse(time.RFC3339, value.(string))
-			if err != nil {
-				// If it's stored badly somehow record the error and move on
-				log.Error(err)
-				continue
+		value, isTime, err := timeValue(ifv.Field(i), split)
+		if err != nil {
+			// If it's stored badly somehow record the error and move on
+			log.Error(err)
+			continue
+		}
+		if !isTime && ifv.Field(i).Kind() == reflect.Struct {
+			sub := pullVals(ift.Field(i).Type, ifv.Field(i))
+			if len(sub.meta) > 0 {
+				vals.meta[split[0]] = sub.meta
+			}
+			if sub.id != "" && vals.id == "" {
+				vals.id = sub.id
 			}
-			value = t.Format(time.RFC1123)
+		}
+		if !isTime {
+			value = ifv.Field(i).Interface()
 		}
 
 		// Anything after the first element is tags, figure out which we want
@@ -83,19 +178,158 @@ func pullVals(ift reflect.Type, ifv reflect.Value) (map[string]interface{}, map[
 			switch tag {
 			case "attr":
 				// Attribute
-				attr[split[1]] = value
+				vals.attr[split[1]] = value
 			case "meta":
 				// Meta information about the request
-				meta[split[1]] = value
+				vals.meta[split[1]] = value
 			case "primary":
 				// It's the primary key/record ID & record type
-				id = ifv.Field(i).String()
-				recordType = split[1]
+				vals.id = ifv.Field(i).String()
+				vals.recordType = split[1]
+			}
+		}
+	}
+
+	return vals
+}
+
+// timeValue formats the field if it's a timestamp, either a time.Time or a
+// string tagged with the time option. Zero times are null
+func timeValue(field reflect.Value, tags []string) (interface{}, bool, error) {
+	var t time.Time
+	switch val := field.Interface().(type) {
+	case time.Time:
+		t = val
+	case *time.Time:
+		if val != nil {
+			t = *val
+		}
+	case string:
+		if len(tags) < 3 || !contains(tags[2:], timeOption) {
+			return nil, false, nil
+		}
+		if val != "" {
+			parsed, err := time.Parse(time.RFC3339, val)
+			if err != nil {
+				return nil, true, err
 			}
+			t = parsed
 		}
+	default:
+		return nil, false, nil
+	}
+
+	if t.IsZero() {
+		return nil, true, nil
+	}
+	return t.UTC().Format(TimeFormat), true, nil
+}
+
+// marshalRelation builds the resource linkage for a relationship field, which
+// is either a single related schema or a slice of them. Pointers that are nil
+// and schemas without an ID are empty relationships
+func marshalRelation(field reflect.Value) (interface{}, []map[string]interface{}) {
+	if field.Kind() == reflect.Slice {
+		var linkage = make([]map[string]interface{}, 0, field.Len())
+		var included []map[string]interface{}
+		for i := 0; i < field.Len(); i++ {
+			single, related := marshalRelation(field.Index(i))
+			if single == nil {
+				continue
+			}
+			linkage = append(linkage, single.(map[string]interface{}))
+			included = mergeIncluded(included, related...)
+		}
+		return linkage, included
+	}
+
+	// The schema itself is needed to pull its fields out, not a pointer to it
+	for field.Kind() == reflect.Ptr || field.Kind() == reflect.Interface {
+		if field.IsNil() {
+			return nil, nil
+		}
+		field = field.Elem()
+	}
+	schema, ok := field.Interface().(JSONAPISchema)
+	if !ok {
+		log.Errorf("%s can't be a relationship, it isn't a JSONAPISchema", field.Type())
+		return nil, nil
+	}
+
+	resource, related := MarshalResource(schema)
+	if resource["id"] == "" {
+		return nil, nil
+	}
+	linkage := map[string]interface{}{
+		"type": resource["type"],
+		"id":   resource["id"],
+	}
+
+	return linkage, mergeIncluded(related, resource)
+}
+
+// mergeIncluded adds the resources to the included list, skipping any that
+// are already in it
+func mergeIncluded(included []map[string]interface{}, resources ...map[string]interface{}) []map[string]interface{} {
+	for _, resource := range resources {
+		if indexOf(included, resource) == -1 {
+			included = append(included, resource)
+		}
+	}
+	return included
+}
+
+// indexOf finds the resource with the same type and ID in the list
+func indexOf(resources []map[string]interface{}, resource map[string]interface{}) int {
+	for pos, existing := range resources {
+		if existing["type"] == resource["type"] && existing["id"] == resource["id"] {
+			return pos
+		}
+	}
+	return -1
+}
+
+// UnmarshalDocument pulls the attributes out of a JSON:API request document
+// so they can be treated like any other request body. Anything that isn't a
+// JSON:API document is returned as is, so plain JSON bodies still work
+func UnmarshalDocument(body []byte) ([]byte, bool, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(body, &doc); err != nil {
+		// Not an object, let validation report on it
+		return body, false, nil
+	}
+	raw, ok := doc["data"]
+	if !ok {
+		return body, false, nil
+	}
+	for key := range doc {
+		switch key {
+		case "data", "meta", "jsonapi", "links", "included":
+		default:
+			// Has fields of its own, so "data" is just one of them
+			return body, false, nil
+		}
+	}
+
+	var resource struct {
+		Type       *string         `json:"type"`
+		ID         string          `json:"id"`
+		Attributes json.RawMessage `json:"attributes"`
+	}
+	if err := json.Unmarshal(raw, &resource); err != nil || resource.Type == nil {
+		return nil, true, APIError{Code: ErrInvalidDocument, Data: map[string]interface{}{
+			"data": "Must be a resource object with a type"}}
+	}
+	if len(resource.Attributes) == 0 || string(resource.Attributes) == "null" {
+		return []byte("{}"), true, nil
+	}
+	var attributes map[string]interface{}
+	if err := json.Unmarshal(resource.Attributes, &attributes); err != nil {
+		return nil, true, APIError{Code: ErrInvalidDocument, Data: map[string]interface{}{
+			"data.attributes": "Must be an object"}}
 	}
 
-	return attr, meta, id, recordType
+	return resource.Attributes, true, nil
 }
 
 // GetTags takes a reflect.StructField object and returns a slice of the associated tags
@@ -0,0 +1,181 @@
+package util
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testAuthor struct {
+	ID   string `jsonapi:"primary,author"`
+	Name string `jsonapi:"attr,name"`
+}
+
+func (ta testAuthor) GetAPITag(lookup string) string {
+	return FieldTag(ta, lookup, "jsonapi")
+}
+
+type testPost struct {
+	ID        string       `jsonapi:"primary,post"`
+	Title     string       `jsonapi:"attr,title"`
+	Author    testAuthor   `jsonapi:"relation,author"`
+	Editor    *testAuthor  `jsonapi:"relation,editor"`
+	Readers   []testAuthor `jsonapi:"relation,readers"`
+	CreatedAt string       `jsonapi:"meta,createdAt,time"`
+	EditedAt  time.Time    `jsonapi:"attr,editedAt"`
+	Token     string       `jsonapi:"meta,token"`
+}
+
+func (tp testPost) GetAPITag(lookup string) string {
+	return FieldTag(tp, lookup, "jsonapi")
+}
+
+func (tp testPost) SelfLink() string {
+	return ResourceLink(tp.Token, "post", tp.ID)
+}
+
+// sameJSON checks that the document encodes to the JSON expected
+func sameJSON(t *testing.T, document interface{}, expected string) {
+	t.Helper()
+	encoded, err := json.Marshal(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, want interface{}
+	json.Unmarshal(encoded, &got)
+	if err := json.Unmarshal([]byte(expected), &want); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %s, got %s", expected, encoded)
+	}
+}
+
+func TestMarshalResponse(t *testing.T) {
+	TimeFormat = time.RFC3339
+	defer func() { TimeFormat = time.RFC1123 }()
+
+	sameJSON(t, MarshalResponse(testPost{
+		ID:        "1",
+		Title:     "Hello",
+		Author:    testAuthor{ID: "a", Name: "Ann"},
+		Readers:   []testAuthor{{ID: "b", Name: "Bob"}, {ID: "a", Name: "Ann"}, {Name: "No ID"}},
+		CreatedAt: "2026-03-01T10:00:00+02:00",
+		Token:     "channel",
+	}), `{
+		"jsonapi": {"version": "1.0"},
+		"data": {
+			"type": "post",
+			"id": "1",
+			"attributes": {"title": "Hello", "editedAt": null},
+			"relationships": {
+				"author": {"data": {"type": "author", "id": "a"}},
+				"editor": {"data": null},
+				"readers": {"data": [{"type": "author", "id": "b"}, {"type": "author", "id": "a"}]}
+			},
+			"meta": {"createdAt": "2026-03-01T08:00:00Z", "token": "channel"},
+			"links": {"self": "/api/v2/user/channel/post/1"}
+		},
+		"included": [
+			{"type": "author", "id": "a", "attributes": {"name": "Ann"}},
+			{"type": "author", "id": "b", "attributes": {"name": "Bob"}}
+		]
+	}`)
+
+	// Relations can be pointers to the related schema too
+	sameJSON(t, MarshalResponse(testPost{
+		ID:     "2",
+		Author: testAuthor{ID: "a", Name: "Ann"},
+		Editor: &testAuthor{ID: "c", Name: "Cat"},
+		Token:  "channel",
+	}), `{
+		"jsonapi": {"version": "1.0"},
+		"data": {
+			"type": "post",
+			"id": "2",
+			"attributes": {"title": "", "editedAt": null},
+			"relationships": {
+				"author": {"data": {"type": "author", "id": "a"}},
+				"editor": {"data": {"type": "author", "id": "c"}},
+				"readers": {"data": []}
+			},
+			"meta": {"createdAt": null, "token": "channel"},
+			"links": {"self": "/api/v2/user/channel/post/2"}
+		},
+		"included": [
+			{"type": "author", "id": "a", "attributes": {"name": "Ann"}},
+			{"type": "author", "id": "c", "attributes": {"name": "Cat"}}
+		]
+	}`)
+}
+
+func TestMarshalCollection(t *testing.T) {
+	ann := testAuthor{ID: "a", Name: "Ann"}
+	document := MarshalCollection([]JSONAPISchema{
+		testPost{ID: "1", Author: ann, Token: "channel"},
+		testPost{ID: "2", Author: ann, Token: "channel"},
+		// Already primary data, so it shouldn't be included as well
+		testAuthor{ID: "a", Name: "Ann"},
+	})
+
+	data := document["data"].([]map[string]interface{})
+	if len(data) != 3 {
+		t.Fatalf("expected every record in the data, got %d", len(data))
+	}
+	if _, ok := document["included"]; ok {
+		t.Errorf("expected nothing to be included, got %v", document["included"])
+	}
+
+	document = MarshalCollection([]JSONAPISchema{
+		testPost{ID: "1", Author: ann},
+		testPost{ID: "2", Author: ann},
+	})
+	if included := document["included"].([]map[string]interface{}); len(included) != 1 {
+		t.Errorf("expected the author to be included once, got %v", included)
+	}
+}
+
+func TestUnmarshalDocument(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		want     string
+		document bool
+		err      bool
+	}{
+		{"plain", `{"name": "hi"}`, `{"name": "hi"}`, false, false},
+		{"not an object", `[1]`, `[1]`, false, false},
+		{"data is a field", `{"data": 1, "name": "hi"}`, `{"data": 1, "name": "hi"}`, false, false},
+		{"document", `{"data": {"type": "command", "attributes": {"name": "hi"}}}`, `{"name": "hi"}`, true, false},
+		{"with meta", `{"data": {"type": "command", "attributes": {}}, "meta": {}}`, `{}`, true, false},
+		{"no attributes", `{"data": {"type": "command"}}`, `{}`, true, false},
+		{"null attributes", `{"data": {"type": "command", "attributes": null}}`, `{}`, true, false},
+		{"no type", `{"data": {"attributes": {}}}`, "", true, true},
+		{"not a resource", `{"data": [1]}`, "", true, true},
+		{"bad attributes", `{"data": {"type": "command", "attributes": [1]}}`, "", true, true},
+	}
+
+	for _, test := range tests {
+		got, document, err := UnmarshalDocument([]byte(test.body))
+		if document != test.document {
+			t.Errorf("%s: expected document to be %v", test.name, test.document)
+		}
+		if test.err {
+			if apiErr, ok := err.(APIError); !ok || apiErr.Code != ErrInvalidDocument {
+				t.Errorf("%s: expected an invalid document error, got %v", test.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		var gotVal, wantVal interface{}
+		json.Unmarshal(got, &gotVal)
+		json.Unmarshal([]byte(test.want), &wantVal)
+		if !reflect.DeepEqual(gotVal, wantVal) {
+			t.Errorf("%s: expected %s, got %s", test.name, test.want, got)
+		}
+	}
+}
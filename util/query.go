@@ -0,0 +1,365 @@
+package util
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/CactusDev/Xerophi/rethink"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Default and maximum page sizes for collections
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 500
+)
+
+// CollectionParams are the JSON:API query parameters for a collection,
+// checked against the fields available on the resource's schema
+type CollectionParams struct {
+	Type   string              // The JSON:API type of the resource
+	Limit  int                 // page[limit]
+	Offset int                 // page[offset]
+	After  *rethink.Position   // Decoded from page[cursor]
+	Sort   []rethink.Sort      // sort=-createdAt,name
+	Fields []string            // fields[type]=name,count, nil means all of them
+	Where  []rethink.Condition // filter[name][prefix]=foo
+	meta   []string            // Fields that are always needed to build the response
+	whole  bool                // A computed field was asked for, so grab the whole record
+}
+
+// schemaInfo is what the collection parameters need to know about a schema
+type schemaInfo struct {
+	Type    string                  // The JSON:API type
+	Attrs   []string                // Names of the attribute fields
+	Meta    []string                // Names of the meta fields
+	Filters map[string][]string     // Operators each field can be filtered with
+	Kinds   map[string]reflect.Kind // The type of each field, for parsing filter values
+	Derived []string                // Attributes computed from other fields rather than stored
+}
+
+// schemaFields pulls the JSON:API type, fields and allowed filters out of the
+// schema's tags. Filters are whitelisted with a filter tag listing the
+// operators allowed on that field, e.g. `filter:"eq,prefix"`
+func schemaFields(schema JSONAPISchema) schemaInfo {
+	info := schemaInfo{
+		Filters: make(map[string][]string),
+		Kinds:   make(map[string]reflect.Kind),
+	}
+
+	ift := reflect.TypeOf(schema)
+	for i := 0; i < ift.NumField(); i++ {
+		field := ift.Field(i)
+		split := GetTags(field)
+		if len(split) < 2 {
+			continue
+		}
+		switch split[0] {
+		case "primary":
+			info.Type = split[1]
+		case "attr":
+			info.Attrs = append(info.Attrs, split[1])
+		case "meta":
+			info.Meta = append(info.Meta, split[1])
+		}
+		info.Kinds[split[1]] = field.Type.Kind()
+		// Fields that aren't decoded from the record are filled in afterwards
+		if field.Tag.Get("mapstructure") == "-" {
+			info.Derived = append(info.Derived, split[1])
+		}
+		if ops, ok := field.Tag.Lookup("filter"); ok {
+			info.Filters[split[1]] = strings.Split(ops, ",")
+		}
+	}
+
+	return info
+}
+
+// parseFilterValue converts the raw value from the query string into the
+// type of the field it's filtering
+func parseFilterValue(raw string, kind reflect.Kind) (interface{}, error) {
+	switch kind {
+	case reflect.Bool:
+		return strconv.ParseBool(raw)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(raw, 10, 64)
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(raw, 64)
+	default:
+		return raw, nil
+	}
+}
+
+// parseFilters pulls the filter[field] and filter[field][op] parameters out
+// of the request, making sure each one is allowed by the schema
+func parseFilters(ctx *gin.Context, info schemaInfo) ([]rethink.Condition, error) {
+	var conditions []rethink.Condition
+
+	for key, values := range ctx.Request.URL.Query() {
+		if !strings.HasPrefix(key, "filter[") || !strings.HasSuffix(key, "]") {
+			continue
+		}
+		// filter[field] or filter[field][op]
+		parts := strings.Split(key[len("filter["):len(key)-1], "][")
+		field, op := parts[0], rethink.Eq
+		if len(parts) == 2 {
+			op = parts[1]
+		} else if len(parts) > 2 {
+			return nil, InvalidParameter(key, "Invalid filter %s", key)
+		}
+
+		if !contains(info.Filters[field], op) {
+			return nil, InvalidParameter(key, "Can't filter %s by %s", field, op)
+		}
+
+		for _, raw := range values {
+			value, err := parseFilterValue(raw, info.Kinds[field])
+			// Prefix and contains only make sense on the text itself
+			if op == rethink.Prefix || op == rethink.Contains {
+				value, err = raw, nil
+			}
+			if err != nil {
+				return nil, InvalidParameter(key, "Invalid value for filter[%s]: %s", field, raw)
+			}
+			conditions = append(conditions, rethink.Condition{
+				Field: field, Op: op, Value: value,
+			})
+		}
+	}
+
+	return conditions, nil
+}
+
+// contains checks if the slice has the value in it
+func contains(values []string, value string) bool {
+	for _, val := range values {
+		if val == value {
+			return true
+		}
+	}
+	return false
+}
+
+// encodePageCursor turns the position of the last record on a page into an
+// opaque cursor, the value of each sort field followed by the ID
+func encodePageCursor(position rethink.Position) string {
+	raw, _ := json.Marshal(append(append([]interface{}(nil), position.Values...), position.ID))
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodePageCursor turns a cursor from the client back into a position in an
+// order sorted on the number of fields given
+func decodePageCursor(cursor string, sorts int) (*rethink.Position, error) {
+	invalid := InvalidParameter("page[cursor]", "Invalid page[cursor]")
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, invalid
+	}
+	var values []interface{}
+	if err := json.Unmarshal(raw, &values); err != nil || len(values) != sorts+1 {
+		return nil, invalid
+	}
+	id, ok := values[sorts].(string)
+	if !ok {
+		return nil, invalid
+	}
+	return &rethink.Position{Values: values[:sorts], ID: id}, nil
+}
+
+// ParseCollectionParams pulls the pagination, sorting, sparse fieldset and
+// filter parameters out of the request. Only fields that exist on the schema
+// can be sorted by or selected, and only whitelisted ones can be filtered
+func ParseCollectionParams(ctx *gin.Context, schema JSONAPISchema) (CollectionParams, error) {
+	info := schemaFields(schema)
+	recordType, attrs, meta := info.Type, info.Attrs, info.Meta
+	params := CollectionParams{
+		Type:  recordType,
+		Limit: DefaultPageLimit,
+		meta:  append([]string{"id"}, meta...),
+	}
+
+	where, err := parseFilters(ctx, info)
+	if err != nil {
+		return params, err
+	}
+	params.Where = where
+
+	if raw := ctx.Query("page[limit]"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > MaxPageLimit {
+			return params, InvalidParameter("page[limit]",
+				"page[limit] must be between 1 and %d", MaxPageLimit)
+		}
+		params.Limit = limit
+	}
+
+	if raw := ctx.Query("page[offset]"); raw != "" {
+		offset, err := strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			return params, InvalidParameter("page[offset]",
+				"page[offset] must be a number that's at least 0")
+		}
+		params.Offset = offset
+	}
+
+	if raw := ctx.Query("sort"); raw != "" {
+		for _, field := range strings.Split(raw, ",") {
+			sort := rethink.Sort{Field: strings.TrimSpace(field)}
+			if strings.HasPrefix(sort.Field, "-") {
+				sort.Field = sort.Field[1:]
+				sort.Descending = true
+			}
+			if (!contains(attrs, sort.Field) && !contains(meta, sort.Field)) ||
+				contains(info.Derived, sort.Field) {
+				return params, InvalidParameter("sort", "Can't sort by %s", sort.Field)
+			}
+			params.Sort = append(params.Sort, sort)
+		}
+	}
+	if len(params.Sort) == 0 {
+		// Something has to be sorted on so pages are stable
+		params.Sort = []rethink.Sort{{Field: "createdAt"}}
+	}
+
+	// The cursor is a position in the sort order, so it's decoded once the
+	// order is known
+	if raw := ctx.Query("page[cursor]"); raw != "" {
+		if params.Offset > 0 {
+			return params, InvalidParameter("page[cursor]",
+				"page[cursor] can't be used along with page[offset]")
+		}
+		after, err := decodePageCursor(raw, len(params.Sort))
+		if err != nil {
+			return params, err
+		}
+		params.After = after
+	}
+
+	if raw, ok := ctx.GetQuery(fmt.Sprintf("fields[%s]", recordType)); ok {
+		params.Fields = make([]string, 0)
+		for _, field := range strings.Split(raw, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			if !contains(attrs, field) {
+				return params, InvalidParameter(fmt.Sprintf("fields[%s]", recordType),
+					"%s has no field %s", recordType, field)
+			}
+			params.Fields = append(params.Fields, field)
+			if contains(info.Derived, field) {
+				params.whole = true
+			}
+		}
+	}
+
+	return params, nil
+}
+
+// Query turns the parameters into a storage query for the records matching
+// the filter
+func (p CollectionParams) Query(filter map[string]interface{}) rethink.Query {
+	query := rethink.Query{
+		Filter: filter,
+		Where:  p.Where,
+		Sort:   p.Sort,
+		After:  p.After,
+		Offset: p.Offset,
+		Limit:  p.Limit,
+	}
+	if p.Fields != nil && !p.whole {
+		// The ID and meta are always part of the response, so always grab them,
+		// along with what's sorted on for the next page's cursor
+		query.Fields = append(append([]string{"deletedAt"}, p.meta...), p.Fields...)
+		for _, sort := range p.Sort {
+			if !contains(query.Fields, sort.Field) {
+				query.Fields = append(query.Fields, sort.Field)
+			}
+		}
+	}
+	return query
+}
+
+// Sparse removes any attributes that weren't asked for in the fieldset
+func (p CollectionParams) Sparse(attributes map[string]interface{}) map[string]interface{} {
+	if p.Fields == nil {
+		return attributes
+	}
+	var sparse = make(map[string]interface{}, len(p.Fields))
+	for _, field := range p.Fields {
+		if val, ok := attributes[field]; ok {
+			sparse[field] = val
+		}
+	}
+	return sparse
+}
+
+// Links generates the self, next and prev links for the current page, given
+// the records on it as they were stored. The next page is always picked with
+// a cursor after the last record, so it stays put while records are added.
+// Only pages picked by offset have a prev link, a cursor only goes forwards
+func (p CollectionParams) Links(ctx *gin.Context, total int, fromDB []interface{}) map[string]string {
+	link := func(param string, value string) string {
+		page := *ctx.Request.URL
+		params := page.Query()
+		params.Del("page[offset]")
+		params.Del("page[cursor]")
+		params.Set("page[limit]", strconv.Itoa(p.Limit))
+		params.Set(param, value)
+		page.RawQuery = params.Encode()
+		return page.RequestURI()
+	}
+
+	links := map[string]string{"self": ctx.Request.URL.RequestURI()}
+	// A full page means there could be more
+	more := len(fromDB) == p.Limit && (p.After != nil || p.Offset+p.Limit < total)
+	if position := p.position(fromDB); more && position != nil {
+		links["next"] = link("page[cursor]", encodePageCursor(*position))
+	}
+	if p.After == nil && p.Offset > 0 {
+		prev := p.Offset - p.Limit
+		if prev < 0 {
+			prev = 0
+		}
+		links["prev"] = link("page[offset]", strconv.Itoa(prev))
+	}
+
+	return links
+}
+
+// position returns where the last of the records is in the sort order, or nil
+// if there aren't any
+func (p CollectionParams) position(fromDB []interface{}) *rethink.Position {
+	if len(fromDB) == 0 {
+		return nil
+	}
+	last, _ := fromDB[len(fromDB)-1].(map[string]interface{})
+	id, ok := last["id"].(string)
+	if !ok {
+		return nil
+	}
+	var values = make([]interface{}, len(p.Sort))
+	for pos, sort := range p.Sort {
+		values[pos] = last[sort.Field]
+	}
+	return &rethink.Position{Values: values, ID: id}
+}
+
+// Document builds the response document for a page of a collection, from the
+// records decoded from what was stored
+func (p CollectionParams) Document(ctx *gin.Context, records []JSONAPISchema,
+	fromDB []interface{}, total int) map[string]interface{} {
+	response := MarshalCollection(records)
+	for _, resource := range response["data"].([]map[string]interface{}) {
+		resource["attributes"] = p.Sparse(resource["attributes"].(map[string]interface{}))
+	}
+	response["links"] = p.Links(ctx, total, fromDB)
+	response["meta"] = map[string]interface{}{"total": total}
+
+	return response
+}
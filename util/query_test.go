@@ -0,0 +1,132 @@
+package util
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/CactusDev/Xerophi/rethink"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pageContext is a request for a collection with the query string given
+func pageContext(query string) *gin.Context {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest("GET", BasePath+"/user/channel/post?"+query, nil)
+	return ctx
+}
+
+func TestPageOffset(t *testing.T) {
+	params, err := ParseCollectionParams(pageContext("page[offset]=20&page[limit]=10"), testAuthor{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.Offset != 20 || params.Query(nil).Offset != 20 {
+		t.Errorf("expected to skip 20 records, got %d", params.Offset)
+	}
+
+	for _, bad := range []string{"-1", "ten", "MjA"} {
+		if _, err := ParseCollectionParams(pageContext("page[offset]="+bad), testAuthor{}); err == nil {
+			t.Errorf("expected page[offset]=%s to be rejected", bad)
+		}
+	}
+}
+
+// pageRecords are the stored records on a page, named after their position
+func pageRecords(count int) []interface{} {
+	records := make([]interface{}, count)
+	for pos := range records {
+		records[pos] = map[string]interface{}{
+			"id": strconv.Itoa(pos), "name": "Author " + strconv.Itoa(pos),
+		}
+	}
+	return records
+}
+
+func TestPageCursor(t *testing.T) {
+	cursor := encodePageCursor(rethink.Position{Values: []interface{}{"Cat", 12.0}, ID: "c"})
+	params, err := ParseCollectionParams(
+		pageContext("sort=-title,createdAt&page[cursor]="+cursor), testPost{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &rethink.Position{Values: []interface{}{"Cat", 12.0}, ID: "c"}
+	if !reflect.DeepEqual(params.After, want) || !reflect.DeepEqual(params.Query(nil).After, want) {
+		t.Errorf("expected to start after %v, got %v", want, params.After)
+	}
+
+	for _, bad := range []string{
+		"not-a-cursor",
+		// One value short for the two fields sorted on
+		encodePageCursor(rethink.Position{Values: []interface{}{"Cat"}, ID: "c"}),
+		base64.RawURLEncoding.EncodeToString([]byte(`["Cat", 12, 3]`)),
+		cursor + "&page[offset]=10",
+	} {
+		query := "sort=-title,createdAt&page[cursor]=" + bad
+		if _, err := ParseCollectionParams(pageContext(query), testPost{}); err == nil {
+			t.Errorf("expected %s to be rejected", query)
+		}
+	}
+}
+
+func TestPageLinks(t *testing.T) {
+	tests := []struct {
+		query  string
+		total  int
+		onPage int
+		next   string // The ID the next page starts after
+		prev   string
+	}{
+		{"page[limit]=10", 25, 10, "9", ""},
+		{"page[limit]=10&page[offset]=10", 25, 10, "9", "0"},
+		{"page[limit]=10&page[offset]=20", 25, 5, "", "10"},
+		{"page[limit]=10&page[offset]=5", 25, 10, "9", "0"},
+		{"page[limit]=10&page[offset]=15", 25, 10, "", "5"},
+		{"page[limit]=10&page[cursor]=" + encodePageCursor(rethink.Position{
+			Values: []interface{}{"Author 0"}, ID: "0"}) + "&sort=name", 25, 10, "9", ""},
+	}
+
+	for _, test := range tests {
+		ctx := pageContext(test.query)
+		params, err := ParseCollectionParams(ctx, testAuthor{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		links := params.Links(ctx, test.total, pageRecords(test.onPage))
+		for name, want := range map[string]string{"next": test.next, "prev": test.prev} {
+			link, ok := links[name]
+			if want == "" {
+				if ok {
+					t.Errorf("%s: expected no %s link, got %s", test.query, name, link)
+				}
+				continue
+			}
+			parsed, err := url.Parse(link)
+			if err != nil {
+				t.Fatal(err)
+			}
+			page := parsed.Query()
+			if name == "prev" {
+				if got := page.Get("page[offset]"); got != want {
+					t.Errorf("%s: expected the prev link to start at %s, got %s", test.query, want, got)
+				}
+				continue
+			}
+			if page.Get("page[offset]") != "" {
+				t.Errorf("%s: expected the next link to use a cursor, got %s", test.query, link)
+			}
+			nextCtx := pageContext(parsed.RawQuery)
+			next, err := ParseCollectionParams(nextCtx, testAuthor{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if next.After == nil || next.After.ID != want {
+				t.Errorf("%s: expected the next link to start after %s, got %v", test.query, want, next.After)
+			}
+		}
+	}
+}
@@ -5,10 +5,19 @@ import (
 	"fmt"
 
 	"github.com/gin-gonic/gin"
-
-	log "github.com/sirupsen/logrus"
 )
 
+// ActorHeader is the header the bot sends with the name of the user it's
+// acting on behalf of
+const ActorHeader = "X-Acting-User"
+
+// Actor returns who the request is being made on behalf of, or "" if the
+// client didn't say. It's whatever the client sent and isn't verified, so
+// it's only as trustworthy as the client with the channel's token
+func Actor(ctx *gin.Context) string {
+	return ctx.GetHeader(ActorHeader)
+}
+
 // GetFromOffset generates a human-readable line/character error from a
 // JSON error's offset
 func GetFromOffset(input string, offset int) (string, error) {
@@ -48,17 +57,6 @@ func MapStringToInterface(vars map[string]string) map[string]interface{} {
 	return converted
 }
 
-// NiceError factors away the erroring of a function into a clean single-line function call
-func NiceError(ctx *gin.Context, err error, code int) {
-	log.Error(err.Error())
-	errResp := map[string][]string{
-		"errors": []string{
-			err.Error(),
-		},
-	}
-	ctx.AbortWithStatusJSON(code, errResp)
-}
-
 // GetResourceID tries to extract the ID from data given
 func GetResourceID(data interface{}) (string, error) {
 	var mapped map[string]interface{}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"reflect"
 
 	"github.com/CactusDev/Xerophi/types"
 	jschema "github.com/xeipuuv/gojsonschema"
@@ -13,7 +14,9 @@ import (
 
 // APIError is an alias for map[string]string to make cleaner code
 type APIError struct {
-	Data map[string]interface{}
+	Data   map[string]interface{}
+	Code   string // The error code, validation_failed if it's not set
+	Prefix string // JSON pointer to where the fields are in the request body
 }
 
 // Error allows APIError to be returned as an error object
@@ -37,6 +40,14 @@ func ValidateAndMap(in io.Reader, schemaPath string, schema types.Schema) (map[s
 	if err != nil {
 		return nil, err
 	}
+	if syntaxErr := checkSyntax(bodyData); syntaxErr != nil {
+		return nil, syntaxErr
+	}
+	// JSON:API documents carry the data we want in data.attributes
+	bodyData, isDocument, err := UnmarshalDocument(bodyData)
+	if err != nil {
+		return nil, err
+	}
 
 	// Validate the data
 	err = ValidateInput(bodyData, schemaPath)
@@ -45,6 +56,9 @@ func ValidateAndMap(in io.Reader, schemaPath string, schema types.Schema) (map[s
 		return nil, err
 	} else if ok {
 		// It's a validation error
+		if isDocument {
+			validateErr.Prefix = "/data/attributes"
+		}
 		return nil, validateErr
 	}
 
@@ -65,7 +79,7 @@ func ValidateAndMap(in io.Reader, schemaPath string, schema types.Schema) (map[s
 // ValidateInput valids the data provided against the provided JSON schema
 // Will only return an error if there's a problem with the data
 func ValidateInput(source []byte, schema string) error {
-	var errors APIError
+	var errors = APIError{Data: make(map[string]interface{})}
 
 	path, err := os.Getwd()
 	if err != nil {
@@ -84,7 +98,17 @@ func ValidateInput(source []byte, schema string) error {
 
 	if res.Errors() != nil {
 		for _, jschemaErr := range res.Errors() {
-			errors.Data[jschemaErr.Field()] = jschemaErr.Description()
+			field := jschemaErr.Field()
+			// Missing fields are reported against their parent, point at the field itself
+			if property, ok := jschemaErr.Details()["property"].(string); ok &&
+				jschemaErr.Type() == "required" {
+				if field == "(root)" {
+					field = property
+				} else {
+					field += "." + property
+				}
+			}
+			errors.Data[field] = jschemaErr.Description()
 		}
 		// There were errors, return those
 		return errors
@@ -93,3 +117,64 @@ func ValidateInput(source []byte, schema string) error {
 	// Passed validation
 	return nil
 }
+
+// checkSyntax makes sure the body is valid JSON, pointing out where it isn't
+func checkSyntax(body []byte) error {
+	var parsed interface{}
+	err := json.Unmarshal(body, &parsed)
+	if err == nil {
+		return nil
+	}
+
+	detail := err.Error()
+	if syntaxErr, ok := err.(*json.SyntaxError); ok {
+		if located, locErr := GetFromOffset(string(body), int(syntaxErr.Offset)-1); locErr == nil {
+			detail = located
+		}
+	}
+	return APIError{Code: ErrInvalidDocument, Data: map[string]interface{}{"": detail}}
+}
+
+// jsonBody lets any struct be used as a types.Schema
+type jsonBody struct {
+	value interface{}
+}
+
+// Body wraps a plain struct so it can be validated and mapped like a schema
+// with a DumpBody method. Fields already set on the struct are used as
+// defaults for anything the body doesn't have
+func Body(value interface{}) types.Schema {
+	return jsonBody{value: value}
+}
+
+// DumpBody dumps the body data bytes into a copy of the wrapped struct and
+// returns the bytes from that
+func (b jsonBody) DumpBody(data []byte) ([]byte, error) {
+	// Copy the defaults so the wrapped value can be reused
+	copied := reflect.New(reflect.TypeOf(b.value))
+	copied.Elem().Set(reflect.ValueOf(b.value))
+
+	if err := json.Unmarshal(data, copied.Interface()); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(copied.Interface())
+}
+
+// KeepDefaults sets the fields back to their values in the defaults the body
+// was dumped over. It's for the fields the API owns, which the body isn't
+// allowed to change
+func KeepDefaults(data map[string]interface{}, defaults interface{}, fields ...string) error {
+	raw, err := json.Marshal(defaults)
+	if err != nil {
+		return err
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return err
+	}
+	for _, field := range fields {
+		data[field] = values[field]
+	}
+	return nil
+}